@@ -1,32 +1,82 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/craigderington/lantern/internal/api"
+	"github.com/craigderington/lantern/internal/config"
+	"github.com/craigderington/lantern/internal/health"
 	"github.com/craigderington/lantern/internal/k8s"
+	"github.com/craigderington/lantern/internal/supervisor"
+	"github.com/craigderington/lantern/internal/tlsserver"
+	"github.com/craigderington/lantern/internal/web"
 	"github.com/craigderington/lantern/internal/websocket"
 )
 
+// configPollInterval is how often the config and sidecar rules files are checked for changes
+const configPollInterval = 2 * time.Second
+
+// statusCheckInterval is how often the cluster connection is checked for backend_status
+const statusCheckInterval = 5 * time.Second
+
+// readyCheckTimeout bounds each readiness check, within the default 1s probe timeout
+const readyCheckTimeout = 800 * time.Millisecond
+
 func main() {
+	// Load configuration from the config file, environment and flags
+	cfg, opts, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if opts.PrintConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatalf("Failed to render configuration: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	if opts.ConfigFile != "" {
+		log.Printf("Loaded configuration from %s", opts.ConfigFile)
+	}
+
+	// Everything runs under one root context, cancelled on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sup := supervisor.New(ctx)
+
 	// Initialize Kubernetes client
-	client, err := k8s.NewClient()
+	client, err := k8s.NewClient(sup.Context(), cfg)
 	if err != nil {
 		log.Fatalf("Failed to create k8s client: %v", err)
 	}
 
+	// Aggregate pods into clusters for galaxy mode
+	aggregator := k8s.NewAggregator()
+
 	// Create WebSocket hub
-	hub := websocket.NewHub()
-	go hub.Run()
+	hub := websocket.NewHub(cfg)
+	hub.SetAggregator(aggregator)
+	sup.Go("websocket hub", hub.Run)
 
 	// Start watching Kubernetes events
-	events := make(chan k8s.WatchEvent, 256)
+	events := make(chan k8s.WatchEvent, cfg.Stream.BufferSize)
 
 	if err := client.WatchPods(events); err != nil {
 		log.Fatalf("Failed to start pod watcher: %v", err)
@@ -36,92 +86,373 @@ func main() {
 		log.Fatalf("Failed to start node watcher: %v", err)
 	}
 
-	// Forward Kubernetes events to WebSocket clients
-	go func() {
+	// Once the watchers have stopped, closing events drains the stages below in order
+	sup.Go("kubernetes watchers", func(ctx context.Context) {
+		<-ctx.Done()
+		client.Shutdown()
+		close(events)
+	})
+
+	// Batch pod events into pods_changed messages, dropping no-op modifications
+	pipelineIn := make(chan k8s.WatchEvent, cfg.Stream.BufferSize)
+	pipelineOut := make(chan k8s.WatchEvent, cfg.Stream.BufferSize)
+	pipeline := k8s.NewEventPipeline(cfg.Stream.BatchWindow.Duration)
+	sup.Go("event pipeline", func(context.Context) {
+		pipeline.Run(pipelineIn, pipelineOut)
+	})
+
+	// The aggregator sees every raw event; clients get the batched stream
+	sup.Go("event aggregator", func(context.Context) {
+		defer close(pipelineIn)
 		for event := range events {
+			aggregator.Apply(event)
+			pipelineIn <- event
+		}
+	})
+
+	// Forward batched events to WebSocket clients
+	sup.Go("event broadcaster", func(context.Context) {
+		for event := range pipelineOut {
 			if err := hub.BroadcastEvent(string(event.Type), event); err != nil {
 				log.Printf("Error broadcasting event: %v", err)
 			}
 		}
-	}()
+	})
 
-	// Start metrics fetcher (5 second interval)
-	metricsFetcher := k8s.NewMetricsFetcher(client, 5*time.Second)
-	metricsChannel := metricsFetcher.Start()
+	// Start metrics fetcher, reading from metrics-server or the kubelets
+	metricsSource, err := k8s.NewMetricsSource(client, cfg.Metrics)
+	if err != nil {
+		log.Fatalf("Failed to create metrics source: %v", err)
+	}
+	metricsFetcher := k8s.NewMetricsFetcher(client, metricsSource, cfg)
+	metricsChannel := metricsFetcher.Start(sup.Context())
+
+	// Track the cluster connection and tell clients when it degrades or recovers
+	statusMonitor := k8s.NewStatusMonitor(client, metricsFetcher)
+	sup.Go("status monitor", func(ctx context.Context) {
+		statusMonitor.Run(ctx, statusCheckInterval, func(status k8s.BackendStatus) {
+			if err := hub.BroadcastEvent("backend_status", status); err != nil {
+				log.Printf("Error broadcasting backend status: %v", err)
+			}
+		})
+	})
+
+	// Send new clients the cached cluster state before any deltas
+	hub.SetSnapshotFunc(func() (interface{}, error) {
+		snapshot, err := client.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Metrics = metricsFetcher.Latest()
+		status := statusMonitor.Current()
+		snapshot.Status = &status
+		return snapshot, nil
+	})
 
 	// Forward metrics updates to WebSocket clients
-	go func() {
+	sup.Go("metrics broadcaster", func(context.Context) {
 		for update := range metricsChannel {
+			aggregator.ApplyMetrics(update)
 			if err := hub.BroadcastEvent("metrics_update", update); err != nil {
 				log.Printf("Error broadcasting metrics: %v", err)
 			}
 		}
-	}()
+	})
+
+	// Publish aggregated clusters to galaxy-mode clients when anything changed
+	sup.Go("cluster publisher", func(ctx context.Context) {
+		aggregator.Run(ctx, cfg.Stream.ClusterInterval.Duration, func(update k8s.ClustersUpdate) {
+			if err := hub.BroadcastEvent("clusters_update", update); err != nil {
+				log.Printf("Error broadcasting clusters: %v", err)
+			}
+		})
+	})
 
 	// Create API handler
-	apiHandler := api.NewHandler(client)
+	apiHandler := api.NewHandler(client, aggregator, metricsFetcher, cfg)
+
+	// Apply live settings on reload; the rest are reported as needing a restart
+	reloader := config.NewReloader(os.Args[1:], cfg, opts)
+	reloader.OnReload(client.Reconfigure)
+	reloader.OnReload(metricsFetcher.Reconfigure)
+	reloader.OnReload(hub.Reconfigure)
+	reloader.OnReload(apiHandler.Reconfigure)
+	sup.Go("config watcher", func(ctx context.Context) {
+		reloader.Watch(configPollInterval, ctx.Done())
+	})
 
-	// Setup routes
+	// Readiness reflects the cluster connection, the watches, metrics and the hub
+	checker := readinessChecker(client, metricsFetcher, hub)
+
+	// REST endpoints, served under /api/v1 and the legacy /api prefix
+	routes := append(apiHandler.Routes(),
+		api.Route{Path: "/health", Summary: "Liveness check: the process is serving requests", Response: map[string]string{}, Handler: health.ServeLive},
+		api.Route{Path: "/ready", Summary: "Readiness check of the Kubernetes API, watches, metrics and WebSocket hub; 503 when not ready", Response: health.Report{},
+			Errors: map[int]api.ErrorResponse{http.StatusServiceUnavailable: {Description: "A critical check failed", Body: health.Report{}}}, Handler: checker.ServeReady},
+		api.Route{Path: "/status", Summary: "Connection state of the backend to the cluster, as sent in backend_status events", Response: k8s.BackendStatus{}, Handler: statusHandler(statusMonitor)},
+		api.Route{Path: "/ws/stats", Summary: "WebSocket delivery counters", Response: websocket.HubStats{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			websocket.ServeStats(hub, w, r)
+		}},
+		api.Route{Path: "/admin/reload", Method: http.MethodPost, Summary: "Reload the configuration and report which changes need a restart", Response: config.ReloadReport{}, Admin: true, Handler: reloadHandler(reloader)},
+		api.Route{
+			Path:    "/events",
+			Summary: "Live event stream as Server-Sent Events, filtered like the WebSocket",
+			Params: []api.Param{
+				{Name: "namespaces"}, {Name: "labelSelector"}, {Name: "events"},
+				{Name: "metrics", Enum: []string{"true", "false"}}, {Name: "lastEventId"},
+			},
+			ContentType: "text/event-stream",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				websocket.ServeSSE(hub, w, r)
+			},
+		},
+	)
+	routes = append(routes, api.DocumentationRoutes(routes)...)
+
+	// Setup routes, allowing cross-origin requests from the configured
+	// origins to all but the admin routes
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/health", healthHandler)
-	mux.HandleFunc("/api/nodes", apiHandler.GetNodes)
-	mux.HandleFunc("/api/pods", apiHandler.GetPods)
-	mux.HandleFunc("/api/pods/describe", apiHandler.DescribePod)
-	mux.HandleFunc("/api/nodes/describe", apiHandler.DescribeNode)
-	mux.HandleFunc("/api/pods/logs", apiHandler.GetPodLogs)
-	mux.HandleFunc("/api/pods/metrics", apiHandler.GetPodMetrics)
-	mux.HandleFunc("/api/nodes/metrics", apiHandler.GetNodeMetrics)
+	for _, route := range routes {
+		handler := enableCORS(reloader, route.Handler)
+		if route.Admin {
+			handler = adminOnly(cfg.Server.TLS, route.Handler)
+		}
+		mux.Handle(api.BasePath+route.Path, handler)
+		mux.Handle(api.LegacyBasePath+route.Path, handler)
+	}
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		websocket.ServeWs(hub, w, r)
 	})
 
-	// Enable CORS for development
-	corsHandler := enableCORS(mux)
+	// Conventional probe paths for Kubernetes
+	mux.HandleFunc("/healthz", health.ServeLive)
+	mux.HandleFunc("/readyz", checker.ServeReady)
+
+	// Serve the embedded frontend for everything else
+	basePath := cfg.Server.BasePath
+	if cfg.Server.ServeUI {
+		ui, err := web.NewHandler(basePath)
+		if err != nil {
+			log.Fatalf("Failed to load embedded frontend: %v", err)
+		}
+		if !ui.Built() {
+			log.Println("Frontend not embedded in this build; serving a placeholder page")
+		}
+		mux.Handle("/", ui)
+	}
+
+	// Mount everything under the base path
+	var handler http.Handler = mux
+	if basePath != "" {
+		root := http.NewServeMux()
+		root.Handle(basePath+"/", http.StripPrefix(basePath, mux))
+		root.Handle(basePath, http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+		handler = root
+	}
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// Reload the configuration on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	sup.Go("reload signal", func(ctx context.Context) {
+		defer signal.Stop(hupChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				report, err := reloader.Reload()
+				config.LogReload("SIGHUP", report, err)
+			}
+		}
+	})
 
-	go func() {
-		<-sigChan
-		log.Println("Shutting down gracefully...")
-		metricsFetcher.Stop()
-		os.Exit(0)
-	}()
+	port := strconv.Itoa(cfg.Server.Port)
+	server := &http.Server{Addr: ":" + port, Handler: handler}
+
+	// Serve HTTPS when a certificate is configured, optionally verifying client certificates
+	tlsConfig := cfg.Server.TLS
+	if tlsConfig.Enabled() {
+		certs, err := tlsserver.New(tlsConfig)
+		if err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		server.TLSConfig = certs.Config()
+		if tlsConfig.ClientCAFile != "" {
+			server.Handler = certs.Identify(handler)
+			log.Printf("Verifying client certificates against %s (%s)", tlsConfig.ClientCAFile, tlsConfig.ClientIdentity)
+		}
+		sup.Go("certificate watcher", func(ctx context.Context) {
+			certs.Watch(configPollInterval, ctx.Done())
+		})
+	}
 
 	// Start server
-	port := getEnv("PORT", "8000")
-	log.Printf("Observatory backend starting on port %s...", port)
-	log.Printf("Endpoints available:")
-	log.Printf("  GET /api/health")
-	log.Printf("  GET /api/nodes")
-	log.Printf("  GET /api/pods")
-	log.Printf("  GET /api/pods/describe?namespace=X&name=Y")
-	log.Printf("  GET /api/nodes/describe?name=X")
-	log.Printf("  GET /api/pods/logs?namespace=X&name=Y&container=Z")
-	log.Printf("  GET /api/pods/metrics?namespace=X&name=Y")
-	log.Printf("  GET /api/nodes/metrics?name=X")
-	log.Printf("  WS  /ws")
-	log.Printf("Metrics fetcher running (5s interval)")
-
-	if err := http.ListenAndServe(":"+port, corsHandler); err != nil {
+	scheme := "http"
+	if tlsConfig.Enabled() {
+		scheme = "https"
+	}
+	log.Printf("Observatory backend starting on port %s (%s)...", port, scheme)
+	log.Printf("Endpoints available (also under %s for existing clients):", basePath+api.LegacyBasePath)
+	for _, route := range routes {
+		log.Printf("  %-4s %s", route.HTTPMethod(), basePath+route.Endpoint())
+	}
+	log.Printf("  WS   %s/ws", basePath)
+	log.Printf("  GET  %s/healthz, %s/readyz", basePath, basePath)
+	if cfg.Server.ServeUI {
+		log.Printf("  UI   %s/", basePath)
+	}
+	log.Printf("Metrics fetcher running (%s interval, source %s)", cfg.Metrics.Interval.Duration, cfg.Metrics.Source)
+
+	serve := server.ListenAndServe
+	if tlsConfig.Enabled() {
+		serve = func() error { return server.ListenAndServeTLS("", "") }
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- serve()
+	}()
+	select {
+	case err := <-served:
 		log.Fatalf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process without waiting
+	stop()
+	log.Println("Shutting down gracefully...")
+
+	// One deadline covers both stopping the server and the goroutines. The
+	// server stops accepting connections and lets in-flight requests finish;
+	// WebSockets and event streams are closed by the hub, which stops with
+	// everything else now that ctx is cancelled.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
 	}
+	if err := sup.Wait(shutdownCtx); err != nil {
+		log.Printf("Shutdown incomplete: %v", err)
+		os.Exit(1)
+	}
+	log.Println("Shutdown complete")
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "ok",
-		"service": "observatory-backend",
+// readinessChecker checks the dependencies the backend needs to serve live data
+func readinessChecker(client *k8s.Client, metricsFetcher *k8s.MetricsFetcher, hub *websocket.Hub) *health.Checker {
+	checker := health.NewChecker(readyCheckTimeout)
+
+	checker.Add("kubernetes-api", true, func(ctx context.Context) (string, error) {
+		if err := client.Ping(ctx); err != nil {
+			return "", err
+		}
+		return "reachable", nil
+	})
+
+	checker.Add("informer-sync", true, func(context.Context) (string, error) {
+		var unsynced []string
+		for _, watch := range client.WatchStatus() {
+			if !watch.Synced {
+				unsynced = append(unsynced, watch.Resource)
+			}
+		}
+		if len(unsynced) > 0 {
+			return "", fmt.Errorf("not synced: %s", strings.Join(unsynced, ", "))
+		}
+		return "all caches synced", nil
 	})
+
+	checker.Add("watches", true, func(context.Context) (string, error) {
+		now := time.Now()
+		var details, failed []string
+		for _, watch := range client.WatchStatus() {
+			lastEvent := "no events"
+			if !watch.LastEvent.IsZero() {
+				lastEvent = "last event " + time.Since(watch.LastEvent).Round(time.Second).String() + " ago"
+			}
+			details = append(details, fmt.Sprintf("%s: %s, watching for %s", watch.Resource, lastEvent, time.Since(watch.Started).Round(time.Second)))
+			if !watch.Healthy(now) {
+				failed = append(failed, fmt.Sprintf("%s: %s", watch.Resource, watch.LastError))
+			}
+		}
+		detail := strings.Join(details, "; ")
+		if len(failed) > 0 {
+			return detail, fmt.Errorf("watch failing: %s", strings.Join(failed, "; "))
+		}
+		return detail, nil
+	})
+
+	// Missing metrics only affect resource visualization, so they don't make the backend unready
+	checker.Add("metrics", false, func(context.Context) (string, error) {
+		status := metricsFetcher.Status()
+		detail := "no fetch yet"
+		if !status.LastSuccess.IsZero() {
+			detail = "last successful fetch " + time.Since(status.LastSuccess).Round(time.Second).String() + " ago"
+		}
+		if !status.Healthy(time.Now()) {
+			if status.LastErrorAt.After(status.LastSuccess) {
+				return detail, errors.New(status.LastError)
+			}
+			return detail, fmt.Errorf("no successful fetch in %s", 3*status.Interval)
+		}
+		return detail, nil
+	})
+
+	checker.Add("websocket-hub", true, func(ctx context.Context) (string, error) {
+		if err := hub.Ping(ctx); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d clients", hub.Stats().Clients), nil
+	})
+
+	return checker
 }
 
-func enableCORS(next http.Handler) http.Handler {
+// statusHandler reports the backend's connection state
+func statusHandler(monitor *k8s.StatusMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(monitor.Current())
+	}
+}
+
+// reloadHandler reloads the configuration on request
+func reloadHandler(reloader *config.Reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		source := "request"
+		if identity, ok := tlsserver.Identity(r.Context()); ok {
+			source = "request from " + identity
+		}
+		report, err := reloader.Reload()
+		config.LogReload(source, report, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func enableCORS(reloader *config.Reloader, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		origin := r.Header.Get("Origin")
+		if origin != "" && reloader.Current().Server.AllowsOrigin(origin, r.Host) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		}
+		w.Header().Add("Vary", "Origin")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -132,9 +463,37 @@ func enableCORS(next http.Handler) http.Handler {
 	})
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// adminOnly guards a route that changes the backend. Browsers on other origins
+// are refused, since CORS doesn't stop a simple POST from taking effect. With
+// mTLS the client needs a certificate, whose identity Identify has already
+// checked against the allowed clients; without it only loopback clients are served.
+func adminOnly(tlsConfig config.TLS, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && !config.SameOrigin(origin, r.Host) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+
+		if tlsConfig.ClientCAFile != "" {
+			if _, ok := tlsserver.Identity(r.Context()); !ok {
+				http.Error(w, "Client certificate required", http.StatusUnauthorized)
+				return
+			}
+		} else if !isLoopback(r.RemoteAddr) {
+			http.Error(w, "Admin endpoints are only served to local clients unless mTLS is enabled", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopback reports whether a request's remote address is on this machine
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
 	}
-	return defaultValue
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
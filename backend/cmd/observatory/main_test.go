@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+	"github.com/craigderington/lantern/internal/tlsserver"
+)
+
+// writeCA writes a CA certificate to a temporary file and returns its path
+func writeCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAdminOnly(t *testing.T) {
+	withoutMTLS := config.TLS{}
+	withMTLS := config.TLS{SelfSigned: true, ClientCAFile: writeCA(t), ClientIdentity: "commonName"}
+	withCertificate := func(r *http.Request) *http.Request {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		tls        config.TLS
+		remoteAddr string
+		origin     string
+		prepare    func(r *http.Request) *http.Request
+		want       int
+	}{
+		{name: "loopback", tls: withoutMTLS, remoteAddr: "127.0.0.1:50000", want: http.StatusOK},
+		{name: "loopback IPv6", tls: withoutMTLS, remoteAddr: "[::1]:50000", want: http.StatusOK},
+		{name: "same origin", tls: withoutMTLS, remoteAddr: "127.0.0.1:50000", origin: "http://localhost:8000", want: http.StatusOK},
+		{name: "remote without mTLS", tls: withoutMTLS, remoteAddr: "10.0.0.7:50000", want: http.StatusForbidden},
+		{name: "cross origin from loopback", tls: withoutMTLS, remoteAddr: "127.0.0.1:50000", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "no certificate", tls: withMTLS, remoteAddr: "10.0.0.7:50000", want: http.StatusUnauthorized},
+		{name: "no certificate from loopback", tls: withMTLS, remoteAddr: "127.0.0.1:50000", want: http.StatusUnauthorized},
+		{name: "certificate", tls: withMTLS, remoteAddr: "10.0.0.7:50000", prepare: withCertificate, want: http.StatusOK},
+		{name: "certificate cross origin", tls: withMTLS, remoteAddr: "10.0.0.7:50000", origin: "https://evil.example", prepare: withCertificate, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served bool
+			handler := adminOnly(tt.tls, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+			if tt.prepare != nil {
+				// Identify puts the certificate's identity in the request context
+				manager, err := tlsserver.New(tt.tls)
+				if err != nil {
+					t.Fatal(err)
+				}
+				handler = manager.Identify(handler)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost:8000/api/v1/admin/reload", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.prepare != nil {
+				r = tt.prepare(r)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r.WithContext(context.Background()))
+
+			if w.Code != tt.want || served != (tt.want == http.StatusOK) {
+				t.Errorf("status %d, served %v; want %d", w.Code, served, tt.want)
+			}
+		})
+	}
+}
@@ -4,18 +4,36 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/craigderington/lantern/internal/config"
 	"github.com/craigderington/lantern/internal/k8s"
 )
 
 type Handler struct {
-	k8sClient *k8s.Client
+	k8sClient  *k8s.Client
+	aggregator *k8s.Aggregator
+	metrics    *k8s.MetricsFetcher
+
+	// logTailLines is the number of lines returned by GetPodLogs
+	logTailLines atomic.Int64
 }
 
-func NewHandler(client *k8s.Client) *Handler {
-	return &Handler{
-		k8sClient: client,
+func NewHandler(client *k8s.Client, aggregator *k8s.Aggregator, metrics *k8s.MetricsFetcher, cfg *config.Config) *Handler {
+	h := &Handler{
+		k8sClient:  client,
+		aggregator: aggregator,
+		metrics:    metrics,
 	}
+	h.logTailLines.Store(cfg.API.LogTailLines)
+	return h
+}
+
+// Reconfigure prepares the handler for a reloaded configuration
+func (h *Handler) Reconfigure(cfg *config.Config) (func(), error) {
+	return func() {
+		h.logTailLines.Store(cfg.API.LogTailLines)
+	}, nil
 }
 
 // GetNodes handles GET /api/nodes
@@ -138,10 +156,7 @@ func (h *Handler) GetPodLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default to 100 lines
-	tailLines := int64(100)
-
-	logs, err := h.k8sClient.GetPodLogs(namespace, name, container, tailLines)
+	logs, err := h.k8sClient.GetPodLogs(namespace, name, container, h.logTailLines.Load())
 	if err != nil {
 		log.Printf("Error getting logs for pod %s/%s: %v", namespace, name, err)
 		http.Error(w, "Failed to get pod logs", http.StatusInternalServerError)
@@ -169,10 +184,9 @@ func (h *Handler) GetPodMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metrics, err := h.k8sClient.GetPodMetrics(namespace, name)
-	if err != nil {
-		log.Printf("Error getting metrics for pod %s/%s: %v", namespace, name, err)
-		http.Error(w, "Failed to get pod metrics", http.StatusInternalServerError)
+	metrics, ok := h.metrics.PodMetrics(namespace, name)
+	if !ok {
+		http.Error(w, "No metrics for pod", http.StatusNotFound)
 		return
 	}
 
@@ -199,10 +213,9 @@ func (h *Handler) GetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metrics, err := h.k8sClient.GetNodeMetrics(name)
-	if err != nil {
-		log.Printf("Error getting metrics for node %s: %v", name, err)
-		http.Error(w, "Failed to get node metrics", http.StatusInternalServerError)
+	metrics, ok := h.metrics.NodeMetrics(name)
+	if !ok {
+		http.Error(w, "No metrics for node", http.StatusNotFound)
 		return
 	}
 
@@ -215,3 +228,60 @@ func (h *Handler) GetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Served metrics for node: %s", name)
 }
+
+// GetClusters handles GET /api/clusters
+func (h *Handler) GetClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy == "" {
+		groupBy = k8s.GroupByNamespace
+	}
+	if !k8s.ValidGroupBy(groupBy) {
+		http.Error(w, "groupBy must be namespace or workload", http.StatusBadRequest)
+		return
+	}
+
+	clusters := h.aggregator.Clusters(groupBy)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(clusters); err != nil {
+		log.Printf("Error encoding clusters response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Served %d clusters grouped by %s", len(clusters.Clusters), groupBy)
+}
+
+// GetClusterPods handles GET /api/clusters/pods
+func (h *Handler) GetClusterPods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("groupBy")
+	group := r.URL.Query().Get("group")
+	if groupBy == "" {
+		groupBy = k8s.GroupByNamespace
+	}
+	if !k8s.ValidGroupBy(groupBy) || group == "" {
+		http.Error(w, "group query parameter and a groupBy of namespace or workload required", http.StatusBadRequest)
+		return
+	}
+
+	pods := h.aggregator.GroupPods(groupBy, group)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pods); err != nil {
+		log.Printf("Error encoding cluster pods response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Served %d pods for cluster %s", len(pods.Pods), group)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema (or OpenAPI schema object)
+type Schema map[string]interface{}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaGenerator builds JSON Schemas from Go types by reflection, following
+// the encoding/json rules. Named structs become shared definitions referenced
+// with $ref.
+type schemaGenerator struct {
+	refPrefix string // e.g. "#/$defs/" or "#/components/schemas/"
+	defs      map[string]Schema
+	names     map[reflect.Type]string
+}
+
+func newSchemaGenerator(refPrefix string) *schemaGenerator {
+	return &schemaGenerator{
+		refPrefix: refPrefix,
+		defs:      make(map[string]Schema),
+		names:     make(map[reflect.Type]string),
+	}
+}
+
+// schemaFor returns the schema of the type of v
+func (g *schemaGenerator) schemaFor(v interface{}) Schema {
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+// schemaOf returns the schema of a type, defining named structs along the way
+func (g *schemaGenerator) schemaOf(t reflect.Type) Schema {
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaOf(t.Elem())
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return Schema{"$ref": g.refPrefix + g.define(t)}
+	}
+
+	// Interfaces and anything else can hold any value
+	return Schema{}
+}
+
+// define adds a named struct to the definitions and returns its name
+func (g *schemaGenerator) define(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := g.defs[name]; taken {
+		// Same name in another package
+		name = pkgName(t) + name
+	}
+
+	// Register before generating so recursive types terminate
+	g.names[t] = name
+	g.defs[name] = Schema{}
+	g.defs[name] = g.structSchema(t)
+	return name
+}
+
+// structSchema describes a struct's JSON object. Fields without omitempty or omitzero are required.
+func (g *schemaGenerator) structSchema(t reflect.Type) Schema {
+	properties := Schema{}
+	required := []string{}
+	g.addFields(t, properties, &required)
+
+	schema := Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the encoded fields of a struct, flattening embedded structs like encoding/json
+func (g *schemaGenerator) addFields(t reflect.Type, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := g.schemaOf(field.Type)
+		omitempty := strings.Contains(options, "omitempty") || strings.Contains(options, "omitzero")
+		if !omitempty && nullable(field.Type) {
+			schema = Schema{"anyOf": []Schema{schema, {"type": "null"}}}
+		}
+		properties[name] = schema
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// nullable reports whether encoding/json may encode a value of the type as null
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map:
+		return true
+	case reflect.Slice:
+		return t != rawMessageType
+	}
+	return false
+}
+
+// pkgName returns the last element of a type's package path, capitalized
+func pkgName(t reflect.Type) string {
+	path := t.PkgPath()
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	if path == "" {
+		return ""
+	}
+	return strings.ToUpper(path[:1]) + path[1:]
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/craigderington/lantern/internal/k8s"
+	"github.com/craigderington/lantern/internal/websocket"
+)
+
+// BasePath is the prefix of the current version of the REST API
+const BasePath = "/api/v1"
+
+// LegacyBasePath is the unversioned prefix kept for existing clients
+const LegacyBasePath = "/api"
+
+// Param is a query parameter of a REST endpoint
+type Param struct {
+	Name     string
+	Required bool
+	Enum     []string
+}
+
+// ErrorResponse is a response of a route other than 200 OK and the errors
+// every route may return
+type ErrorResponse struct {
+	Description string
+	// Zero value of the JSON body; nil for a text/plain message
+	Body interface{}
+}
+
+// Route is an endpoint of the REST API, used both to register it and to
+// describe it in the OpenAPI document
+type Route struct {
+	Path    string // relative to BasePath, e.g. "/pods"
+	Method  string // defaults to GET
+	Summary string
+	Params  []Param
+	// Zero value of the JSON response type; nil for text/plain responses
+	Response interface{}
+	// Errors are the route's own error responses, by status code
+	Errors map[int]ErrorResponse
+	// Overrides the response content type, e.g. for event streams
+	ContentType string
+	// Admin routes change the backend's state. They are not served to other
+	// origins and need a client certificate, or a loopback client without mTLS.
+	Admin   bool
+	Handler http.HandlerFunc
+}
+
+// Routes returns the endpoints served by the handler
+func (h *Handler) Routes() []Route {
+	namespaceAndName := []Param{{Name: "namespace", Required: true}, {Name: "name", Required: true}}
+	groupBy := Param{Name: "groupBy", Enum: []string{k8s.GroupByNamespace, k8s.GroupByWorkload}}
+
+	return []Route{
+		{Path: "/nodes", Summary: "List nodes with their positions", Response: []k8s.Node{}, Handler: h.GetNodes},
+		{Path: "/pods", Summary: "List pods with their positions", Response: []k8s.Pod{}, Handler: h.GetPods},
+		{Path: "/pods/describe", Summary: "Describe a pod like kubectl describe", Params: namespaceAndName, Handler: h.DescribePod},
+		{Path: "/nodes/describe", Summary: "Describe a node like kubectl describe", Params: []Param{{Name: "name", Required: true}}, Handler: h.DescribeNode},
+		{Path: "/pods/logs", Summary: "Last log lines of a pod container, api.logTailLines of them", Params: append(namespaceAndName, Param{Name: "container"}), Handler: h.GetPodLogs},
+		{Path: "/pods/metrics", Summary: "CPU, memory, network and disk usage of a pod from the latest metrics fetch", Params: namespaceAndName, Response: k8s.PodMetrics{},
+			Errors: map[int]ErrorResponse{http.StatusNotFound: {Description: "The latest metrics fetch has no usage for the pod"}}, Handler: h.GetPodMetrics},
+		{Path: "/nodes/metrics", Summary: "CPU, memory, network and disk usage of a node from the latest metrics fetch", Params: []Param{{Name: "name", Required: true}}, Response: k8s.NodeMetrics{},
+			Errors: map[int]ErrorResponse{http.StatusNotFound: {Description: "The latest metrics fetch has no usage for the node"}}, Handler: h.GetNodeMetrics},
+		{Path: "/clusters", Summary: "Pods aggregated into clusters", Params: []Param{groupBy}, Response: k8s.ClustersUpdate{}, Handler: h.GetClusters},
+		{Path: "/clusters/pods", Summary: "Pods of one cluster", Params: []Param{groupBy, {Name: "group", Required: true}}, Response: k8s.GroupPods{}, Handler: h.GetClusterPods},
+	}
+}
+
+// DocumentationRoutes returns the endpoints serving the OpenAPI document for
+// the given routes and the JSON Schemas of the streaming protocol
+func DocumentationRoutes(routes []Route) []Route {
+	docs := []Route{
+		{Path: "/schema/events.json", Summary: "JSON Schema of the events sent to WebSocket clients", Response: Schema{}, Handler: serveDocument(EventSchema())},
+		{Path: "/schema/client-messages.json", Summary: "JSON Schema of the messages WebSocket clients may send", Response: Schema{}, Handler: serveDocument(ClientMessageSchema())},
+	}
+	openapi := Route{Path: "/openapi.json", Summary: "This OpenAPI document", Response: Schema{}}
+	openapi.Handler = serveDocument(OpenAPIDocument(append(append(routes, docs...), openapi)))
+	return append(docs, openapi)
+}
+
+// HTTPMethod returns the route's method
+func (r Route) HTTPMethod() string {
+	if r.Method == "" {
+		return http.MethodGet
+	}
+	return r.Method
+}
+
+// Endpoint formats a route for logging, e.g. "/api/v1/pods/describe?namespace=X&name=Y"
+func (r Route) Endpoint() string {
+	endpoint := BasePath + r.Path
+	for i, param := range r.Params {
+		separator := "&"
+		if i == 0 {
+			separator = "?"
+		}
+		value := "X"
+		if len(param.Enum) > 0 {
+			value = strings.Join(param.Enum, "|")
+		}
+		endpoint += separator + param.Name + "=" + value
+	}
+	return endpoint
+}
+
+// eventPayloads maps every event type sent to clients to the type of its
+// data. The watchers' pod_added, pod_modified, pod_deleted and layout_changed
+// events are server-internal: the event pipeline batches them into pods_changed.
+var eventPayloads = map[string]interface{}{
+	"snapshot":        k8s.Snapshot{},
+	"resumed":         websocket.Resumed{},
+	"pods_changed":    k8s.WatchEvent{},
+	"node_added":      k8s.WatchEvent{},
+	"node_modified":   k8s.WatchEvent{},
+	"node_deleted":    k8s.WatchEvent{},
+	"metrics_update":  k8s.MetricsUpdate{},
+	"clusters_update": k8s.ClustersUpdate{},
+	"group_pods":      k8s.GroupPods{},
+	"backend_status":  k8s.BackendStatus{},
+}
+
+// EventSchema returns the JSON Schema of the events sent to streaming clients.
+// Each event type is a variant of the envelope with its own data schema.
+func EventSchema() Schema {
+	g := newSchemaGenerator("#/$defs/")
+	envelope := g.schemaFor(websocket.Event{})
+
+	eventTypes := make([]string, 0, len(eventPayloads))
+	for eventType := range eventPayloads {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	variants := make([]Schema, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		variants = append(variants, Schema{
+			"allOf": []Schema{envelope},
+			"properties": Schema{
+				"version": Schema{"const": websocket.ProtocolVersion},
+				"type":    Schema{"const": eventType},
+				"data":    g.schemaFor(eventPayloads[eventType]),
+			},
+		})
+	}
+
+	return Schema{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     BasePath + "/schema/events.json",
+		"title":   fmt.Sprintf("Observatory events, protocol version %d", websocket.ProtocolVersion),
+		"oneOf":   variants,
+		"$defs":   g.defs,
+	}
+}
+
+// ClientMessageSchema returns the JSON Schema of the messages clients may send
+func ClientMessageSchema() Schema {
+	g := newSchemaGenerator("#/$defs/")
+	schema := g.schemaFor(websocket.ClientMessage{})
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = BasePath + "/schema/client-messages.json"
+	schema["$defs"] = g.defs
+	return schema
+}
+
+// OpenAPIDocument describes the given routes as an OpenAPI 3.1 document
+func OpenAPIDocument(routes []Route) Schema {
+	g := newSchemaGenerator("#/components/schemas/")
+
+	paths := Schema{}
+	for _, route := range routes {
+		parameters := make([]Schema, 0, len(route.Params))
+		for _, param := range route.Params {
+			schema := Schema{"type": "string"}
+			if len(param.Enum) > 0 {
+				schema["enum"] = param.Enum
+			}
+			parameters = append(parameters, Schema{
+				"name":     param.Name,
+				"in":       "query",
+				"required": param.Required,
+				"schema":   schema,
+			})
+		}
+
+		content := Schema{"text/plain": Schema{"schema": Schema{"type": "string"}}}
+		switch {
+		case route.ContentType != "":
+			content = Schema{route.ContentType: Schema{"schema": Schema{"type": "string"}}}
+		case route.Response != nil:
+			content = Schema{"application/json": Schema{"schema": g.schemaOf(reflect.TypeOf(route.Response))}}
+		}
+
+		responses := Schema{"200": Schema{"description": "OK", "content": content}}
+		if len(parameters) > 0 {
+			responses["400"] = Schema{"description": "Missing or invalid query parameters"}
+		}
+		if route.Admin {
+			responses["401"] = Schema{"description": "No client certificate"}
+			responses["403"] = Schema{"description": "Cross-origin request, or a client that is not allowed to administer the backend"}
+		}
+		responses["405"] = Schema{"description": "Method not allowed"}
+		responses["500"] = Schema{"description": "The cluster could not be queried"}
+		for status, response := range route.Errors {
+			described := Schema{"description": response.Description}
+			if response.Body != nil {
+				described["content"] = Schema{"application/json": Schema{"schema": g.schemaOf(reflect.TypeOf(response.Body))}}
+			}
+			responses[strconv.Itoa(status)] = described
+		}
+
+		paths[BasePath+route.Path] = Schema{
+			strings.ToLower(route.HTTPMethod()): Schema{
+				"summary":    route.Summary,
+				"parameters": parameters,
+				"responses":  responses,
+			},
+		}
+	}
+
+	return Schema{
+		"openapi": "3.1.0",
+		"info": Schema{
+			"title":   "Observatory API",
+			"version": fmt.Sprintf("%d", websocket.ProtocolVersion),
+		},
+		"paths":      paths,
+		"components": Schema{"schemas": g.defs},
+	}
+}
+
+// serveDocument returns a handler serving a static JSON document
+func serveDocument(document interface{}) http.HandlerFunc {
+	encoded, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode API document: %v", err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(encoded)
+	}
+}
@@ -0,0 +1,491 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+	"github.com/craigderington/lantern/internal/k8s"
+	"github.com/craigderington/lantern/internal/websocket"
+	"github.com/craigderington/lantern/pkg/observatory"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func testPod() corev1.Pod {
+	return corev1.Pod{
+		TypeMeta: metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "web-7d4b9c-x2x9z",
+			Namespace:         "default",
+			UID:               "uid-web",
+			Labels:            map[string]string{"app": "web"},
+			Annotations:       map[string]string{"team": "platform"},
+			CreationTimestamp: metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7d4b9c", UID: "uid-rs"}},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node-a",
+			Containers: []corev1.Container{{Name: "app", Image: "web:1.0"}, {Name: "istio-proxy", Image: "istio/proxyv2"}},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			PodIP:      "10.0.0.12",
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "istio-proxy", Ready: true, RestartCount: 1, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+}
+
+func testNode() corev1.Node {
+	return corev1.Node{
+		TypeMeta: metav1.TypeMeta{Kind: "Node", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-a",
+			UID:    "uid-node-a",
+			Labels: map[string]string{"topology.kubernetes.io/zone": "zone-1"},
+		},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+				corev1.ResourcePods:   resource.MustParse("110"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"}},
+			Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.1.10"}},
+		},
+	}
+}
+
+// fakeAPIServer serves the Kubernetes API requests the handlers make
+func fakeAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	pod, node := testPod(), testNode()
+	objects := map[string]interface{}{
+		"/api/v1/pods":         corev1.PodList{TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"}, Items: []corev1.Pod{pod}},
+		"/api/v1/nodes":        corev1.NodeList{TypeMeta: metav1.TypeMeta{Kind: "NodeList", APIVersion: "v1"}, Items: []corev1.Node{node}},
+		"/api/v1/nodes/node-a": node,
+		"/api/v1/namespaces/default/pods/" + pod.Name: pod,
+		"/api/v1/namespaces/default/events":           corev1.EventList{TypeMeta: metav1.TypeMeta{Kind: "EventList", APIVersion: "v1"}, Items: []corev1.Event{{Reason: "Started", Message: "Started container app"}}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/namespaces/default/pods/"+pod.Name+"/log" {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintln(w, "listening on :8080")
+			return
+		}
+		object, ok := objects[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected API request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(object)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fakeMetricsSource reports fixed usage for the test pod and node
+type fakeMetricsSource struct{}
+
+func (fakeMetricsSource) Name() string                        { return "fake" }
+func (fakeMetricsSource) Available(ctx context.Context) error { return nil }
+
+func (fakeMetricsSource) Fetch(ctx context.Context) (*k8s.MetricsSample, error) {
+	now := time.Now()
+	return &k8s.MetricsSample{
+		Pods: []k8s.PodUsage{{
+			Namespace:  "default",
+			Name:       testPod().Name,
+			CPU:        120,
+			Memory:     64,
+			Containers: []k8s.ContainerMetricsData{{Name: "app", CPU: 100, Memory: 48}, {Name: "istio-proxy", CPU: 20, Memory: 16}},
+			Network:    &k8s.NetworkCounters{RxBytes: 1024, TxBytes: 2048},
+			Filesystem: &k8s.FilesystemUsage{UsedBytes: 4096},
+			Volumes:    []k8s.VolumeUsage{{Name: "data", UsedBytes: 8192, CapacityBytes: 1 << 20}},
+			Timestamp:  now,
+		}},
+		Nodes: []k8s.NodeUsage{{Name: "node-a", CPU: 800, Memory: 4096, Filesystem: &k8s.FilesystemUsage{UsedBytes: 1 << 30}, Timestamp: now}},
+	}, nil
+}
+
+// newTestHandler returns a handler backed by the fake API server, with one
+// metrics fetch done and the listed pods aggregated
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg := config.Default()
+	cfg.Metrics.Interval = metav1.Duration{Duration: 10 * time.Millisecond}
+	client, err := k8s.NewClientForConfig(ctx, cfg, &rest.Config{Host: fakeAPIServer(t).URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := k8s.NewMetricsFetcher(client, fakeMetricsSource{}, cfg)
+	select {
+	case <-fetcher.Start(ctx):
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the first metrics fetch")
+	}
+
+	aggregator := k8s.NewAggregator()
+	pods, err := client.GetPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range pods {
+		aggregator.Apply(k8s.WatchEvent{Type: k8s.EventPodAdded, Pod: &pods[i]})
+	}
+
+	return NewHandler(client, aggregator, fetcher, cfg)
+}
+
+// testQuery fills in a route's query parameters for the test pod and node
+func testQuery(route Route) url.Values {
+	query := url.Values{}
+	for _, param := range route.Params {
+		var value string
+		switch {
+		case len(param.Enum) > 0:
+			value = param.Enum[0]
+		case param.Name == "name" && strings.HasPrefix(route.Path, "/nodes"):
+			value = "node-a"
+		case param.Name == "name":
+			value = testPod().Name
+		case param.Name == "namespace", param.Name == "group":
+			value = "default"
+		case param.Name == "container":
+			value = "app"
+		}
+		query.Set(param.Name, value)
+	}
+	return query
+}
+
+// TestRoutesMatchOpenAPIDocument calls every route and checks its response
+// against the OpenAPI document served by the API
+func TestRoutesMatchOpenAPIDocument(t *testing.T) {
+	h := newTestHandler(t)
+	routes := h.Routes()
+	routes = append(routes, DocumentationRoutes(routes)...)
+
+	var document map[string]interface{}
+	for _, route := range routes {
+		if route.Path == "/openapi.json" {
+			recorder := httptest.NewRecorder()
+			route.Handler(recorder, httptest.NewRequest(http.MethodGet, BasePath+route.Path, nil))
+			if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+				t.Fatalf("undecodable OpenAPI document: %v", err)
+			}
+		}
+	}
+	if document == nil {
+		t.Fatal("no route serves the OpenAPI document")
+	}
+	paths := document["paths"].(map[string]interface{})
+
+	for _, route := range routes {
+		t.Run(route.Path, func(t *testing.T) {
+			operation, ok := lookup(paths, BasePath+route.Path, strings.ToLower(route.HTTPMethod())).(map[string]interface{})
+			if !ok {
+				t.Fatalf("route missing from the OpenAPI document")
+			}
+
+			target := BasePath + route.Path
+			if query := testQuery(route).Encode(); query != "" {
+				target += "?" + query
+			}
+			recorder := httptest.NewRecorder()
+			route.Handler(recorder, httptest.NewRequest(route.HTTPMethod(), target, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d: %s", target, recorder.Code, recorder.Body)
+			}
+
+			content, ok := lookup(operation, "responses", "200", "content").(map[string]interface{})
+			if !ok || len(content) != 1 {
+				t.Fatalf("200 response has content %v, want one media type", content)
+			}
+			for mediaType, media := range content {
+				if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, mediaType) {
+					t.Errorf("Content-Type %q, documented as %s", got, mediaType)
+				}
+
+				var body interface{}
+				if mediaType == "application/json" {
+					if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+						t.Fatalf("undecodable response: %v", err)
+					}
+				} else {
+					body = recorder.Body.String()
+				}
+
+				schema := media.(map[string]interface{})["schema"]
+				for _, problem := range validate(document, schema, body, "$") {
+					t.Error(problem)
+				}
+			}
+
+			// Documented errors are what the handler returns
+			recorder = httptest.NewRecorder()
+			route.Handler(recorder, httptest.NewRequest(http.MethodPost, BasePath+route.Path, nil))
+			if lookup(operation, "responses", fmt.Sprint(recorder.Code)) == nil {
+				t.Errorf("POST returned undocumented status %d", recorder.Code)
+			}
+			if len(route.Params) > 0 {
+				recorder = httptest.NewRecorder()
+				route.Handler(recorder, httptest.NewRequest(http.MethodGet, BasePath+route.Path+"?groupBy=none", nil))
+				if lookup(operation, "responses", fmt.Sprint(recorder.Code)) == nil {
+					t.Errorf("bad query returned undocumented status %d", recorder.Code)
+				}
+			}
+			if _, ok := route.Errors[http.StatusNotFound]; ok {
+				query := testQuery(route)
+				query.Set("name", "missing")
+				recorder = httptest.NewRecorder()
+				route.Handler(recorder, httptest.NewRequest(http.MethodGet, BasePath+route.Path+"?"+query.Encode(), nil))
+				if recorder.Code != http.StatusNotFound || lookup(operation, "responses", "404", "description") == nil {
+					t.Errorf("unknown name returned %d, want a documented 404", recorder.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocumentErrorResponses(t *testing.T) {
+	document := OpenAPIDocument([]Route{{
+		Path:     "/ready",
+		Response: struct{ Status string }{},
+		Errors: map[int]ErrorResponse{
+			http.StatusServiceUnavailable: {Description: "Not ready", Body: struct{ Status string }{}},
+			http.StatusNotFound:           {Description: "Not found"},
+		},
+	}})
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	responses := lookup(decoded, "paths", BasePath+"/ready", "get", "responses")
+
+	if lookup(responses, "503", "description") != "Not ready" || lookup(responses, "503", "content", "application/json", "schema") == nil {
+		t.Errorf("503 response %v, want its description and JSON body", lookup(responses, "503"))
+	}
+	if lookup(responses, "404", "description") != "Not found" || lookup(responses, "404", "content") != nil {
+		t.Errorf("404 response %v, want only its description", lookup(responses, "404"))
+	}
+	if lookup(responses, "405") == nil || lookup(responses, "500") == nil {
+		t.Errorf("responses %v lost the common errors", responses)
+	}
+}
+
+// TestEventSchemaListsClientEvents checks the published event schema covers
+// the events sent to clients and none of the pipeline's inputs
+func TestEventSchemaListsClientEvents(t *testing.T) {
+	published := map[string]bool{}
+	for _, variant := range EventSchema()["oneOf"].([]Schema) {
+		eventType := variant["properties"].(Schema)["type"].(Schema)["const"].(string)
+		published[eventType] = true
+	}
+
+	for _, eventType := range []string{"snapshot", "resumed", "pods_changed", "node_added", "metrics_update", "clusters_update", "backend_status"} {
+		if !published[eventType] {
+			t.Errorf("%s missing from the event schema", eventType)
+		}
+	}
+	for _, eventType := range []k8s.EventType{k8s.EventPodAdded, k8s.EventPodModified, k8s.EventPodDeleted, k8s.EventLayoutChanged} {
+		if published[string(eventType)] {
+			t.Errorf("server-internal %s in the event schema", eventType)
+		}
+	}
+}
+
+// TestSDKTypesMatchWireFormat checks the Go client's copies of the wire types
+// encode like the backend's
+func TestSDKTypesMatchWireFormat(t *testing.T) {
+	pairs := []struct {
+		sdk, wire interface{}
+	}{
+		{observatory.Node{}, k8s.Node{}},
+		{observatory.Pod{}, k8s.Pod{}},
+		{observatory.PodMetrics{}, k8s.PodMetrics{}},
+		{observatory.NodeMetrics{}, k8s.NodeMetrics{}},
+		{observatory.ClustersUpdate{}, k8s.ClustersUpdate{}},
+		{observatory.GroupPods{}, k8s.GroupPods{}},
+		{observatory.WatchEvent{}, k8s.WatchEvent{}},
+		{observatory.MetricsUpdate{}, k8s.MetricsUpdate{}},
+		{observatory.Snapshot{}, k8s.Snapshot{}},
+		{observatory.BackendStatus{}, k8s.BackendStatus{}},
+		{observatory.Resumed{}, websocket.Resumed{}},
+		{observatory.HubStats{}, websocket.HubStats{}},
+	}
+
+	for _, pair := range pairs {
+		sdk, wire := newSchemaGenerator("#/"), newSchemaGenerator("#/")
+		if a, b := sdk.schemaFor(pair.sdk), wire.schemaFor(pair.wire); !reflect.DeepEqual(a, b) {
+			t.Errorf("%T is %v, want %v", pair.sdk, a, b)
+		}
+		for name, want := range wire.defs {
+			if got := sdk.defs[name]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%T: observatory.%s is %v, want %v", pair.sdk, name, got, want)
+			}
+		}
+		for name := range sdk.defs {
+			if _, ok := wire.defs[name]; !ok {
+				t.Errorf("%T: observatory.%s is not part of the wire format", pair.sdk, name)
+			}
+		}
+	}
+}
+
+// lookup follows keys through nested JSON objects, returning nil if any is missing
+func lookup(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// validate checks a decoded JSON value against the subset of JSON Schema
+// generated by schemaGenerator, resolving $refs in document. It returns a
+// description of each mismatch.
+func validate(document map[string]interface{}, schema interface{}, value interface{}, path string) []string {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%s: schema %v is not an object", path, schema)}
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		keys := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+		resolved := lookup(document, keys...)
+		if resolved == nil {
+			return []string{fmt.Sprintf("%s: unresolved $ref %s", path, ref)}
+		}
+		return validate(document, resolved, value, path)
+	}
+
+	var problems []string
+	if variants, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, variant := range variants {
+			if len(validate(document, variant, value, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			problems = append(problems, fmt.Sprintf("%s: %v matches none of anyOf", path, value))
+		}
+	}
+	if variants, ok := s["allOf"].([]interface{}); ok {
+		for _, variant := range variants {
+			problems = append(problems, validate(document, variant, value, path)...)
+		}
+	}
+	if want, ok := s["const"]; ok && !reflect.DeepEqual(want, value) {
+		problems = append(problems, fmt.Sprintf("%s: %v, want %v", path, value, want))
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, want := range enum {
+			found = found || reflect.DeepEqual(want, value)
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v not in %v", path, value, enum))
+		}
+	}
+
+	typeName, _ := s["type"].(string)
+	switch typeName {
+	case "":
+		// Any value
+	case "null":
+		if value != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v, want null", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v, want a boolean", path, value))
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v, want a string", path, value))
+		}
+	case "number", "integer":
+		number, ok := value.(float64)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: %v, want a %s", path, value, typeName))
+		case typeName == "integer" && number != math.Trunc(number):
+			problems = append(problems, fmt.Sprintf("%s: %v, want an integer", path, value))
+		}
+		if minimum, ok := s["minimum"].(float64); ok && number < minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v below the minimum %v", path, value, minimum))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v, want an array", path, value))
+			break
+		}
+		for i, item := range items {
+			problems = append(problems, validate(document, s["items"], item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v, want an object", path, value))
+			break
+		}
+		required, _ := s["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %s", path, name))
+			}
+		}
+		properties, _ := s["properties"].(map[string]interface{})
+		for name, field := range object {
+			fieldPath := path + "." + name
+			if property, ok := properties[name]; ok {
+				problems = append(problems, validate(document, property, field, fieldPath)...)
+				continue
+			}
+			switch additional := s["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%s: not in the schema", fieldPath))
+				}
+			case map[string]interface{}:
+				problems = append(problems, validate(document, additional, field, fieldPath)...)
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unsupported schema type %s", path, typeName))
+	}
+	return problems
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the backend's configuration. It is built from the defaults, then
+// an optional YAML file, then environment variables, then command-line flags.
+type Config struct {
+	Server     Server     `json:"server"`
+	Kubernetes Kubernetes `json:"kubernetes"`
+	Metrics    Metrics    `json:"metrics"`
+	Layout     Layout     `json:"layout"`
+	Stream     Stream     `json:"stream"`
+	API        API        `json:"api"`
+}
+
+// Server configures the HTTP listener
+type Server struct {
+	Port int `json:"port"`
+	// Origins allowed to make cross-origin requests and open WebSockets besides
+	// the server's own; "*" allows any. Empty allows same-origin requests only.
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// ShutdownTimeout bounds how long in-flight requests and clients are given to finish on shutdown
+	ShutdownTimeout metav1.Duration `json:"shutdownTimeout"`
+	// BasePath mounts the UI, API and WebSocket under a prefix such as "/observatory"
+	BasePath string `json:"basePath"`
+	// ServeUI serves the frontend embedded in the binary
+	ServeUI bool `json:"serveUI"`
+	// TLS serves HTTPS when a certificate is configured or self-signed
+	TLS TLS `json:"tls"`
+}
+
+// TLS configures HTTPS and client certificate verification
+type TLS struct {
+	// CertFile and KeyFile are reloaded when they change on disk
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// SelfSigned generates a throwaway certificate at startup for quick testing
+	SelfSigned bool `json:"selfSigned"`
+	// SelfSignedHosts are added to the generated certificate besides localhost and the hostname
+	SelfSignedHosts []string `json:"selfSignedHosts,omitempty"`
+	// ClientCAFile enables mTLS: client certificates must be signed by one of its CAs
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+	// ClientAuth is "require" (the default) or "optional" to also accept clients without a certificate
+	ClientAuth string `json:"clientAuth,omitempty"`
+	// ClientIdentity picks the certificate field naming the user: commonName, email, uri or dns
+	ClientIdentity string `json:"clientIdentity"`
+	// AllowedClients restricts access to these identities; empty allows any verified certificate
+	AllowedClients []string `json:"allowedClients,omitempty"`
+}
+
+// Enabled reports whether the server speaks HTTPS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+// Kubernetes configures the connection to the cluster and how objects are reported
+type Kubernetes struct {
+	// Kubeconfig file used outside the cluster; empty means ~/.kube/config
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// SidecarRulesFile holds custom sidecar classification rules
+	SidecarRulesFile string `json:"sidecarRulesFile,omitempty"`
+	// AnnotationMaxBytes trims longer annotation values from pod payloads (0 disables trimming)
+	AnnotationMaxBytes int `json:"annotationMaxBytes"`
+}
+
+// Metrics configures where pod and node resource usage is read from
+type Metrics struct {
+	Interval metav1.Duration `json:"interval"`
+	// Source is metrics-server, kubelet (the Summary API via the API server
+	// proxy), prometheus or auto, which uses metrics-server when it is available
+	Source string `json:"source"`
+	// Prometheus is queried when Source is prometheus
+	Prometheus Prometheus `json:"prometheus"`
+}
+
+// Prometheus configures the Prometheus metrics source
+type Prometheus struct {
+	// URL of the Prometheus HTTP API, e.g. http://prometheus.monitoring:9090.
+	// Credentials in the URL are sent with basic authentication.
+	URL string `json:"url,omitempty"`
+	// BearerTokenFile holds a token sent with every query, re-read when it changes
+	BearerTokenFile string `json:"bearerTokenFile,omitempty"`
+	// Timeout bounds each query
+	Timeout metav1.Duration `json:"timeout"`
+	// Window is the range of rate() in the queries, available to them as {{.Window}}
+	Window  metav1.Duration   `json:"window"`
+	Queries PrometheusQueries `json:"queries"`
+}
+
+// PrometheusQueries are the PromQL templates for each metric. Container and
+// pod queries must return namespace and pod labels (and container for the
+// container queries), node queries a node label. Empty queries are skipped.
+type PrometheusQueries struct {
+	// ContainerCPU returns cores used per container
+	ContainerCPU string `json:"containerCpu"`
+	// ContainerMemory returns working set bytes per container
+	ContainerMemory string `json:"containerMemory"`
+	// PodNetworkReceive and PodNetworkTransmit return cumulative bytes per pod
+	PodNetworkReceive  string `json:"podNetworkReceive"`
+	PodNetworkTransmit string `json:"podNetworkTransmit"`
+	// PodRestarts returns container restarts per pod
+	PodRestarts string `json:"podRestarts"`
+	// PodFilesystem returns bytes used on the filesystems of each pod's containers
+	PodFilesystem string `json:"podFilesystem"`
+	// NodeCPU returns cores used per node
+	NodeCPU string `json:"nodeCpu"`
+	// NodeMemory returns working set bytes per node
+	NodeMemory string `json:"nodeMemory"`
+	// NodeNetworkReceive and NodeNetworkTransmit return cumulative bytes per node
+	NodeNetworkReceive  string `json:"nodeNetworkReceive"`
+	NodeNetworkTransmit string `json:"nodeNetworkTransmit"`
+	// NodeFilesystem returns bytes used on each node's filesystems
+	NodeFilesystem string `json:"nodeFilesystem"`
+}
+
+// Layout configures how nodes and pods are arranged in 3D space
+type Layout struct {
+	Strategy string `json:"strategy"`
+	// Distance between neighbouring nodes
+	NodeSpacing float64 `json:"nodeSpacing"`
+	// Radius of the node ring for small clusters
+	MinRingRadius float64 `json:"minRingRadius"`
+	// Radius of a zone's node ring
+	MinZoneRadius float64 `json:"minZoneRadius"`
+	// Radius of the innermost pod orbit
+	PodOrbitRadius float64 `json:"podOrbitRadius"`
+	// Distance between successive pod orbits
+	PodOrbitSpacing float64 `json:"podOrbitSpacing"`
+	// Pods on the innermost orbit; orbit k holds (k+1) times as many
+	PodOrbitCapacity int `json:"podOrbitCapacity"`
+	// Vertical distance between namespace layers
+	LayerHeight float64 `json:"layerHeight"`
+}
+
+// Stream configures event delivery to clients
+type Stream struct {
+	// BatchWindow is how long pod events are collected into one pods_changed message
+	BatchWindow metav1.Duration `json:"batchWindow"`
+	// ClusterInterval is how often galaxy-mode clusters are republished when changed
+	ClusterInterval metav1.Duration `json:"clusterInterval"`
+	// BufferSize is the capacity of the internal event channels
+	BufferSize int `json:"bufferSize"`
+	// ReplayBufferSize is the number of broadcasts kept for resuming clients
+	ReplayBufferSize int `json:"replayBufferSize"`
+	// ClientQueueSize is the number of messages queued for a client before it is resynced
+	ClientQueueSize int `json:"clientQueueSize"`
+}
+
+// API configures the REST handlers
+type API struct {
+	// LogTailLines is the number of log lines returned by the pod logs endpoint
+	LogTailLines int64 `json:"logTailLines"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8000,
+			AllowedOrigins:  []string{},
+			ShutdownTimeout: metav1.Duration{Duration: 10 * time.Second},
+			ServeUI:         true,
+			TLS: TLS{
+				ClientIdentity: "commonName",
+			},
+		},
+		Metrics: Metrics{
+			Interval: metav1.Duration{Duration: 5 * time.Second},
+			Source:   "auto",
+			Prometheus: Prometheus{
+				Timeout: metav1.Duration{Duration: 5 * time.Second},
+				Window:  metav1.Duration{Duration: 2 * time.Minute},
+				// cAdvisor and kube-state-metrics series as scraped by kube-prometheus-stack
+				Queries: PrometheusQueries{
+					ContainerCPU:        `sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!="", container!="POD"}[{{.Window}}]))`,
+					ContainerMemory:     `sum by (namespace, pod, container) (container_memory_working_set_bytes{container!="", container!="POD"})`,
+					PodNetworkReceive:   `sum by (namespace, pod) (container_network_receive_bytes_total)`,
+					PodNetworkTransmit:  `sum by (namespace, pod) (container_network_transmit_bytes_total)`,
+					PodRestarts:         `sum by (namespace, pod) (kube_pod_container_status_restarts_total)`,
+					PodFilesystem:       `sum by (namespace, pod) (container_fs_usage_bytes{container!="", container!="POD"})`,
+					NodeCPU:             `sum by (node) (rate(container_cpu_usage_seconds_total{id="/"}[{{.Window}}]))`,
+					NodeMemory:          `sum by (node) (container_memory_working_set_bytes{id="/"})`,
+					NodeNetworkReceive:  `sum by (node) (container_network_receive_bytes_total{id="/"})`,
+					NodeNetworkTransmit: `sum by (node) (container_network_transmit_bytes_total{id="/"})`,
+					NodeFilesystem:      `sum by (node) (container_fs_usage_bytes{id="/"})`,
+				},
+			},
+		},
+		Layout: Layout{
+			Strategy:         "ring",
+			NodeSpacing:      12.0,
+			MinRingRadius:    10.0,
+			MinZoneRadius:    6.0,
+			PodOrbitRadius:   3.0,
+			PodOrbitSpacing:  1.5,
+			PodOrbitCapacity: 8,
+			LayerHeight:      1.5,
+		},
+		Stream: Stream{
+			BatchWindow:      metav1.Duration{Duration: 250 * time.Millisecond},
+			ClusterInterval:  metav1.Duration{Duration: 2 * time.Second},
+			BufferSize:       256,
+			ReplayBufferSize: 1024,
+			ClientQueueSize:  2048,
+		},
+		API: API{
+			LogTailLines: 100,
+		},
+	}
+}
+
+// LoadFile applies the settings in a YAML file on top of c. Settings missing
+// from the file keep their current values; unknown settings are an error.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every setting that is out of range
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port %d: must be between 1 and 65535", c.Server.Port)
+	for _, origin := range c.Server.AllowedOrigins {
+		check(origin != "", "server.allowedOrigins: must not contain empty origins")
+	}
+	check(c.Server.ShutdownTimeout.Duration > 0, "server.shutdownTimeout %s: must be positive", c.Server.ShutdownTimeout.Duration)
+	check(c.Server.BasePath == "" || (strings.HasPrefix(c.Server.BasePath, "/") && !strings.HasSuffix(c.Server.BasePath, "/")),
+		"server.basePath %q: must be empty or start and not end with /", c.Server.BasePath)
+	tls := c.Server.TLS
+	check((tls.CertFile == "") == (tls.KeyFile == ""), "server.tls: certFile and keyFile must be set together")
+	check(!tls.SelfSigned || tls.CertFile == "", "server.tls: selfSigned and certFile are mutually exclusive")
+	check(tls.ClientCAFile == "" || tls.Enabled(), "server.tls.clientCAFile: requires certFile or selfSigned")
+	check(tls.ClientAuth == "" || tls.ClientAuth == "require" || tls.ClientAuth == "optional",
+		"server.tls.clientAuth %q: must be require or optional", tls.ClientAuth)
+	switch tls.ClientIdentity {
+	case "commonName", "email", "uri", "dns":
+	default:
+		errs = append(errs, fmt.Errorf("server.tls.clientIdentity %q: must be commonName, email, uri or dns", tls.ClientIdentity))
+	}
+	check(len(tls.AllowedClients) == 0 || tls.ClientCAFile != "", "server.tls.allowedClients: requires clientCAFile")
+
+	check(c.Kubernetes.AnnotationMaxBytes >= 0, "kubernetes.annotationMaxBytes %d: must be non-negative", c.Kubernetes.AnnotationMaxBytes)
+	check(c.Metrics.Interval.Duration > 0, "metrics.interval %s: must be positive", c.Metrics.Interval.Duration)
+	switch c.Metrics.Source {
+	case "auto", "metrics-server", "kubelet":
+	case "prometheus":
+		prom := c.Metrics.Prometheus
+		u, err := url.Parse(prom.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"metrics.prometheus.url %q: must be an http or https URL", prom.URL)
+		check(prom.Timeout.Duration > 0, "metrics.prometheus.timeout %s: must be positive", prom.Timeout.Duration)
+		check(prom.Window.Duration >= time.Second, "metrics.prometheus.window %s: must be at least 1s", prom.Window.Duration)
+	default:
+		errs = append(errs, fmt.Errorf("metrics.source %q: must be auto, metrics-server, kubelet or prometheus", c.Metrics.Source))
+	}
+
+	// The strategy itself is checked by the layout when the client is created
+	check(c.Layout.NodeSpacing > 0, "layout.nodeSpacing %g: must be positive", c.Layout.NodeSpacing)
+	check(c.Layout.MinRingRadius > 0, "layout.minRingRadius %g: must be positive", c.Layout.MinRingRadius)
+	check(c.Layout.MinZoneRadius > 0, "layout.minZoneRadius %g: must be positive", c.Layout.MinZoneRadius)
+	check(c.Layout.PodOrbitRadius > 0, "layout.podOrbitRadius %g: must be positive", c.Layout.PodOrbitRadius)
+	check(c.Layout.PodOrbitSpacing > 0, "layout.podOrbitSpacing %g: must be positive", c.Layout.PodOrbitSpacing)
+	check(c.Layout.LayerHeight >= 0, "layout.layerHeight %g: must be non-negative", c.Layout.LayerHeight)
+	check(c.Layout.PodOrbitCapacity > 0, "layout.podOrbitCapacity %d: must be positive", c.Layout.PodOrbitCapacity)
+
+	check(c.Stream.BatchWindow.Duration > 0, "stream.batchWindow %s: must be positive", c.Stream.BatchWindow.Duration)
+	check(c.Stream.ClusterInterval.Duration > 0, "stream.clusterInterval %s: must be positive", c.Stream.ClusterInterval.Duration)
+	check(c.Stream.BufferSize > 0, "stream.bufferSize %d: must be positive", c.Stream.BufferSize)
+	check(c.Stream.ReplayBufferSize > 0, "stream.replayBufferSize %d: must be positive", c.Stream.ReplayBufferSize)
+	// A resuming client's replay has to fit in its queue
+	check(c.Stream.ClientQueueSize >= c.Stream.ReplayBufferSize, "stream.clientQueueSize %d: must be at least stream.replayBufferSize", c.Stream.ClientQueueSize)
+
+	check(c.API.LogTailLines > 0, "api.logTailLines %d: must be positive", c.API.LogTailLines)
+
+	return errors.Join(errs...)
+}
+
+// YAML renders the configuration as a config file
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// AllowsOrigin reports whether a browser on origin may call the API served at
+// host. Requests without an Origin header are not from a browser and, like
+// same-origin requests, always allowed.
+func (s Server) AllowsOrigin(origin, host string) bool {
+	if origin == "" || SameOrigin(origin, host) {
+		return true
+	}
+	for _, allowed := range s.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// SameOrigin reports whether origin names the host a request was sent to
+func SameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("default configuration is invalid: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"port zero", func(c *Config) { c.Server.Port = 0 }, "server.port 0"},
+		{"port too high", func(c *Config) { c.Server.Port = 70000 }, "server.port 70000"},
+		{"empty origin", func(c *Config) { c.Server.AllowedOrigins = []string{""} }, "server.allowedOrigins"},
+		{"shutdown timeout", func(c *Config) { c.Server.ShutdownTimeout.Duration = 0 }, "server.shutdownTimeout"},
+		{"base path without slash", func(c *Config) { c.Server.BasePath = "observatory" }, "server.basePath"},
+		{"base path with trailing slash", func(c *Config) { c.Server.BasePath = "/observatory/" }, "server.basePath"},
+		{"cert without key", func(c *Config) { c.Server.TLS.CertFile = "tls.crt" }, "certFile and keyFile"},
+		{"self-signed and cert", func(c *Config) {
+			c.Server.TLS.CertFile, c.Server.TLS.KeyFile, c.Server.TLS.SelfSigned = "tls.crt", "tls.key", true
+		}, "mutually exclusive"},
+		{"client CA without TLS", func(c *Config) { c.Server.TLS.ClientCAFile = "ca.crt" }, "server.tls.clientCAFile"},
+		{"client auth", func(c *Config) { c.Server.TLS.ClientAuth = "maybe" }, "server.tls.clientAuth"},
+		{"client identity", func(c *Config) { c.Server.TLS.ClientIdentity = "serial" }, "server.tls.clientIdentity"},
+		{"allowed clients without CA", func(c *Config) { c.Server.TLS.AllowedClients = []string{"ops"} }, "server.tls.allowedClients"},
+		{"annotation limit", func(c *Config) { c.Kubernetes.AnnotationMaxBytes = -1 }, "kubernetes.annotationMaxBytes"},
+		{"metrics interval", func(c *Config) { c.Metrics.Interval.Duration = 0 }, "metrics.interval"},
+		{"metrics source", func(c *Config) { c.Metrics.Source = "heapster" }, "metrics.source"},
+		{"prometheus URL", func(c *Config) {
+			c.Metrics.Source, c.Metrics.Prometheus.URL = "prometheus", "prometheus:9090"
+		}, "metrics.prometheus.url"},
+		{"prometheus timeout", func(c *Config) {
+			c.Metrics.Source, c.Metrics.Prometheus.URL = "prometheus", "http://prometheus:9090"
+			c.Metrics.Prometheus.Timeout.Duration = 0
+		}, "metrics.prometheus.timeout"},
+		{"prometheus window", func(c *Config) {
+			c.Metrics.Source, c.Metrics.Prometheus.URL = "prometheus", "http://prometheus:9090"
+			c.Metrics.Prometheus.Window.Duration = time.Millisecond
+		}, "metrics.prometheus.window"},
+		{"node spacing", func(c *Config) { c.Layout.NodeSpacing = 0 }, "layout.nodeSpacing"},
+		{"ring radius", func(c *Config) { c.Layout.MinRingRadius = -1 }, "layout.minRingRadius"},
+		{"zone radius", func(c *Config) { c.Layout.MinZoneRadius = 0 }, "layout.minZoneRadius"},
+		{"orbit radius", func(c *Config) { c.Layout.PodOrbitRadius = 0 }, "layout.podOrbitRadius"},
+		{"orbit spacing", func(c *Config) { c.Layout.PodOrbitSpacing = 0 }, "layout.podOrbitSpacing"},
+		{"layer height", func(c *Config) { c.Layout.LayerHeight = -1 }, "layout.layerHeight"},
+		{"orbit capacity", func(c *Config) { c.Layout.PodOrbitCapacity = 0 }, "layout.podOrbitCapacity"},
+		{"batch window", func(c *Config) { c.Stream.BatchWindow.Duration = 0 }, "stream.batchWindow"},
+		{"cluster interval", func(c *Config) { c.Stream.ClusterInterval.Duration = 0 }, "stream.clusterInterval"},
+		{"buffer size", func(c *Config) { c.Stream.BufferSize = 0 }, "stream.bufferSize"},
+		{"replay buffer size", func(c *Config) { c.Stream.ReplayBufferSize = 0 }, "stream.replayBufferSize"},
+		{"client queue smaller than replay", func(c *Config) { c.Stream.ClientQueueSize = c.Stream.ReplayBufferSize - 1 }, "stream.clientQueueSize"},
+		{"log tail lines", func(c *Config) { c.API.LogTailLines = 0 }, "api.logTailLines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported, not just the first
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.API.LogTailLines = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "server.port") || !strings.Contains(err.Error(), "api.logTailLines") {
+		t.Errorf("Validate() = %v, want both errors", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	cfg := Default()
+	err := cfg.LoadFile(writeFile(t, "config.yaml", `
+server:
+  port: 9000
+metrics:
+  interval: 15s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Metrics.Interval.Duration != 15*time.Second {
+		t.Errorf("port %d, interval %s; want 9000 and 15s", cfg.Server.Port, cfg.Metrics.Interval.Duration)
+	}
+	// Settings missing from the file keep their values
+	if cfg.Layout.Strategy != "ring" || cfg.Server.ShutdownTimeout.Duration != 10*time.Second {
+		t.Errorf("defaults lost: strategy %q, shutdown timeout %s", cfg.Layout.Strategy, cfg.Server.ShutdownTimeout.Duration)
+	}
+
+	for name, content := range map[string]string{
+		"unknown key":        "server:\n  prot: 9000\n",
+		"unknown section":    "servers:\n  port: 9000\n",
+		"wrong type":         "server:\n  port: many\n",
+		"malformed duration": "metrics:\n  interval: soon\n",
+	} {
+		if err := Default().LoadFile(writeFile(t, "config.yaml", content)); err == nil {
+			t.Errorf("%s: config file accepted", name)
+		}
+	}
+
+	if err := Default().LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing config file accepted")
+	}
+}
+
+func TestYAMLLoadsBack(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 9000
+	cfg.Server.AllowedOrigins = []string{"https://ops.example.com"}
+	cfg.Metrics.Source = "kubelet"
+	out, err := cfg.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := Default()
+	if err := loaded.LoadFile(writeFile(t, "config.yaml", string(out))); err != nil {
+		t.Fatalf("printed configuration does not load: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("loaded %+v, want %+v", loaded, cfg)
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{nil, "", true},
+		{nil, "http://localhost:8000", true},
+		{nil, "http://LOCALHOST:8000", true},
+		{nil, "http://localhost:3000", false},
+		{nil, "https://evil.example", false},
+		{[]string{"http://localhost:3000"}, "http://localhost:3000", true},
+		{[]string{"*"}, "https://evil.example", true},
+	}
+	for _, tt := range tests {
+		server := Server{AllowedOrigins: tt.allowed}
+		if got := server.AllowsOrigin(tt.origin, "localhost:8000"); got != tt.want {
+			t.Errorf("AllowsOrigin(%q) with %v = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options are command-line settings that aren't part of the configuration itself
+type Options struct {
+	// ConfigFile is the YAML file the configuration was loaded from, if any
+	ConfigFile string
+	// PrintConfig dumps the effective configuration and exits
+	PrintConfig bool
+}
+
+// setting is a configuration value that can be overridden by an environment
+// variable and a command-line flag
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"port", "PORT", "HTTP listen port", func(c *Config, v string) error {
+		return parseInt(v, &c.Server.Port)
+	}},
+	{"cors-origins", "CORS_ALLOWED_ORIGINS", "comma-separated origins besides its own allowed to call the API, or *", func(c *Config, v string) error {
+		c.Server.AllowedOrigins = splitList(v)
+		return nil
+	}},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "how long requests and clients are given to finish on shutdown", func(c *Config, v string) error {
+		return parseDuration(v, &c.Server.ShutdownTimeout.Duration)
+	}},
+	{"base-path", "BASE_PATH", "serve everything under this path prefix, e.g. /observatory", func(c *Config, v string) error {
+		c.Server.BasePath = v
+		return nil
+	}},
+	{"serve-ui", "SERVE_UI", "serve the embedded frontend: true or false", func(c *Config, v string) error {
+		return parseBool(v, &c.Server.ServeUI)
+	}},
+	{"tls-cert", "TLS_CERT_FILE", "serve HTTPS with this certificate file", func(c *Config, v string) error {
+		c.Server.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key", "TLS_KEY_FILE", "private key file for --tls-cert", func(c *Config, v string) error {
+		c.Server.TLS.KeyFile = v
+		return nil
+	}},
+	{"tls-self-signed", "TLS_SELF_SIGNED", "serve HTTPS with a generated certificate: true or false", func(c *Config, v string) error {
+		return parseBool(v, &c.Server.TLS.SelfSigned)
+	}},
+	{"tls-client-ca", "TLS_CLIENT_CA_FILE", "require client certificates signed by these CAs (mTLS)", func(c *Config, v string) error {
+		c.Server.TLS.ClientCAFile = v
+		return nil
+	}},
+	{"kubeconfig", "KUBECONFIG", "kubeconfig file used outside the cluster", func(c *Config, v string) error {
+		c.Kubernetes.Kubeconfig = v
+		return nil
+	}},
+	{"sidecar-rules", "SIDECAR_RULES_FILE", "YAML file of sidecar classification rules", func(c *Config, v string) error {
+		c.Kubernetes.SidecarRulesFile = v
+		return nil
+	}},
+	{"annotation-max-bytes", "ANNOTATION_MAX_BYTES", "trim pod annotation values longer than this (0 disables)", func(c *Config, v string) error {
+		return parseInt(v, &c.Kubernetes.AnnotationMaxBytes)
+	}},
+	{"metrics-interval", "METRICS_INTERVAL", "how often pod and node metrics are fetched", func(c *Config, v string) error {
+		return parseDuration(v, &c.Metrics.Interval.Duration)
+	}},
+	{"metrics-source", "METRICS_SOURCE", "where resource usage is read from: auto, metrics-server, kubelet or prometheus", func(c *Config, v string) error {
+		c.Metrics.Source = v
+		return nil
+	}},
+	{"prometheus-url", "PROMETHEUS_URL", "Prometheus HTTP API queried by the prometheus metrics source", func(c *Config, v string) error {
+		c.Metrics.Prometheus.URL = v
+		return nil
+	}},
+	{"layout", "LAYOUT_STRATEGY", "node layout: ring, grid, by-namespace or by-zone", func(c *Config, v string) error {
+		c.Layout.Strategy = v
+		return nil
+	}},
+	{"event-batch-window", "EVENT_BATCH_WINDOW", "how long pod events are batched into pods_changed", func(c *Config, v string) error {
+		return parseDuration(v, &c.Stream.BatchWindow.Duration)
+	}},
+	{"log-tail-lines", "LOG_TAIL_LINES", "log lines returned by the pod logs endpoint", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.API.LogTailLines = n
+		return nil
+	}},
+}
+
+// Load builds and validates the configuration for the given command-line
+// arguments. The config file is named by --config or CONFIG_FILE.
+func Load(args []string) (*Config, Options, error) {
+	var opts Options
+	fs := flag.NewFlagSet("observatory", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config", os.Getenv("CONFIG_FILE"), "YAML config file (env CONFIG_FILE)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration as YAML and exit")
+
+	// Flags are applied after the file and environment, whatever their position on the command line
+	type override struct {
+		setting setting
+		value   string
+	}
+	var overrides []override
+	for _, s := range settings {
+		fs.Func(s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env), func(value string) error {
+			overrides = append(overrides, override{s, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+
+	cfg := Default()
+	if opts.ConfigFile != "" {
+		if err := cfg.LoadFile(opts.ConfigFile); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			if err := s.set(cfg, value); err != nil {
+				return nil, opts, fmt.Errorf("invalid %s %q: %w", s.env, value, err)
+			}
+		}
+	}
+	for _, o := range overrides {
+		if err := o.setting.set(cfg, o.value); err != nil {
+			return nil, opts, fmt.Errorf("invalid --%s %q: %w", o.setting.flag, o.value, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, opts, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, opts, nil
+}
+
+func parseInt(value string, dst *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func parseBool(value string, dst *bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+func parseDuration(value string, dst *time.Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping surrounding spaces
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
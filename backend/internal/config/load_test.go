@@ -0,0 +1,93 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+  basePath: /from-file
+metrics:
+  interval: 15s
+layout:
+  strategy: grid
+`)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("PORT", "9100")
+	t.Setenv("METRICS_INTERVAL", "20s")
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example , https://b.example ")
+
+	// Flags win over the environment, wherever they appear
+	cfg, opts, err := Load([]string{"--port", "9200", "--print-config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ConfigFile != file || !opts.PrintConfig {
+		t.Errorf("options %+v, want the config file from CONFIG_FILE and print-config", opts)
+	}
+
+	checks := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"port (flag over env over file)", cfg.Server.Port, 9200},
+		{"metrics interval (env over file)", cfg.Metrics.Interval.Duration, 20 * time.Second},
+		{"base path (file)", cfg.Server.BasePath, "/from-file"},
+		{"layout (file over default)", cfg.Layout.Strategy, "grid"},
+		{"batch window (default)", cfg.Stream.BatchWindow.Duration, 250 * time.Millisecond},
+		{"origins (env list)", strings.Join(cfg.Server.AllowedOrigins, ","), "https://a.example,https://b.example"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "env.yaml", "server:\n  port: 9000\n"))
+	flagFile := writeFile(t, "flag.yaml", "server:\n  port: 9300\n")
+
+	cfg, opts, err := Load([]string{"--config", flagFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ConfigFile != flagFile || cfg.Server.Port != 9300 {
+		t.Errorf("loaded %s with port %d, want %s with 9300", opts.ConfigFile, cfg.Server.Port, flagFile)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "bad env value", env: map[string]string{"METRICS_INTERVAL": "soon"}, want: "invalid METRICS_INTERVAL"},
+		{name: "bad flag value", args: []string{"--serve-ui", "maybe"}, want: "invalid --serve-ui"},
+		{name: "unknown flag", args: []string{"--colour"}, want: "colour"},
+		{name: "invalid result", args: []string{"--port", "0"}, want: "server.port"},
+		{name: "unknown file key", file: "server:\n  prot: 9000\n", want: "prot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", tt.file))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, _, err := Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// liveSettings can change while the backend is running. Changes to any other
+// setting are reported and take effect on the next restart.
+var liveSettings = map[string]bool{
+	"server.allowedOrigins":         true,
+	"kubernetes.sidecarRulesFile":   true,
+	"kubernetes.annotationMaxBytes": true,
+	"metrics.interval":              true,
+	"api.logTailLines":              true,
+}
+
+// withLive returns a copy of c with the live settings taken from next
+func (c *Config) withLive(next *Config) *Config {
+	merged := *c
+	merged.Server.AllowedOrigins = next.Server.AllowedOrigins
+	merged.Kubernetes.SidecarRulesFile = next.Kubernetes.SidecarRulesFile
+	merged.Kubernetes.AnnotationMaxBytes = next.Kubernetes.AnnotationMaxBytes
+	merged.Metrics.Interval = next.Metrics.Interval
+	merged.API.LogTailLines = next.API.LogTailLines
+	return &merged
+}
+
+// ReloadReport lists the settings changed by a reload, by their path in the config file
+type ReloadReport struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+// Applier prepares a component for a new configuration. It returns a func
+// that switches the component over, or an error leaving it untouched.
+// Appliers are called on every reload, so files they read are re-read even
+// when the configuration itself is unchanged.
+type Applier func(cfg *Config) (commit func(), err error)
+
+// Reloader re-reads the configuration and swaps in the settings that can
+// change while running. A reload is all or nothing: if the new configuration
+// is invalid or any component rejects it, everything keeps the old settings.
+type Reloader struct {
+	args     []string
+	file     string
+	current  atomic.Pointer[Config]
+	appliers []Applier
+
+	// Serializes reloads
+	mu sync.Mutex
+}
+
+// NewReloader creates a reloader for the configuration loaded from args
+func NewReloader(args []string, cfg *Config, opts Options) *Reloader {
+	r := &Reloader{args: args, file: opts.ConfigFile}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers a component to be reconfigured on every reload
+func (r *Reloader) OnReload(apply Applier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, apply)
+}
+
+// Reload loads the configuration again from the same file, environment and flags
+func (r *Reloader) Reload() (ReloadReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, _, err := Load(r.args)
+	if err != nil {
+		return ReloadReport{}, err
+	}
+
+	current := r.current.Load()
+	changed, err := changedSettings(current, next)
+	if err != nil {
+		return ReloadReport{}, err
+	}
+	report := ReloadReport{Applied: []string{}, RestartRequired: []string{}}
+	for _, setting := range changed {
+		if liveSettings[setting] {
+			report.Applied = append(report.Applied, setting)
+		} else {
+			report.RestartRequired = append(report.RestartRequired, setting)
+		}
+	}
+
+	merged := current.withLive(next)
+	commits := make([]func(), 0, len(r.appliers))
+	for _, apply := range r.appliers {
+		commit, err := apply(merged)
+		if err != nil {
+			return ReloadReport{}, err
+		}
+		commits = append(commits, commit)
+	}
+	for _, commit := range commits {
+		commit()
+	}
+	r.current.Store(merged)
+
+	return report, nil
+}
+
+// Watch reloads whenever the config file or the sidecar rules file is
+// modified, checking every interval until stop is closed
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	modTimes := r.modTimes()
+	for {
+		select {
+		case <-ticker.C:
+			latest := r.modTimes()
+			if reflect.DeepEqual(latest, modTimes) {
+				continue
+			}
+			modTimes = latest
+
+			report, err := r.Reload()
+			LogReload("file change", report, err)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// modTimes returns the modification time of each watched file
+func (r *Reloader) modTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.file, r.Current().Kubernetes.SidecarRulesFile} {
+		if file == "" {
+			continue
+		}
+		// A missing file reads as the zero time, so its reappearance is noticed
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		} else {
+			modTimes[file] = time.Time{}
+		}
+	}
+	return modTimes
+}
+
+// LogReload logs the outcome of a reload triggered by source
+func LogReload(source string, report ReloadReport, err error) {
+	if err != nil {
+		log.Printf("Configuration reload on %s failed, keeping previous settings: %v", source, err)
+		return
+	}
+	log.Printf("Configuration reloaded on %s", source)
+	if len(report.Applied) > 0 {
+		log.Printf("  Applied: %v", report.Applied)
+	}
+	if len(report.RestartRequired) > 0 {
+		log.Printf("  Changed but require a restart: %v", report.RestartRequired)
+	}
+}
+
+// changedSettings lists the paths of the settings that differ between two configurations
+func changedSettings(a, b *Config) ([]string, error) {
+	flatA, err := flatten(a)
+	if err != nil {
+		return nil, err
+	}
+	flatB, err := flatten(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for key, value := range flatA {
+		if other, ok := flatB[key]; !ok || !reflect.DeepEqual(value, other) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range flatB {
+		if _, ok := flatA[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// flatten maps every setting's dotted path to its JSON value
+func flatten(cfg *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+
+	flat := make(map[string]interface{})
+	var walk func(prefix string, node map[string]interface{})
+	walk = func(prefix string, node map[string]interface{}) {
+		for key, value := range node {
+			if child, ok := value.(map[string]interface{}); ok {
+				walk(prefix+key+".", child)
+			} else {
+				flat[prefix+key] = value
+			}
+		}
+	}
+	walk("", tree)
+	return flat, nil
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestReloader loads the configuration from a file with the given content,
+// returning a reloader for it and the file's path
+func newTestReloader(t *testing.T, content string) (*Reloader, string) {
+	t.Helper()
+	path := writeFile(t, "config.yaml", content)
+	args := []string{"--config", path}
+	cfg, opts, err := Load(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewReloader(args, cfg, opts), path
+}
+
+func rewrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	r, path := newTestReloader(t, "metrics:\n  interval: 30s\napi:\n  logTailLines: 100\n")
+	before := r.Current()
+
+	var applied *Config
+	committed := false
+	r.OnReload(func(cfg *Config) (func(), error) {
+		applied = cfg
+		return func() { committed = true }, nil
+	})
+
+	rewrite(t, path, "metrics:\n  interval: 15s\napi:\n  logTailLines: 500\n")
+	report, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Applied, []string{"api.logTailLines", "metrics.interval"}) || len(report.RestartRequired) != 0 {
+		t.Errorf("report %+v, want both settings applied", report)
+	}
+
+	current := r.Current()
+	if current.Metrics.Interval.Duration != 15*time.Second || current.API.LogTailLines != 500 {
+		t.Errorf("interval %s and %d tail lines, want 15s and 500", current.Metrics.Interval.Duration, current.API.LogTailLines)
+	}
+	if applied != current || !committed {
+		t.Error("component not switched to the configuration in effect")
+	}
+	// The previous configuration is replaced, not changed in place
+	if before.Metrics.Interval.Duration != 30*time.Second || before.API.LogTailLines != 100 {
+		t.Errorf("previous configuration changed to %s and %d", before.Metrics.Interval.Duration, before.API.LogTailLines)
+	}
+}
+
+func TestReloadIsAtomic(t *testing.T) {
+	states := []string{
+		"metrics:\n  interval: 10s\napi:\n  logTailLines: 100\n",
+		"metrics:\n  interval: 20s\napi:\n  logTailLines: 200\n",
+	}
+	r, path := newTestReloader(t, states[0])
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// Readers never see one setting from each state
+			cfg := r.Current()
+			if int64(cfg.Metrics.Interval.Duration/time.Second)*10 != cfg.API.LogTailLines {
+				t.Errorf("interval %s with %d tail lines", cfg.Metrics.Interval.Duration, cfg.API.LogTailLines)
+				return
+			}
+		}
+	}()
+
+	for i := 1; i <= 20; i++ {
+		rewrite(t, path, states[i%2])
+		if _, err := r.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestReloadReportsRestartRequired(t *testing.T) {
+	r, path := newTestReloader(t, "server:\n  port: 9000\n")
+
+	rewrite(t, path, "server:\n  port: 9100\nlayout:\n  strategy: grid\nmetrics:\n  interval: 15s\n")
+	report, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.RestartRequired, []string{"layout.strategy", "server.port"}) {
+		t.Errorf("restart required for %v, want layout.strategy and server.port", report.RestartRequired)
+	}
+	if !slices.Equal(report.Applied, []string{"metrics.interval"}) {
+		t.Errorf("applied %v, want metrics.interval", report.Applied)
+	}
+
+	current := r.Current()
+	if current.Server.Port != 9000 || current.Layout.Strategy != "ring" {
+		t.Errorf("port %d and strategy %q changed without a restart", current.Server.Port, current.Layout.Strategy)
+	}
+	if current.Metrics.Interval.Duration != 15*time.Second {
+		t.Errorf("interval %s, want 15s", current.Metrics.Interval.Duration)
+	}
+}
+
+func TestReloadKeepsSettingsOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		applier Applier
+	}{
+		{name: "unknown key", content: "metrics:\n  intervall: 15s\n"},
+		{name: "invalid value", content: "metrics:\n  interval: 0s\n"},
+		{name: "malformed file", content: "metrics: [\n"},
+		{
+			name:    "rejected by a component",
+			content: "metrics:\n  interval: 15s\n",
+			applier: func(*Config) (func(), error) { return nil, errors.New("rules file unreadable") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, path := newTestReloader(t, "metrics:\n  interval: 30s\n")
+			before := r.Current()
+
+			committed := false
+			r.OnReload(func(*Config) (func(), error) {
+				return func() { committed = true }, nil
+			})
+			if tt.applier != nil {
+				r.OnReload(tt.applier)
+			}
+
+			rewrite(t, path, tt.content)
+			if _, err := r.Reload(); err == nil {
+				t.Fatal("reload succeeded")
+			}
+			if r.Current() != before || before.Metrics.Interval.Duration != 30*time.Second {
+				t.Errorf("configuration changed to %+v", r.Current())
+			}
+			if committed {
+				t.Error("component switched to the rejected configuration")
+			}
+		})
+	}
+}
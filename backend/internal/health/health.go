@@ -0,0 +1,151 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn" // a non-critical check failed; still ready
+	StatusFail = "fail"
+)
+
+// CheckFunc returns a short description of the dependency's state, or an
+// error if it is unhealthy. It must return once ctx is done.
+type CheckFunc func(ctx context.Context) (string, error)
+
+// check is a named readiness check
+type check struct {
+	name     string
+	critical bool
+	run      CheckFunc
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the response of the readiness endpoint
+type Report struct {
+	Status    string    `json:"status"`
+	Checks    []Result  `json:"checks"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Checker runs the readiness checks of the backend's dependencies
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewChecker creates a checker giving each check up to timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check. A failing critical check makes the backend not
+// ready; any other failure is reported as a warning.
+func (c *Checker) Add(name string, critical bool, run CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, critical: critical, run: run})
+}
+
+// Run runs every check concurrently
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checks)), Timestamp: time.Now()}
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			detail, err := chk.run(ctx)
+			result := Result{
+				Name:     chk.name,
+				Status:   StatusOK,
+				Critical: chk.critical,
+				Detail:   detail,
+				Duration: time.Since(start).Round(time.Microsecond).String(),
+			}
+			if err != nil {
+				result.Error = err.Error()
+				result.Status = StatusWarn
+				if chk.critical {
+					result.Status = StatusFail
+				}
+			}
+			report.Checks[i] = result
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusFail {
+			report.Status = StatusFail
+			break
+		} else if result.Status == StatusWarn {
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+// ServeReady runs the checks, responding 503 Service Unavailable if a
+// critical one failed
+func (c *Checker) ServeReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := c.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == StatusFail {
+		for _, result := range report.Checks {
+			if result.Status == StatusFail {
+				log.Printf("Readiness check %s failed: %s", result.Name, result.Error)
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// ServeLive reports that the process is up and serving requests. It checks
+// no dependencies, so an outage elsewhere doesn't get the backend restarted.
+func ServeLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  StatusOK,
+		"service": "observatory-backend",
+	})
+}
@@ -0,0 +1,156 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ok(detail string) CheckFunc {
+	return func(context.Context) (string, error) { return detail, nil }
+}
+
+func failing(msg string) CheckFunc {
+	return func(context.Context) (string, error) { return "", errors.New(msg) }
+}
+
+func TestCheckerRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks func(c *Checker)
+		want   string
+	}{
+		{"no checks", func(c *Checker) {}, StatusOK},
+		{"all passing", func(c *Checker) {
+			c.Add("api", true, ok("reachable"))
+			c.Add("metrics", false, ok("fresh"))
+		}, StatusOK},
+		{"non-critical failure", func(c *Checker) {
+			c.Add("api", true, ok("reachable"))
+			c.Add("metrics", false, failing("stale"))
+		}, StatusWarn},
+		{"critical failure", func(c *Checker) {
+			c.Add("metrics", false, failing("stale"))
+			c.Add("api", true, failing("unreachable"))
+		}, StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(time.Second)
+			tt.checks(c)
+			if report := c.Run(context.Background()); report.Status != tt.want {
+				t.Errorf("status %s, want %s: %+v", report.Status, tt.want, report.Checks)
+			}
+		})
+	}
+}
+
+func TestCheckerRunResults(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("api", true, ok("reachable"))
+	c.Add("metrics", false, failing("stale"))
+	c.Add("hub", true, failing("not responding"))
+
+	report := c.Run(context.Background())
+	want := []Result{
+		{Name: "api", Status: StatusOK, Critical: true, Detail: "reachable"},
+		{Name: "metrics", Status: StatusWarn, Error: "stale"},
+		{Name: "hub", Status: StatusFail, Critical: true, Error: "not responding"},
+	}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("got %d results, want %d", len(report.Checks), len(want))
+	}
+	for i, result := range report.Checks {
+		if result.Duration == "" {
+			t.Errorf("%s has no duration", result.Name)
+		}
+		result.Duration = ""
+		if result != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, result, want[i])
+		}
+	}
+}
+
+func TestCheckerTimesOutHangingCheck(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("hung", true, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %s with a 50ms timeout", elapsed)
+	}
+	if report.Status != StatusFail || report.Checks[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("report %+v, want the hung check failed on its deadline", report)
+	}
+}
+
+func TestServeReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		failing  bool
+		critical bool
+		want     int
+	}{
+		{"ready", http.MethodGet, false, false, http.StatusOK},
+		{"warning only", http.MethodGet, true, false, http.StatusOK},
+		{"not ready", http.MethodGet, true, true, http.StatusServiceUnavailable},
+		{"head", http.MethodHead, true, true, http.StatusServiceUnavailable},
+		{"post", http.MethodPost, false, false, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(time.Second)
+			if tt.failing {
+				c.Add("dependency", tt.critical, failing("down"))
+			}
+			rec := httptest.NewRecorder()
+			c.ServeReady(rec, httptest.NewRequest(tt.method, "/health/ready", nil))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.method != http.MethodGet {
+				return
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control %q, want no-store", got)
+			}
+			var report Report
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if wantFail := tt.want == http.StatusServiceUnavailable; (report.Status == StatusFail) != wantFail {
+				t.Errorf("report status %s with response %d", report.Status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestServeLive(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ServeLive(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || body["status"] != StatusOK {
+		t.Errorf("response %d %v, want 200 ok", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	ServeLive(rec, httptest.NewRequest(http.MethodDelete, "/health/live", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE answered %d, want 405", rec.Code)
+	}
+}
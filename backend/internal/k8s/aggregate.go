@@ -0,0 +1,239 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GroupByNamespace collapses pods into one cluster per namespace
+	GroupByNamespace = "namespace"
+	// GroupByWorkload collapses pods into one cluster per owning workload
+	GroupByWorkload = "workload"
+)
+
+// PodCluster is an aggregated group of pods shown as a single object in galaxy mode
+type PodCluster struct {
+	Key       string         `json:"key"`
+	Namespace string         `json:"namespace"`
+	Workload  string         `json:"workload,omitempty"` // e.g. "Deployment/web"
+	Count     int            `json:"count"`
+	Statuses  map[string]int `json:"statuses"` // pod count per status
+	Nodes     map[string]int `json:"nodes"`    // pod count per node
+	Restarts  int32          `json:"restarts"`
+	CPU       float64        `json:"cpu"`    // summed millicores
+	Memory    float64        `json:"memory"` // summed MB
+	Position  Position       `json:"position"`
+}
+
+// ClustersUpdate is the aggregated view of all pods for one grouping
+type ClustersUpdate struct {
+	GroupBy   string       `json:"groupBy"`
+	Clusters  []PodCluster `json:"clusters"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// GroupPods lists the individual pods of one cluster, sent when a client expands it
+type GroupPods struct {
+	GroupBy string `json:"groupBy"`
+	Group   string `json:"group"`
+	Pods    []Pod  `json:"pods"`
+}
+
+// ValidGroupBy reports whether groupBy names a supported grouping
+func ValidGroupBy(groupBy string) bool {
+	return groupBy == GroupByNamespace || groupBy == GroupByWorkload
+}
+
+// WorkloadName names the workload that owns a pod, e.g. "Deployment/web".
+// Pods owned by a Deployment's ReplicaSet are attributed to the Deployment;
+// pods without a controller are their own workload.
+func WorkloadName(podName string, owner *OwnerReference, labels map[string]string) string {
+	if owner == nil {
+		return "Pod/" + podName
+	}
+
+	if owner.Kind == "ReplicaSet" {
+		if hash := labels["pod-template-hash"]; hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+
+	return owner.Kind + "/" + owner.Name
+}
+
+// GroupKey returns the cluster a pod belongs to under the given grouping
+func GroupKey(pod *Pod, groupBy string) string {
+	if groupBy == GroupByWorkload {
+		return pod.Namespace + "/" + WorkloadName(pod.Name, pod.Owner, pod.Labels)
+	}
+	return pod.Namespace
+}
+
+// MetricsGroupKey returns the cluster a pod's metrics belong to under the given grouping
+func MetricsGroupKey(metrics *PodMetricsData, groupBy string) string {
+	if groupBy == GroupByWorkload {
+		return metrics.Namespace + "/" + metrics.Workload
+	}
+	return metrics.Namespace
+}
+
+// Aggregator keeps the latest state of every pod and its metrics so that
+// pods can be collapsed into clusters for large clusters
+type Aggregator struct {
+	mu      sync.RWMutex
+	pods    map[string]Pod
+	metrics map[string]PodMetricsData // keyed by pod ID
+	dirty   bool
+}
+
+// NewAggregator creates an empty aggregator
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		pods:    make(map[string]Pod),
+		metrics: make(map[string]PodMetricsData),
+	}
+}
+
+// Apply records a watch event
+func (a *Aggregator) Apply(event WatchEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch event.Type {
+	case EventPodAdded, EventPodModified:
+		a.pods[event.Pod.ID] = *event.Pod
+		a.dirty = true
+	case EventPodDeleted:
+		delete(a.pods, event.Pod.ID)
+		delete(a.metrics, event.Pod.ID)
+		a.dirty = true
+	case EventLayoutChanged:
+		for id, position := range event.Layout.Pods {
+			if pod, ok := a.pods[id]; ok {
+				pod.Position = position
+				a.pods[id] = pod
+				a.dirty = true
+			}
+		}
+	}
+}
+
+// ApplyMetrics records a metrics update
+func (a *Aggregator) ApplyMetrics(update MetricsUpdate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, metrics := range update.Pods {
+		a.metrics[metrics.PodID] = metrics
+	}
+	a.dirty = true
+}
+
+// TakeDirty reports whether anything changed since the last call
+func (a *Aggregator) TakeDirty() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dirty := a.dirty
+	a.dirty = false
+	return dirty
+}
+
+// Run publishes the clusters under every grouping each interval in which
+// anything changed, until ctx is cancelled
+func (a *Aggregator) Run(ctx context.Context, interval time.Duration, publish func(ClustersUpdate)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !a.TakeDirty() {
+			continue
+		}
+		for _, groupBy := range []string{GroupByNamespace, GroupByWorkload} {
+			publish(a.Clusters(groupBy))
+		}
+	}
+}
+
+// Clusters collapses all known pods into clusters under the given grouping
+func (a *Aggregator) Clusters(groupBy string) ClustersUpdate {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	clusters := make(map[string]*PodCluster)
+	for _, pod := range a.pods {
+		key := GroupKey(&pod, groupBy)
+		cluster, ok := clusters[key]
+		if !ok {
+			cluster = &PodCluster{
+				Key:       key,
+				Namespace: pod.Namespace,
+				Statuses:  make(map[string]int),
+				Nodes:     make(map[string]int),
+			}
+			if groupBy == GroupByWorkload {
+				cluster.Workload = WorkloadName(pod.Name, pod.Owner, pod.Labels)
+			}
+			clusters[key] = cluster
+		}
+
+		cluster.Count++
+		cluster.Statuses[pod.Status]++
+		cluster.Nodes[pod.NodeName]++
+		cluster.Restarts += pod.Restarts
+		if metrics, ok := a.metrics[pod.ID]; ok {
+			cluster.CPU += metrics.TotalCPU
+			cluster.Memory += metrics.TotalMemory
+		}
+
+		// Accumulate for the centroid, divided out below
+		cluster.Position.X += pod.Position.X
+		cluster.Position.Y += pod.Position.Y
+		cluster.Position.Z += pod.Position.Z
+	}
+
+	result := make([]PodCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		n := float64(cluster.Count)
+		cluster.Position = Position{X: cluster.Position.X / n, Y: cluster.Position.Y / n, Z: cluster.Position.Z / n}
+		result = append(result, *cluster)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+
+	return ClustersUpdate{
+		GroupBy:   groupBy,
+		Clusters:  result,
+		Timestamp: time.Now(),
+	}
+}
+
+// GroupPods returns the pods of one cluster with their latest metrics filled in
+func (a *Aggregator) GroupPods(groupBy, group string) GroupPods {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	pods := make([]Pod, 0)
+	for _, pod := range a.pods {
+		if GroupKey(&pod, groupBy) != group {
+			continue
+		}
+		if metrics, ok := a.metrics[pod.ID]; ok {
+			pod.CPU = metrics.TotalCPU
+			pod.Memory = metrics.TotalMemory
+		}
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	return GroupPods{GroupBy: groupBy, Group: group, Pods: pods}
+}
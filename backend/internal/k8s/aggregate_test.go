@@ -0,0 +1,255 @@
+package k8s
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func aggregatedPod(id, namespace, status, node string, owner *OwnerReference, labels map[string]string) *Pod {
+	return &Pod{ID: id, Name: id, Namespace: namespace, Status: status, NodeName: node, Owner: owner, Labels: labels}
+}
+
+func TestWorkloadName(t *testing.T) {
+	hash := map[string]string{"pod-template-hash": "5d9f7c"}
+	tests := []struct {
+		name   string
+		owner  *OwnerReference
+		labels map[string]string
+		want   string
+	}{
+		{"no owner", nil, nil, "Pod/web-1"},
+		{"deployment replica set", &OwnerReference{Kind: "ReplicaSet", Name: "web-5d9f7c"}, hash, "Deployment/web"},
+		{"bare replica set", &OwnerReference{Kind: "ReplicaSet", Name: "web"}, nil, "ReplicaSet/web"},
+		{"hash not in the name", &OwnerReference{Kind: "ReplicaSet", Name: "web-abc"}, hash, "ReplicaSet/web-abc"},
+		{"stateful set", &OwnerReference{Kind: "StatefulSet", Name: "db"}, nil, "StatefulSet/db"},
+		{"job", &OwnerReference{Kind: "Job", Name: "backup-28371"}, nil, "Job/backup-28371"},
+	}
+	for _, tt := range tests {
+		if got := WorkloadName("web-1", tt.owner, tt.labels); got != tt.want {
+			t.Errorf("%s: WorkloadName() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGroupKey(t *testing.T) {
+	pod := aggregatedPod("web-1", "shop", "Running", "node-a",
+		&OwnerReference{Kind: "ReplicaSet", Name: "web-5d9f7c"}, map[string]string{"pod-template-hash": "5d9f7c"})
+	metrics := &PodMetricsData{Namespace: "shop", Workload: "Deployment/web"}
+
+	tests := []struct {
+		groupBy, want string
+	}{
+		{GroupByNamespace, "shop"},
+		{GroupByWorkload, "shop/Deployment/web"},
+	}
+	for _, tt := range tests {
+		if got := GroupKey(pod, tt.groupBy); got != tt.want {
+			t.Errorf("GroupKey(%s) = %q, want %q", tt.groupBy, got, tt.want)
+		}
+		// Metrics must land in the same cluster as their pod
+		if got := MetricsGroupKey(metrics, tt.groupBy); got != tt.want {
+			t.Errorf("MetricsGroupKey(%s) = %q, want %q", tt.groupBy, got, tt.want)
+		}
+	}
+}
+
+// newTestAggregator holds two web replicas and a database in shop and one
+// unowned pod in tools
+func newTestAggregator() *Aggregator {
+	web := &OwnerReference{Kind: "ReplicaSet", Name: "web-5d9f7c"}
+	hash := map[string]string{"pod-template-hash": "5d9f7c"}
+	pods := []*Pod{
+		aggregatedPod("web-1", "shop", "Running", "node-a", web, hash),
+		aggregatedPod("web-2", "shop", "CrashLoopBackOff", "node-b", web, hash),
+		aggregatedPod("db-0", "shop", "Running", "node-a", &OwnerReference{Kind: "StatefulSet", Name: "db"}, nil),
+		aggregatedPod("debug", "tools", "Pending", "", nil, nil),
+	}
+	pods[0].Position = Position{X: 2, Y: 4}
+	pods[1].Position = Position{X: 4, Y: 8}
+	pods[1].Restarts = 5
+	pods[2].Restarts = 1
+
+	a := NewAggregator()
+	for _, pod := range pods {
+		a.Apply(WatchEvent{Type: EventPodAdded, Pod: pod})
+	}
+	a.ApplyMetrics(MetricsUpdate{Pods: []PodMetricsData{
+		{PodID: "web-1", TotalCPU: 100, TotalMemory: 64},
+		{PodID: "web-2", TotalCPU: 50, TotalMemory: 32},
+		{PodID: "db-0", TotalCPU: 250, TotalMemory: 512},
+	}})
+	return a
+}
+
+func TestAggregatorClusters(t *testing.T) {
+	a := newTestAggregator()
+	tests := []struct {
+		groupBy string
+		want    []PodCluster
+	}{
+		{GroupByNamespace, []PodCluster{
+			{Key: "shop", Namespace: "shop", Count: 3,
+				Statuses: map[string]int{"Running": 2, "CrashLoopBackOff": 1},
+				Nodes:    map[string]int{"node-a": 2, "node-b": 1},
+				Restarts: 6, CPU: 400, Memory: 608, Position: Position{X: 2, Y: 4}},
+			{Key: "tools", Namespace: "tools", Count: 1,
+				Statuses: map[string]int{"Pending": 1}, Nodes: map[string]int{"": 1}},
+		}},
+		{GroupByWorkload, []PodCluster{
+			{Key: "shop/Deployment/web", Namespace: "shop", Workload: "Deployment/web", Count: 2,
+				Statuses: map[string]int{"Running": 1, "CrashLoopBackOff": 1},
+				Nodes:    map[string]int{"node-a": 1, "node-b": 1},
+				Restarts: 5, CPU: 150, Memory: 96, Position: Position{X: 3, Y: 6}},
+			{Key: "shop/StatefulSet/db", Namespace: "shop", Workload: "StatefulSet/db", Count: 1,
+				Statuses: map[string]int{"Running": 1}, Nodes: map[string]int{"node-a": 1},
+				Restarts: 1, CPU: 250, Memory: 512},
+			{Key: "tools/Pod/debug", Namespace: "tools", Workload: "Pod/debug", Count: 1,
+				Statuses: map[string]int{"Pending": 1}, Nodes: map[string]int{"": 1}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			update := a.Clusters(tt.groupBy)
+			if update.GroupBy != tt.groupBy || update.Timestamp.IsZero() {
+				t.Errorf("update grouped by %q at %s", update.GroupBy, update.Timestamp)
+			}
+			if len(update.Clusters) != len(tt.want) {
+				t.Fatalf("got %d clusters, want %d: %+v", len(update.Clusters), len(tt.want), update.Clusters)
+			}
+			for i, got := range update.Clusters {
+				if !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("cluster %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAggregatorAppliesChanges(t *testing.T) {
+	a := newTestAggregator()
+
+	// A status change moves the pod between status counts
+	web2 := aggregatedPod("web-2", "shop", "Running", "node-b", &OwnerReference{Kind: "ReplicaSet", Name: "web-5d9f7c"}, map[string]string{"pod-template-hash": "5d9f7c"})
+	web2.Position = Position{X: 4, Y: 8}
+	a.Apply(WatchEvent{Type: EventPodModified, Pod: web2})
+	if statuses := a.Clusters(GroupByNamespace).Clusters[0].Statuses; !maps.Equal(statuses, map[string]int{"Running": 3}) {
+		t.Errorf("statuses %v after recovery, want 3 running", statuses)
+	}
+
+	// A layout change moves the centroid
+	a.Apply(WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Pods: map[string]Position{"web-1": {X: 0, Y: 0}, "gone": {X: 9}}}})
+	if position := a.Clusters(GroupByWorkload).Clusters[0].Position; position != (Position{X: 2, Y: 4}) {
+		t.Errorf("web centroid %+v after the layout change, want {2 4 0}", position)
+	}
+
+	// A deleted pod takes its metrics with it
+	a.Apply(WatchEvent{Type: EventPodDeleted, Pod: &Pod{ID: "db-0"}})
+	shop := a.Clusters(GroupByNamespace).Clusters[0]
+	if shop.Count != 2 || shop.CPU != 150 || shop.Memory != 96 {
+		t.Errorf("shop has %d pods using %.0fm CPU and %.0fMB after the delete, want 2 using 150m and 96MB", shop.Count, shop.CPU, shop.Memory)
+	}
+	if _, ok := a.metrics["db-0"]; ok {
+		t.Error("metrics of the deleted pod kept")
+	}
+}
+
+func TestAggregatorGroupPods(t *testing.T) {
+	a := newTestAggregator()
+
+	group := a.GroupPods(GroupByWorkload, "shop/Deployment/web")
+	if len(group.Pods) != 2 || group.Pods[0].Name != "web-1" || group.Pods[1].Name != "web-2" {
+		t.Fatalf("pods %+v, want web-1 and web-2", group.Pods)
+	}
+	if group.Pods[0].CPU != 100 || group.Pods[0].Memory != 64 {
+		t.Errorf("web-1 using %.0fm CPU and %.0fMB, want its latest metrics", group.Pods[0].CPU, group.Pods[0].Memory)
+	}
+
+	if group := a.GroupPods(GroupByNamespace, "missing"); group.Pods == nil || len(group.Pods) != 0 {
+		t.Errorf("pods %v for an unknown group, want an empty list", group.Pods)
+	}
+}
+
+func TestAggregatorTakeDirty(t *testing.T) {
+	a := NewAggregator()
+	if a.TakeDirty() {
+		t.Error("new aggregator dirty")
+	}
+
+	tests := []struct {
+		name  string
+		apply func()
+		want  bool
+	}{
+		{"pod added", func() {
+			a.Apply(WatchEvent{Type: EventPodAdded, Pod: aggregatedPod("web-1", "shop", "Running", "node-a", nil, nil)})
+		}, true},
+		{"metrics", func() { a.ApplyMetrics(MetricsUpdate{Pods: []PodMetricsData{{PodID: "web-1", TotalCPU: 10}}}) }, true},
+		{"layout moving a known pod", func() {
+			a.Apply(WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Pods: map[string]Position{"web-1": {X: 1}}}})
+		}, true},
+		{"layout moving only unknown pods", func() {
+			a.Apply(WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Pods: map[string]Position{"other": {X: 1}}}})
+		}, false},
+		{"node event", func() { a.Apply(WatchEvent{Type: EventNodeModified, Node: &Node{Name: "node-a"}}) }, false},
+		{"pod deleted", func() { a.Apply(WatchEvent{Type: EventPodDeleted, Pod: &Pod{ID: "web-1"}}) }, true},
+	}
+	for _, tt := range tests {
+		tt.apply()
+		if got := a.TakeDirty(); got != tt.want {
+			t.Errorf("%s: TakeDirty() = %v, want %v", tt.name, got, tt.want)
+		}
+		if a.TakeDirty() {
+			t.Errorf("%s: still dirty after TakeDirty", tt.name)
+		}
+	}
+}
+
+func TestAggregatorRunPublishesOnlyWhenDirty(t *testing.T) {
+	a := newTestAggregator()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	published := make(chan ClustersUpdate, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Run(ctx, 10*time.Millisecond, func(update ClustersUpdate) { published <- update })
+	}()
+
+	receive := func() ClustersUpdate {
+		t.Helper()
+		select {
+		case update := <-published:
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("no clusters published")
+			return ClustersUpdate{}
+		}
+	}
+
+	// The pending changes are published once under every grouping
+	if first, second := receive(), receive(); first.GroupBy != GroupByNamespace || second.GroupBy != GroupByWorkload {
+		t.Errorf("published %s then %s, want namespace then workload", first.GroupBy, second.GroupBy)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(published) != 0 {
+		t.Fatalf("published %d updates with nothing changed", len(published))
+	}
+
+	a.Apply(WatchEvent{Type: EventPodDeleted, Pod: &Pod{ID: "debug"}})
+	if update := receive(); len(update.Clusters) != 1 || update.Clusters[0].Key != "shop" {
+		t.Errorf("clusters %+v after the delete, want only shop", update.Clusters)
+	}
+	receive()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
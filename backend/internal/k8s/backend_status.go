@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend states reported to clients, from best to worst
+const (
+	// StateConnected means the cluster connection, watches and metrics are all working
+	StateConnected = "connected"
+	// StateMetricsUnavailable means live state is current but resource usage is not
+	StateMetricsUnavailable = "metrics_unavailable"
+	// StateDegraded means the API server is reachable but a watch is failing,
+	// so the state shown may be stale
+	StateDegraded = "degraded"
+	// StateReconnecting means the API server is unreachable and the watches are retrying
+	StateReconnecting = "reconnecting"
+)
+
+// apiCheckTimeout bounds the API server reachability check
+const apiCheckTimeout = 3 * time.Second
+
+// BackendStatus describes the backend's view of the cluster, sent to clients
+// as backend_status whenever State changes
+type BackendStatus struct {
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+	// Since is when the backend entered State
+	Since        time.Time     `json:"since"`
+	CheckedAt    time.Time     `json:"checkedAt"`
+	APIReachable bool          `json:"apiReachable"`
+	APIError     string        `json:"apiError,omitempty"`
+	Watches      []WatchStatus `json:"watches"`
+	Metrics      MetricsStatus `json:"metrics"`
+}
+
+// StatusMonitor periodically checks the cluster connection, the watches and
+// the metrics fetcher
+type StatusMonitor struct {
+	client  *Client
+	fetcher *MetricsFetcher
+
+	mu      sync.RWMutex
+	current BackendStatus
+}
+
+// NewStatusMonitor creates a monitor. The backend is assumed connected until
+// the first check, since the watchers have synced by the time it runs.
+func NewStatusMonitor(client *Client, fetcher *MetricsFetcher) *StatusMonitor {
+	now := time.Now()
+	return &StatusMonitor{
+		client:  client,
+		fetcher: fetcher,
+		current: BackendStatus{State: StateConnected, Since: now, CheckedAt: now, APIReachable: true},
+	}
+}
+
+// Current returns the status found by the latest check
+func (m *StatusMonitor) Current() BackendStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// Run checks the status every interval until ctx is cancelled, calling
+// onChange whenever the state changes
+func (m *StatusMonitor) Run(ctx context.Context, interval time.Duration, onChange func(BackendStatus)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status := m.check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.mu.Lock()
+		previous := m.current
+		if status.State == previous.State {
+			status.Since = previous.Since
+		}
+		m.current = status
+		m.mu.Unlock()
+
+		if status.State != previous.State {
+			log.Printf("Backend status changed from %s to %s: %s", previous.State, status.State, status.Message)
+			onChange(status)
+		}
+	}
+}
+
+// check evaluates the current status
+func (m *StatusMonitor) check(ctx context.Context) BackendStatus {
+	now := time.Now()
+	status := BackendStatus{
+		State:        StateConnected,
+		Since:        now,
+		CheckedAt:    now,
+		APIReachable: true,
+		Watches:      m.client.WatchStatus(),
+		Metrics:      m.fetcher.Status(),
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, apiCheckTimeout)
+	defer cancel()
+	if err := m.client.Ping(pingCtx); err != nil {
+		status.State = StateReconnecting
+		status.APIReachable = false
+		status.APIError = err.Error()
+		status.Message = "Kubernetes API server unreachable"
+		return status
+	}
+
+	var failing []string
+	for _, watch := range status.Watches {
+		if !watch.Healthy(now) {
+			failing = append(failing, watch.Resource)
+		}
+	}
+	if len(failing) > 0 {
+		status.State = StateDegraded
+		status.Message = fmt.Sprintf("Watching %s is failing; changes may be missing", strings.Join(failing, ", "))
+		return status
+	}
+
+	if !status.Metrics.Healthy(now) {
+		status.State = StateMetricsUnavailable
+		status.Message = "Resource metrics unavailable"
+		if status.Metrics.LastError != "" {
+			status.Message += ": " + status.Metrics.LastError
+		}
+	}
+	return status
+}
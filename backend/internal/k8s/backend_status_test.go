@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newTestMonitor creates a status monitor whose API server answers version
+// requests while up is true, with one watch and a metrics fetcher the test
+// can set the state of
+func newTestMonitor(t *testing.T) (m *StatusMonitor, up *atomic.Bool, watch *watchTracker, fetcher *MetricsFetcher) {
+	t.Helper()
+	up = &atomic.Bool{}
+	up.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, "unavailable", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major":"1","minor":"34"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	c, _ := newFakeClient(t, LayoutRing)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Clientset = clientset
+
+	watch = &watchTracker{resource: "pods", synced: func() bool { return true }}
+	watch.status = WatchStatus{Resource: "pods", Started: time.Now()}
+	c.watches = append(c.watches, watch)
+
+	fetcher = &MetricsFetcher{source: &fakeSource{name: "metrics-server"}}
+	fetcher.interval.Store(int64(30 * time.Second))
+	return NewStatusMonitor(c, fetcher), up, watch, fetcher
+}
+
+func TestStatusMonitorCheck(t *testing.T) {
+	m, up, watch, fetcher := newTestMonitor(t)
+	ctx := context.Background()
+
+	if status := m.check(ctx); status.State != StateConnected || !status.APIReachable || len(status.Watches) != 1 {
+		t.Errorf("status %+v, want connected", status)
+	}
+
+	// Failed metrics only make resource usage unavailable
+	fetcher.recordResult(nil)
+	fetcher.status.LastError, fetcher.status.LastErrorAt = "metrics.k8s.io not served", time.Now()
+	status := m.check(ctx)
+	if status.State != StateMetricsUnavailable || !strings.Contains(status.Message, "metrics.k8s.io not served") {
+		t.Errorf("status %s: %s, want metrics_unavailable with the error", status.State, status.Message)
+	}
+
+	// A watch failing past the grace degrades the backend; a fresh error doesn't
+	watch.failed(errors.New("connection refused"), time.Now())
+	if status := m.check(ctx); status.State != StateMetricsUnavailable {
+		t.Errorf("status %s right after a watch error, want metrics_unavailable", status.State)
+	}
+	watch.status.FailingSince = time.Now().Add(-watchFailureGrace)
+	status = m.check(ctx)
+	if status.State != StateDegraded || !strings.Contains(status.Message, "pods") {
+		t.Errorf("status %s: %s, want degraded naming pods", status.State, status.Message)
+	}
+
+	// An unreachable API server outranks everything else
+	up.Store(false)
+	status = m.check(ctx)
+	if status.State != StateReconnecting || status.APIReachable || status.APIError == "" {
+		t.Errorf("status %+v, want reconnecting", status)
+	}
+}
+
+func TestStatusMonitorRunReportsChanges(t *testing.T) {
+	m, up, _, _ := newTestMonitor(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan BackendStatus, 8)
+	go m.Run(ctx, 10*time.Millisecond, func(status BackendStatus) { changes <- status })
+	initial := m.Current()
+
+	// Checks finding the same state aren't reported
+	time.Sleep(50 * time.Millisecond)
+	if len(changes) != 0 {
+		t.Fatalf("got %d changes while connected", len(changes))
+	}
+	if current := m.Current(); current.Since != initial.Since || !current.CheckedAt.After(initial.CheckedAt) {
+		t.Errorf("since %s, checked at %s; want the same since and a later check", current.Since, current.CheckedAt)
+	}
+
+	up.Store(false)
+	select {
+	case status := <-changes:
+		if status.State != StateReconnecting || !status.Since.After(initial.Since) {
+			t.Errorf("change %s since %s, want reconnecting since now", status.State, status.Since)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lost API server not reported")
+	}
+
+	up.Store(true)
+	select {
+	case status := <-changes:
+		if status.State != StateConnected {
+			t.Errorf("change to %s, want connected", status.State)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("recovered API server not reported")
+	}
+	if m.Current().State != StateConnected {
+		t.Errorf("current state %s, want connected", m.Current().State)
+	}
+}
@@ -0,0 +1,201 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultContainerAnnotation is the kubectl annotation naming a pod's main container
+	DefaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+	// SidecarsAnnotation lists the containers of a pod that should be shown as sidecars
+	SidecarsAnnotation = "observatory.io/sidecars"
+)
+
+// ClassificationRule assigns a container type to containers whose name and/or
+// image match the given regular expressions. When both patterns are set, both must match.
+type ClassificationRule struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"` // "main" or "sidecar"
+	NamePattern  string `json:"namePattern,omitempty"`
+	ImagePattern string `json:"imagePattern,omitempty"`
+
+	nameRe  *regexp.Regexp
+	imageRe *regexp.Regexp
+}
+
+// ClassifierConfig is the on-disk format of the sidecar rules file
+type ClassifierConfig struct {
+	Rules []ClassificationRule `json:"rules"`
+}
+
+// Classification is the outcome of classifying a single container
+type Classification struct {
+	Type string // "main", "sidecar", "init", or "ephemeral"
+	Rule string // why the container got its type, e.g. "rule:istio-proxy"
+}
+
+// ContainerClassifier decides which containers of a pod are main containers and which are sidecars
+type ContainerClassifier struct {
+	rules []ClassificationRule
+}
+
+// defaultSidecarPatterns are the well-known sidecar names matched when no rules file is configured
+var defaultSidecarPatterns = []string{
+	"istio-proxy", "envoy", "linkerd-proxy",
+	"cloudsql-proxy", "vault-agent",
+	"fluentd", "filebeat", "logstash",
+	"prometheus-exporter", "jaeger-agent",
+}
+
+// NewContainerClassifier compiles the given rules into a classifier
+func NewContainerClassifier(rules []ClassificationRule) (*ContainerClassifier, error) {
+	compiled := make([]ClassificationRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if rule.Type != "main" && rule.Type != "sidecar" {
+			return nil, fmt.Errorf("rule %q: type must be \"main\" or \"sidecar\", got %q", rule.Name, rule.Type)
+		}
+		if rule.NamePattern == "" && rule.ImagePattern == "" {
+			return nil, fmt.Errorf("rule %q: namePattern or imagePattern is required", rule.Name)
+		}
+
+		var err error
+		if rule.NamePattern != "" {
+			if rule.nameRe, err = regexp.Compile(rule.NamePattern); err != nil {
+				return nil, fmt.Errorf("rule %q: invalid namePattern: %w", rule.Name, err)
+			}
+		}
+		if rule.ImagePattern != "" {
+			if rule.imageRe, err = regexp.Compile(rule.ImagePattern); err != nil {
+				return nil, fmt.Errorf("rule %q: invalid imagePattern: %w", rule.Name, err)
+			}
+		}
+
+		compiled = append(compiled, rule)
+	}
+
+	return &ContainerClassifier{rules: compiled}, nil
+}
+
+// DefaultContainerClassifier returns a classifier matching the well-known sidecar names
+func DefaultContainerClassifier() *ContainerClassifier {
+	rules := make([]ClassificationRule, 0, len(defaultSidecarPatterns))
+	for _, pattern := range defaultSidecarPatterns {
+		rules = append(rules, ClassificationRule{
+			Name:        pattern,
+			Type:        "sidecar",
+			NamePattern: "(?i)" + regexp.QuoteMeta(pattern),
+		})
+	}
+
+	classifier, err := NewContainerClassifier(rules)
+	if err != nil {
+		panic(err) // the built-in rules are static and always compile
+	}
+	return classifier
+}
+
+// LoadContainerClassifier reads classification rules from a YAML or JSON file
+func LoadContainerClassifier(path string) (*ContainerClassifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar rules: %w", err)
+	}
+
+	var config ClassifierConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse sidecar rules: %w", err)
+	}
+
+	return NewContainerClassifier(config.Rules)
+}
+
+// Rules returns the compiled rules in evaluation order
+func (cc *ContainerClassifier) Rules() []ClassificationRule {
+	return cc.rules
+}
+
+// match returns the first rule matching a container
+func (cc *ContainerClassifier) match(name, image string) (ClassificationRule, bool) {
+	for _, rule := range cc.rules {
+		if rule.nameRe != nil && !rule.nameRe.MatchString(name) {
+			continue
+		}
+		if rule.imageRe != nil && !rule.imageRe.MatchString(image) {
+			continue
+		}
+		return rule, true
+	}
+	return ClassificationRule{}, false
+}
+
+// ClassifyPod classifies every container declared by a pod, keyed by container name.
+// Pod annotations take precedence over rules; containers matched by neither fall back
+// to the first one being main and any others being sidecars.
+func (cc *ContainerClassifier) ClassifyPod(pod *corev1.Pod) map[string]Classification {
+	result := make(map[string]Classification,
+		len(pod.Spec.InitContainers)+len(pod.Spec.Containers)+len(pod.Spec.EphemeralContainers))
+
+	for _, container := range pod.Spec.InitContainers {
+		if isRestartableInitContainer(&container) {
+			result[container.Name] = Classification{Type: "sidecar", Rule: "native-sidecar"}
+		} else {
+			result[container.Name] = Classification{Type: "init", Rule: "init-container"}
+		}
+	}
+
+	for _, container := range pod.Spec.EphemeralContainers {
+		result[container.Name] = Classification{Type: "ephemeral", Rule: "ephemeral-container"}
+	}
+
+	sidecars := make(map[string]bool)
+	for _, name := range strings.Split(pod.Annotations[SidecarsAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			sidecars[name] = true
+		}
+	}
+	defaultContainer := pod.Annotations[DefaultContainerAnnotation]
+
+	hasMain := false
+	var unmatched []string
+	for _, container := range pod.Spec.Containers {
+		switch {
+		case container.Name == defaultContainer:
+			result[container.Name] = Classification{Type: "main", Rule: "annotation:" + DefaultContainerAnnotation}
+		case sidecars[container.Name]:
+			result[container.Name] = Classification{Type: "sidecar", Rule: "annotation:" + SidecarsAnnotation}
+		default:
+			rule, ok := cc.match(container.Name, container.Image)
+			if !ok {
+				unmatched = append(unmatched, container.Name)
+				continue
+			}
+			result[container.Name] = Classification{Type: rule.Type, Rule: "rule:" + rule.Name}
+		}
+
+		if result[container.Name].Type == "main" {
+			hasMain = true
+		}
+	}
+
+	// Containers no rule claimed: the first becomes main unless another container already is
+	for _, name := range unmatched {
+		if !hasMain {
+			result[name] = Classification{Type: "main", Rule: "default:first-container"}
+			hasMain = true
+			continue
+		}
+		result[name] = Classification{Type: "sidecar", Rule: "default:additional-container"}
+	}
+
+	return result
+}
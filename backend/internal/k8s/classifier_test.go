@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// classifierPod builds a pod with the given annotations and containers, as name=image pairs
+func classifierPod(annotations map[string]string, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: annotations}}
+	for _, container := range containers {
+		name, image, _ := strings.Cut(container, "=")
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: name, Image: image})
+	}
+	return pod
+}
+
+func TestClassifyPod(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	rules, err := NewContainerClassifier([]ClassificationRule{
+		{Name: "istio", Type: "sidecar", NamePattern: "^istio-proxy$"},
+		{Name: "company-agent", Type: "sidecar", NamePattern: "^agent$", ImagePattern: "^registry.example.com/agent:"},
+		{Name: "worker", Type: "main", NamePattern: "^worker$"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		classifier *ContainerClassifier
+		pod        *corev1.Pod
+		want       map[string]Classification
+	}{
+		{
+			name:       "mesh proxy injected first",
+			classifier: DefaultContainerClassifier(),
+			pod:        classifierPod(nil, "istio-proxy=istio/proxyv2", "app=example/web"),
+			want: map[string]Classification{
+				"istio-proxy": {Type: "sidecar", Rule: "rule:istio-proxy"},
+				"app":         {Type: "main", Rule: "default:first-container"},
+			},
+		},
+		{
+			name:       "unmatched containers",
+			classifier: DefaultContainerClassifier(),
+			pod:        classifierPod(nil, "app=example/web", "cache=redis"),
+			want: map[string]Classification{
+				"app":   {Type: "main", Rule: "default:first-container"},
+				"cache": {Type: "sidecar", Rule: "default:additional-container"},
+			},
+		},
+		{
+			name:       "annotations take precedence over rules",
+			classifier: rules,
+			pod: classifierPod(map[string]string{
+				DefaultContainerAnnotation: "istio-proxy",
+				SidecarsAnnotation:         " worker , other",
+			}, "worker=example/worker", "istio-proxy=istio/proxyv2"),
+			want: map[string]Classification{
+				"worker":      {Type: "sidecar", Rule: "annotation:" + SidecarsAnnotation},
+				"istio-proxy": {Type: "main", Rule: "annotation:" + DefaultContainerAnnotation},
+			},
+		},
+		{
+			name:       "name and image rule needs both",
+			classifier: rules,
+			pod:        classifierPod(nil, "app=example/web", "agent=registry.example.com/agent:1.2", "agent-copy=registry.example.com/agent:1.2"),
+			want: map[string]Classification{
+				"app":        {Type: "main", Rule: "default:first-container"},
+				"agent":      {Type: "sidecar", Rule: "rule:company-agent"},
+				"agent-copy": {Type: "sidecar", Rule: "default:additional-container"},
+			},
+		},
+		{
+			name:       "name without matching image",
+			classifier: rules,
+			pod:        classifierPod(nil, "agent=docker.io/other/agent:1.2"),
+			want: map[string]Classification{
+				"agent": {Type: "main", Rule: "default:first-container"},
+			},
+		},
+		{
+			name:       "main rule leaves unmatched containers as sidecars",
+			classifier: rules,
+			pod:        classifierPod(nil, "exporter=example/exporter", "worker=example/worker"),
+			want: map[string]Classification{
+				"exporter": {Type: "sidecar", Rule: "default:additional-container"},
+				"worker":   {Type: "main", Rule: "rule:worker"},
+			},
+		},
+		{
+			name:       "init, native sidecar and ephemeral containers",
+			classifier: DefaultContainerClassifier(),
+			pod: func() *corev1.Pod {
+				pod := classifierPod(nil, "app=example/web")
+				pod.Spec.InitContainers = []corev1.Container{
+					{Name: "migrate", Image: "example/migrate"},
+					{Name: "log-shipper", Image: "example/shipper", RestartPolicy: &always},
+				}
+				pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+					{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "busybox"}},
+				}
+				return pod
+			}(),
+			want: map[string]Classification{
+				"migrate":     {Type: "init", Rule: "init-container"},
+				"log-shipper": {Type: "sidecar", Rule: "native-sidecar"},
+				"debugger":    {Type: "ephemeral", Rule: "ephemeral-container"},
+				"app":         {Type: "main", Rule: "default:first-container"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.classifier.ClassifyPod(tt.pod)
+			if len(got) != len(tt.want) {
+				t.Errorf("classified %d containers, want %d: %v", len(got), len(tt.want), got)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s classified as %+v, want %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadContainerClassifier(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "rules.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	classifier, err := LoadContainerClassifier(write(`
+rules:
+  - name: agent
+    type: sidecar
+    namePattern: ^agent$
+    imagePattern: ^registry.example.com/
+  - type: main
+    namePattern: ^worker$
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := classifier.Rules(); len(rules) != 2 || rules[0].Name != "agent" || rules[1].Name != "rule-1" {
+		t.Errorf("rules %+v, want agent and rule-1", rules)
+	}
+
+	invalid := map[string]string{
+		"unknown type":     "rules:\n  - name: a\n    type: helper\n    namePattern: a\n",
+		"no pattern":       "rules:\n  - name: a\n    type: sidecar\n",
+		"bad name regexp":  "rules:\n  - name: a\n    type: sidecar\n    namePattern: '('\n",
+		"bad image regexp": "rules:\n  - name: a\n    type: sidecar\n    imagePattern: '[a-'\n",
+		"not YAML":         "rules: [",
+	}
+	for name, content := range invalid {
+		if _, err := LoadContainerClassifier(write(content)); err == nil {
+			t.Errorf("%s: rules file accepted", name)
+		}
+	}
+
+	if _, err := LoadContainerClassifier(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing rules file accepted")
+	}
+}
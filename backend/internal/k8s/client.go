@@ -3,9 +3,12 @@ package k8s
 import (
 	"context"
 	"log"
-	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
+	"github.com/craigderington/lantern/internal/config"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -13,22 +16,34 @@ import (
 )
 
 type Client struct {
-	Clientset *kubernetes.Clientset
-	ctx       context.Context
+	Clientset  *kubernetes.Clientset
+	ctx        context.Context
+	classifier atomic.Pointer[ContainerClassifier]
+	layout     *Layout
+	informers  informers.SharedInformerFactory
+
+	// podMu orders layout changes made by pod events with the initial
+	// placement of listed pods, and the events sent for them
+	podMu sync.Mutex
+
+	// annotationLimit trims pod annotation values longer than this many bytes (0 disables trimming)
+	annotationLimit atomic.Int64
+
+	// Health of the started watches
+	watchMu sync.Mutex
+	watches []*watchTracker
 }
 
 // NewClient creates a new Kubernetes client
-// It tries in-cluster config first, then falls back to kubeconfig
-func NewClient() (*Client, error) {
-	var config *rest.Config
-	var err error
-
+// It tries in-cluster config first, then falls back to kubeconfig.
+// Cancelling ctx aborts requests in flight and stops the watchers.
+func NewClient(ctx context.Context, cfg *config.Config) (*Client, error) {
 	// Try in-cluster config first (for when running inside k8s)
-	config, err = rest.InClusterConfig()
+	restConfig, err := rest.InClusterConfig()
 	if err != nil {
 		// Fall back to kubeconfig (for local development)
 		log.Println("Not running in cluster, using kubeconfig...")
-		config, err = getKubeConfig()
+		restConfig, err = getKubeConfig(cfg.Kubernetes.Kubeconfig)
 		if err != nil {
 			return nil, err
 		}
@@ -36,43 +51,111 @@ func NewClient() (*Client, error) {
 		log.Println("Using in-cluster configuration")
 	}
 
+	return NewClientForConfig(ctx, cfg, restConfig)
+}
+
+// NewClientForConfig creates a Kubernetes client for the API server in restConfig
+func NewClientForConfig(ctx context.Context, cfg *config.Config, restConfig *rest.Config) (*Client, error) {
+	// Check the local settings before connecting
+	layout, err := NewLayout(cfg.Layout)
+	if err != nil {
+		return nil, err
+	}
+
+	classifier, err := loadClassifier(cfg.Kubernetes.SidecarRulesFile)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Println("Successfully connected to Kubernetes cluster")
 
-	return &Client{
+	c := &Client{
 		Clientset: clientset,
-		ctx:       context.Background(),
+		ctx:       ctx,
+		layout:    layout,
+		informers: informers.NewSharedInformerFactory(clientset, 0),
+	}
+	c.SetClassifier(classifier)
+	c.SetAnnotationLimit(cfg.Kubernetes.AnnotationMaxBytes)
+	return c, nil
+}
+
+// Reconfigure prepares the client for a reloaded configuration, re-reading
+// the sidecar rules file. Pods are classified with the new rules from their
+// next change on.
+func (c *Client) Reconfigure(cfg *config.Config) (func(), error) {
+	classifier, err := loadClassifier(cfg.Kubernetes.SidecarRulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		c.SetClassifier(classifier)
+		c.SetAnnotationLimit(cfg.Kubernetes.AnnotationMaxBytes)
 	}, nil
 }
 
-// getKubeConfig loads kubeconfig from KUBECONFIG env var or default location
-func getKubeConfig() (*rest.Config, error) {
-	var kubeconfig string
+// loadClassifier loads sidecar rules from a file, or the built-in rules if none is configured
+func loadClassifier(rulesFile string) (*ContainerClassifier, error) {
+	if rulesFile == "" {
+		return DefaultContainerClassifier(), nil
+	}
+
+	classifier, err := LoadContainerClassifier(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d sidecar rules from %s", len(classifier.Rules()), rulesFile)
+	return classifier, nil
+}
 
-	// Check KUBECONFIG environment variable first
-	if envKubeconfig := os.Getenv("KUBECONFIG"); envKubeconfig != "" {
-		kubeconfig = envKubeconfig
-		log.Printf("Using KUBECONFIG from environment: %s", kubeconfig)
+// getKubeConfig loads the configured kubeconfig, or the default location
+func getKubeConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		log.Printf("Using configured kubeconfig: %s", kubeconfig)
 	} else if home := homedir.HomeDir(); home != "" {
 		kubeconfig = filepath.Join(home, ".kube", "config")
 		log.Printf("Using default kubeconfig: %s", kubeconfig)
 	}
 
 	// Build config from kubeconfig file
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		return nil, err
 	}
 
-	return config, nil
+	return restConfig, nil
+}
+
+// Shutdown waits for the watchers to stop after the client's context is cancelled.
+// No more events are sent once it returns.
+func (c *Client) Shutdown() {
+	c.informers.Shutdown()
 }
 
 // Context returns the client's context
 func (c *Client) Context() context.Context {
 	return c.ctx
 }
+
+// SetClassifier replaces the rules used to tell main containers from sidecars
+func (c *Client) SetClassifier(classifier *ContainerClassifier) {
+	c.classifier.Store(classifier)
+}
+
+// SetAnnotationLimit trims pod annotation values longer than limit bytes in
+// the pod payload, e.g. kubectl's last-applied-configuration. Zero disables trimming.
+func (c *Client) SetAnnotationLimit(limit int) {
+	c.annotationLimit.Store(int64(limit))
+}
+
+// Layout returns the layout that owns node and pod positions
+func (c *Client) Layout() *Layout {
+	return c.layout
+}
@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchFailureGrace is how long a watch must keep failing before it is
+// reported unhealthy. The reflector retries failed watches with a backoff of
+// up to a minute, so a watch still failing is seen failing within the grace.
+const watchFailureGrace = 2 * time.Minute
+
+// WatchStatus describes the health of one informer watch
+type WatchStatus struct {
+	Resource    string    `json:"resource"`
+	Synced      bool      `json:"synced"`
+	Started     time.Time `json:"started"`
+	LastEvent   time.Time `json:"lastEvent,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitzero"`
+	// FailingSince is the first of the errors since the watch last worked
+	FailingSince time.Time `json:"failingSince,omitzero"`
+}
+
+// Healthy reports whether the watch has synced and is not failing. A watch
+// is failing once it has reported errors for longer than the grace period
+// with no event in between; a single error the reflector recovers from
+// doesn't count.
+func (s WatchStatus) Healthy(now time.Time) bool {
+	if !s.Synced {
+		return false
+	}
+	failing := s.LastErrorAt.After(s.LastEvent) && now.Sub(s.LastErrorAt) < watchFailureGrace
+	return !failing || now.Sub(s.FailingSince) < watchFailureGrace
+}
+
+// routineWatchError reports whether err ends a watch in the normal course of
+// things, like an expired resource version, so the reflector just relists
+func routineWatchError(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// watchTracker records events and errors of an informer for health checks
+type watchTracker struct {
+	resource string
+	synced   cache.InformerSynced
+
+	mu     sync.Mutex
+	status WatchStatus
+}
+
+// trackWatch starts tracking an informer. It must be called before the
+// informer is started.
+func (c *Client) trackWatch(resource string, informer cache.SharedIndexInformer) (*watchTracker, error) {
+	w := &watchTracker{resource: resource, synced: informer.HasSynced}
+	w.status.Resource = resource
+	w.status.Started = time.Now()
+
+	// Keep client-go's logging of watch errors
+	err := informer.SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		if !routineWatchError(err) {
+			w.failed(err, time.Now())
+		}
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.watchMu.Lock()
+	c.watches = append(c.watches, w)
+	c.watchMu.Unlock()
+	return w, nil
+}
+
+// failed records a watch error. It starts a new failure unless the watch
+// has kept failing since the previous error.
+func (w *watchTracker) failed(err error, at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	previous := w.status
+	if previous.FailingSince.IsZero() || previous.LastEvent.After(previous.LastErrorAt) || at.Sub(previous.LastErrorAt) >= watchFailureGrace {
+		w.status.FailingSince = at
+	}
+	w.status.LastError = err.Error()
+	w.status.LastErrorAt = at
+}
+
+// seen records that the informer delivered an event
+func (w *watchTracker) seen() {
+	w.mu.Lock()
+	w.status.LastEvent = time.Now()
+	w.mu.Unlock()
+}
+
+// WatchStatus returns the state of every started watch
+func (c *Client) WatchStatus() []WatchStatus {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	statuses := make([]WatchStatus, 0, len(c.watches))
+	for _, w := range c.watches {
+		w.mu.Lock()
+		status := w.status
+		w.mu.Unlock()
+		status.Synced = w.synced()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Ping checks that the API server is reachable with the client's credentials
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Clientset.RESTClient().Get().AbsPath("/version").DoRaw(ctx)
+	return err
+}
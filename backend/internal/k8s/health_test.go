@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWatchStatusHealthy(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name   string
+		status WatchStatus
+		want   bool
+	}{
+		{"not synced", WatchStatus{}, false},
+		{"no errors", WatchStatus{Synced: true, LastEvent: ago(time.Hour)}, true},
+		{"event since the error", WatchStatus{Synced: true, LastErrorAt: ago(time.Hour), FailingSince: ago(time.Hour), LastEvent: ago(time.Minute)}, true},
+		{"failing within the grace", WatchStatus{Synced: true, LastErrorAt: ago(time.Second), FailingSince: ago(time.Minute)}, true},
+		{"failing past the grace", WatchStatus{Synced: true, LastErrorAt: ago(30 * time.Second), FailingSince: ago(5 * time.Minute)}, false},
+		{"one error long ago without events since", WatchStatus{Synced: true, LastEvent: ago(time.Hour), LastErrorAt: ago(10 * time.Minute), FailingSince: ago(10 * time.Minute)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Healthy(now); got != tt.want {
+			t.Errorf("%s: Healthy() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWatchTrackerFailed(t *testing.T) {
+	start := time.Now()
+	w := &watchTracker{status: WatchStatus{Synced: true}}
+	err := errors.New("connection refused")
+
+	w.failed(err, start)
+	w.failed(err, start.Add(time.Minute))
+	w.failed(err, start.Add(2*time.Minute))
+	if w.status.FailingSince != start || w.status.LastErrorAt != start.Add(2*time.Minute) {
+		t.Errorf("failing since %s, last error %s; want one failure from the start", w.status.FailingSince, w.status.LastErrorAt)
+	}
+	if w.status.Healthy(start.Add(2*time.Minute + time.Second)) {
+		t.Error("watch failing for over the grace reported healthy")
+	}
+
+	// An event ends the failure
+	w.status.LastEvent = start.Add(3 * time.Minute)
+	if !w.status.Healthy(start.Add(3 * time.Minute)) {
+		t.Error("watch delivering events again reported unhealthy")
+	}
+	w.failed(err, start.Add(4*time.Minute))
+	if w.status.FailingSince != start.Add(4*time.Minute) {
+		t.Errorf("failing since %s after an event, want the new error", w.status.FailingSince)
+	}
+
+	// So does a quiet spell longer than the grace
+	w.failed(err, start.Add(10*time.Minute))
+	if w.status.FailingSince != start.Add(10*time.Minute) {
+		t.Errorf("failing since %s after a quiet spell, want the new error", w.status.FailingSince)
+	}
+}
+
+func TestRoutineWatchError(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{apierrors.NewResourceExpired("too old resource version: 100 (200)"), true},
+		{apierrors.NewGone("gone"), true},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("connection refused"), false},
+		{apierrors.NewForbidden(pods, "", errors.New("no list access")), false},
+		{fmt.Errorf("wrapped: %w", io.EOF), false},
+	}
+	for _, tt := range tests {
+		if got := routineWatchError(tt.err); got != tt.want {
+			t.Errorf("routineWatchError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// summaryConcurrency bounds how many nodes' summaries are fetched at once
+const summaryConcurrency = 8
+
+// kubeletSummarySource reads usage from each kubelet's Summary API through
+// the API server's node proxy, which needs get on nodes/proxy
+type kubeletSummarySource struct {
+	client *Client
+}
+
+func (s *kubeletSummarySource) Name() string {
+	return "kubelet"
+}
+
+// Available checks that the summary of one node can be read
+func (s *kubeletSummarySource) Available(ctx context.Context) error {
+	nodes, err := s.nodeNames()
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return errors.New("no nodes to read kubelet summaries from")
+	}
+	_, err = s.summary(ctx, nodes[0])
+	return err
+}
+
+// Fetch reads the summary of every node
+func (s *kubeletSummarySource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	nodes, err := s.nodeNames()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*kubeletSummary, len(nodes))
+	errs := make([]error, len(nodes))
+	sem := make(chan struct{}, summaryConcurrency)
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summaries[i], errs[i] = s.summary(ctx, node)
+		}()
+	}
+	wg.Wait()
+
+	// Nodes that are down don't stop the others from being reported
+	sample := &MetricsSample{}
+	var failed []error
+	for i, summary := range summaries {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		sample.Nodes = append(sample.Nodes, summary.Node.usage())
+		for _, pod := range summary.Pods {
+			sample.Pods = append(sample.Pods, pod.usage())
+		}
+	}
+	if len(failed) > 0 {
+		if len(failed) == len(nodes) {
+			return nil, errors.Join(failed...)
+		}
+		log.Printf("Skipped kubelet summaries of %d of %d nodes: %v", len(failed), len(nodes), errors.Join(failed...))
+	}
+	return sample, nil
+}
+
+// nodeNames lists the nodes in the watch cache
+func (s *kubeletSummarySource) nodeNames() ([]string, error) {
+	nodes, err := s.client.informers.Core().V1().Nodes().Lister().List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached nodes: %w", err)
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// summary fetches the Summary API of one node's kubelet
+func (s *kubeletSummarySource) summary(ctx context.Context, node string) (*kubeletSummary, error) {
+	data, err := s.client.Clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").Name(node).SubResource("proxy").Suffix("stats/summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubelet summary of node %s: %w", node, err)
+	}
+
+	var summary kubeletSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet summary of node %s: %w", node, err)
+	}
+	return &summary, nil
+}
+
+// kubeletSummary is the part of the kubelet's stats/v1alpha1 Summary used here
+type kubeletSummary struct {
+	Node summaryNode  `json:"node"`
+	Pods []summaryPod `json:"pods"`
+}
+
+type summaryNode struct {
+	NodeName string         `json:"nodeName"`
+	CPU      *summaryCPU    `json:"cpu"`
+	Memory   *summaryMemory `json:"memory"`
+	Network  *summaryNet    `json:"network"`
+	FS       *summaryFS     `json:"fs"`
+}
+
+type summaryPod struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	CPU        *summaryCPU `json:"cpu"`
+	Network    *summaryNet `json:"network"`
+	Containers []struct {
+		Name   string         `json:"name"`
+		CPU    *summaryCPU    `json:"cpu"`
+		Memory *summaryMemory `json:"memory"`
+	} `json:"containers"`
+	Volumes          []summaryVolume `json:"volume"`
+	EphemeralStorage *summaryFS      `json:"ephemeral-storage"`
+}
+
+type summaryCPU struct {
+	Time           time.Time `json:"time"`
+	UsageNanoCores *uint64   `json:"usageNanoCores"`
+}
+
+type summaryMemory struct {
+	WorkingSetBytes *uint64 `json:"workingSetBytes"`
+}
+
+type summaryNet struct {
+	Time    time.Time `json:"time"`
+	RxBytes *uint64   `json:"rxBytes"`
+	TxBytes *uint64   `json:"txBytes"`
+}
+
+type summaryFS struct {
+	UsedBytes     *uint64 `json:"usedBytes"`
+	CapacityBytes *uint64 `json:"capacityBytes"`
+}
+
+type summaryVolume struct {
+	Name string `json:"name"`
+	summaryFS
+}
+
+// millicores converts CPU usage, 0 when not reported
+func (c *summaryCPU) millicores() float64 {
+	if c == nil || c.UsageNanoCores == nil {
+		return 0
+	}
+	return float64(*c.UsageNanoCores) / 1000000
+}
+
+// megabytes converts memory usage like metrics-server, 0 when not reported
+func (m *summaryMemory) megabytes() float64 {
+	if m == nil || m.WorkingSetBytes == nil {
+		return 0
+	}
+	return float64(*m.WorkingSetBytes) / (1024 * 1024)
+}
+
+func (n *summaryNet) counters() *NetworkCounters {
+	if n == nil || n.RxBytes == nil || n.TxBytes == nil {
+		return nil
+	}
+	return &NetworkCounters{RxBytes: *n.RxBytes, TxBytes: *n.TxBytes, Time: n.Time}
+}
+
+func (f *summaryFS) usage() *FilesystemUsage {
+	if f == nil || f.UsedBytes == nil {
+		return nil
+	}
+	usage := &FilesystemUsage{UsedBytes: *f.UsedBytes}
+	if f.CapacityBytes != nil {
+		usage.CapacityBytes = *f.CapacityBytes
+	}
+	return usage
+}
+
+func (n summaryNode) usage() NodeUsage {
+	usage := NodeUsage{
+		Name:       n.NodeName,
+		CPU:        n.CPU.millicores(),
+		Memory:     n.Memory.megabytes(),
+		Network:    n.Network.counters(),
+		Filesystem: n.FS.usage(),
+	}
+	if n.CPU != nil {
+		usage.Timestamp = n.CPU.Time
+	}
+	return usage
+}
+
+func (p summaryPod) usage() PodUsage {
+	usage := PodUsage{
+		Namespace:  p.PodRef.Namespace,
+		Name:       p.PodRef.Name,
+		Network:    p.Network.counters(),
+		Filesystem: p.EphemeralStorage.usage(),
+		Containers: make([]ContainerMetricsData, 0, len(p.Containers)),
+	}
+	if p.CPU != nil {
+		usage.Timestamp = p.CPU.Time
+	}
+
+	for _, container := range p.Containers {
+		usage.Containers = append(usage.Containers, ContainerMetricsData{
+			Name:   container.Name,
+			CPU:    container.CPU.millicores(),
+			Memory: container.Memory.megabytes(),
+		})
+	}
+
+	// Totals as metrics-server reports them: the sum of the containers
+	for _, container := range usage.Containers {
+		usage.CPU += container.CPU
+		usage.Memory += container.Memory
+	}
+
+	for _, volume := range p.Volumes {
+		if fs := volume.usage(); fs != nil {
+			usage.Volumes = append(usage.Volumes, VolumeUsage{Name: volume.Name, UsedBytes: fs.UsedBytes, CapacityBytes: fs.CapacityBytes})
+		}
+	}
+	return usage
+}
@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newTestSummarySource creates a kubelet summary source for the given nodes
+// whose API server proxies stats/summary requests to summaries, keyed by node.
+// Nodes without a summary answer with a 503.
+func newTestSummarySource(t *testing.T, nodes []string, summaries map[string]string) *kubeletSummarySource {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node, ok := strings.CutPrefix(r.URL.Path, "/api/v1/nodes/")
+		node, ok2 := strings.CutSuffix(node, "/proxy/stats/summary")
+		if !ok || !ok2 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		summary, ok := summaries[node]
+		if !ok {
+			http.Error(w, "kubelet unreachable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, summary)
+	}))
+	t.Cleanup(server.Close)
+
+	var objects []runtime.Object
+	for _, node := range nodes {
+		objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: node}})
+	}
+	c, _ := newFakeClient(t, LayoutRing, objects...)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Clientset = clientset
+
+	c.informers.Core().V1().Nodes().Informer()
+	c.informers.Start(c.ctx.Done())
+	c.informers.WaitForCacheSync(c.ctx.Done())
+	return &kubeletSummarySource{client: c}
+}
+
+const nodeASummary = `{
+  "node": {
+    "nodeName": "node-a",
+    "cpu": {"time": "2024-05-01T10:00:00Z", "usageNanoCores": 1500000000},
+    "memory": {"workingSetBytes": 2147483648},
+    "network": {"time": "2024-05-01T10:00:00Z", "rxBytes": 1000, "txBytes": 2000},
+    "fs": {"usedBytes": 8192, "capacityBytes": 65536}
+  },
+  "pods": [
+    {
+      "podRef": {"name": "web", "namespace": "default"},
+      "cpu": {"time": "2024-05-01T10:00:01Z", "usageNanoCores": 999999999},
+      "network": {"time": "2024-05-01T10:00:01Z", "rxBytes": 300, "txBytes": 400},
+      "containers": [
+        {"name": "app", "cpu": {"usageNanoCores": 100000000}, "memory": {"workingSetBytes": 67108864}},
+        {"name": "proxy", "cpu": {"usageNanoCores": 50000000}, "memory": {"workingSetBytes": 16777216}}
+      ],
+      "volume": [
+        {"name": "data", "usedBytes": 512, "capacityBytes": 1024},
+        {"name": "empty"}
+      ],
+      "ephemeral-storage": {"usedBytes": 4096}
+    },
+    {
+      "podRef": {"name": "starting", "namespace": "default"},
+      "containers": [{"name": "app"}]
+    }
+  ]
+}`
+
+const nodeBSummary = `{
+  "node": {"nodeName": "node-b", "cpu": {"usageNanoCores": 500000000}},
+  "pods": [{"podRef": {"name": "dns", "namespace": "kube-system"}, "containers": []}]
+}`
+
+func TestKubeletSummarySourceFetch(t *testing.T) {
+	source := newTestSummarySource(t, []string{"node-a", "node-b"}, map[string]string{
+		"node-a": nodeASummary,
+		"node-b": nodeBSummary,
+	})
+
+	sample, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample.Nodes) != 2 || len(sample.Pods) != 3 {
+		t.Fatalf("got %d nodes and %d pods, want 2 and 3", len(sample.Nodes), len(sample.Pods))
+	}
+
+	node := sample.Nodes[0]
+	if node.Name != "node-a" || node.CPU != 1500 || node.Memory != 2048 {
+		t.Errorf("node %s uses %vm CPU and %vMB, want node-a with 1500m and 2048MB", node.Name, node.CPU, node.Memory)
+	}
+	if node.Network == nil || node.Network.RxBytes != 1000 || node.Network.TxBytes != 2000 {
+		t.Errorf("node network %+v, want 1000 received and 2000 sent", node.Network)
+	}
+	if node.Filesystem == nil || *node.Filesystem != (FilesystemUsage{UsedBytes: 8192, CapacityBytes: 65536}) {
+		t.Errorf("node filesystem %+v", node.Filesystem)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC); !node.Timestamp.Equal(want) {
+		t.Errorf("node timestamp %s, want %s", node.Timestamp, want)
+	}
+
+	// Pod totals are the sum of the containers, not the pod's own CPU
+	web := sample.Pods[0]
+	if web.Namespace != "default" || web.Name != "web" || web.CPU != 150 || web.Memory != 80 {
+		t.Errorf("pod %s/%s uses %vm CPU and %vMB, want default/web with 150m and 80MB", web.Namespace, web.Name, web.CPU, web.Memory)
+	}
+	if len(web.Containers) != 2 ||
+		web.Containers[0] != (ContainerMetricsData{Name: "app", CPU: 100, Memory: 64}) ||
+		web.Containers[1] != (ContainerMetricsData{Name: "proxy", CPU: 50, Memory: 16}) {
+		t.Errorf("web containers %+v", web.Containers)
+	}
+	if web.Network == nil || web.Network.RxBytes != 300 || web.Network.TxBytes != 400 {
+		t.Errorf("web network %+v, want 300 received and 400 sent", web.Network)
+	}
+	if web.Filesystem == nil || web.Filesystem.UsedBytes != 4096 || web.Filesystem.CapacityBytes != 0 {
+		t.Errorf("web filesystem %+v, want 4096 bytes used", web.Filesystem)
+	}
+	if len(web.Volumes) != 1 || web.Volumes[0] != (VolumeUsage{Name: "data", UsedBytes: 512, CapacityBytes: 1024}) {
+		t.Errorf("web volumes %+v, want only data", web.Volumes)
+	}
+
+	// Stats not reported yet are left out rather than read as zero
+	starting := sample.Pods[1]
+	if starting.Name != "starting" || starting.CPU != 0 || starting.Network != nil || starting.Filesystem != nil || !starting.Timestamp.IsZero() {
+		t.Errorf("starting pod %+v, want no usage", starting)
+	}
+	if sample.Nodes[1].Name != "node-b" || sample.Nodes[1].Network != nil || sample.Nodes[1].Filesystem != nil {
+		t.Errorf("node-b %+v, want CPU only", sample.Nodes[1])
+	}
+	if sample.Pods[2].Namespace != "kube-system" || sample.Pods[2].Name != "dns" {
+		t.Errorf("third pod %s/%s, want kube-system/dns", sample.Pods[2].Namespace, sample.Pods[2].Name)
+	}
+}
+
+func TestKubeletSummarySourceSkipsFailedNodes(t *testing.T) {
+	source := newTestSummarySource(t, []string{"node-a", "node-b", "node-c"}, map[string]string{
+		"node-a": nodeASummary,
+		"node-c": "{not json",
+	})
+
+	sample, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch with one node up: %v", err)
+	}
+	if len(sample.Nodes) != 1 || sample.Nodes[0].Name != "node-a" || len(sample.Pods) != 2 {
+		t.Errorf("got nodes %+v and %d pods, want node-a's", sample.Nodes, len(sample.Pods))
+	}
+
+	// With every node failing there is nothing to report
+	source = newTestSummarySource(t, []string{"node-b", "node-c"}, map[string]string{"node-c": "{not json"})
+	_, err = source.Fetch(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "node-b") || !strings.Contains(err.Error(), "failed to parse kubelet summary of node node-c") {
+		t.Errorf("Fetch with all nodes failing = %v, want an error naming both", err)
+	}
+}
+
+func TestKubeletSummarySourceAvailable(t *testing.T) {
+	if err := newTestSummarySource(t, []string{"node-a"}, map[string]string{"node-a": nodeASummary}).Available(context.Background()); err != nil {
+		t.Errorf("Available() = %v", err)
+	}
+	if err := newTestSummarySource(t, []string{"node-a"}, nil).Available(context.Background()); err == nil {
+		t.Error("unreachable kubelet reported available")
+	}
+	if err := newTestSummarySource(t, nil, nil).Available(context.Background()); err == nil {
+		t.Error("cluster without nodes reported available")
+	}
+}
@@ -0,0 +1,484 @@
+package k8s
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/craigderington/lantern/internal/config"
+)
+
+// LayoutStrategy selects how nodes and pods are arranged in 3D space
+type LayoutStrategy string
+
+const (
+	// LayoutRing places nodes on a circle with pods orbiting each node
+	LayoutRing LayoutStrategy = "ring"
+	// LayoutGrid places nodes on a square grid with pods orbiting each node
+	LayoutGrid LayoutStrategy = "grid"
+	// LayoutByNamespace places nodes on a circle and stacks each namespace's pods in its own orbit layer
+	LayoutByNamespace LayoutStrategy = "by-namespace"
+	// LayoutByZone clusters nodes by their topology zone label
+	LayoutByZone LayoutStrategy = "by-zone"
+)
+
+// ZoneLabel is the well-known node label used by the by-zone layout
+const ZoneLabel = "topology.kubernetes.io/zone"
+
+// LayoutChange lists the nodes and pods whose positions changed as a side
+// effect of an add or delete, keyed by node name and pod ID
+type LayoutChange struct {
+	Nodes map[string]Position `json:"nodes,omitempty"`
+	Pods  map[string]Position `json:"pods,omitempty"`
+}
+
+// Empty reports whether the change moved nothing
+func (lc LayoutChange) Empty() bool {
+	return len(lc.Nodes) == 0 && len(lc.Pods) == 0
+}
+
+// LayoutNode identifies a node for layout purposes
+type LayoutNode struct {
+	Name string
+	Zone string
+}
+
+// LayoutPod identifies a pod for layout purposes
+type LayoutPod struct {
+	ID        string
+	Namespace string
+	Name      string
+	NodeName  string
+}
+
+// podPlacement records which orbit slot a pod occupies
+type podPlacement struct {
+	node  string
+	group string
+	slot  int
+}
+
+// slotGroup is a set of orbit slots around a node; under by-namespace each
+// namespace on a node gets its own group on a separate layer
+type slotGroup struct {
+	node  string
+	layer int
+	slots []string // pod IDs, "" marks a free slot
+}
+
+// Layout owns the positions of nodes and pods. Positions are stable: a pod keeps
+// its orbit slot until it is deleted, and adding or deleting a pod never moves
+// its siblings; a freed slot is taken by the next pod placed on the node. Node
+// positions only change when nodes join or leave.
+type Layout struct {
+	mu       sync.Mutex
+	strategy LayoutStrategy
+	geometry config.Layout
+
+	nodes         map[string]string // node name -> zone
+	nodePositions map[string]Position
+	groups        map[string]*slotGroup
+	layers        map[string][]string // node name -> group key per layer
+	pods          map[string]podPlacement
+}
+
+// NewLayout creates an empty layout using the configured strategy and spacing
+func NewLayout(cfg config.Layout) (*Layout, error) {
+	strategy := LayoutStrategy(cfg.Strategy)
+	switch strategy {
+	case LayoutRing, LayoutGrid, LayoutByNamespace, LayoutByZone:
+	default:
+		return nil, fmt.Errorf("unknown layout strategy %q", strategy)
+	}
+
+	return &Layout{
+		strategy:      strategy,
+		geometry:      cfg,
+		nodes:         make(map[string]string),
+		nodePositions: make(map[string]Position),
+		groups:        make(map[string]*slotGroup),
+		layers:        make(map[string][]string),
+		pods:          make(map[string]podPlacement),
+	}, nil
+}
+
+// Strategy returns the layout strategy in use
+func (l *Layout) Strategy() LayoutStrategy {
+	return l.strategy
+}
+
+// NodePosition returns the position of a node, or the origin if it is unknown
+func (l *Layout) NodePosition(name string) Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nodePositions[name]
+}
+
+// PodPosition returns the position of a pod that has been placed
+func (l *Layout) PodPosition(id string) (Position, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	placement, ok := l.pods[id]
+	if !ok {
+		return Position{}, false
+	}
+	return l.podPosition(placement), true
+}
+
+// AddNode adds or updates a node, reflowing the other nodes if needed
+func (l *Layout) AddNode(node LayoutNode) LayoutChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if zone, ok := l.nodes[node.Name]; ok && zone == node.Zone {
+		return LayoutChange{}
+	}
+	l.nodes[node.Name] = node.Zone
+	return l.reflowNodes()
+}
+
+// RemoveNode removes a node, reflowing the remaining nodes
+func (l *Layout) RemoveNode(name string) LayoutChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.nodes[name]; !ok {
+		return LayoutChange{}
+	}
+	delete(l.nodes, name)
+	return l.reflowNodes()
+}
+
+// PlacePod assigns a pod an orbit slot if it does not have one yet, or moves it
+// when it was rescheduled to another node, and returns its position
+func (l *Layout) PlacePod(pod LayoutPod) Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	group := l.groupKey(pod.NodeName, pod.Namespace)
+	if placement, ok := l.pods[pod.ID]; ok {
+		if placement.group == group {
+			return l.podPosition(placement)
+		}
+		l.removePod(pod.ID)
+	}
+	return l.podPosition(l.placePod(pod.ID, pod.NodeName, group))
+}
+
+// RemovePod frees a pod's orbit slot. Other pods stay where they are.
+func (l *Layout) RemovePod(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.removePod(id)
+}
+
+// Reconcile brings the layout in line with a full listing of nodes and pods.
+// Unknown nodes and pods are added in sorted
+// order so that the same cluster always produces the same layout; anything no
+// longer listed is removed.
+func (l *Layout) Reconcile(nodes []LayoutNode, pods []LayoutPod) LayoutChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	change := LayoutChange{}
+	if nodes != nil {
+		listed := make(map[string]string, len(nodes))
+		for _, node := range nodes {
+			listed[node.Name] = node.Zone
+		}
+
+		nodesChanged := len(listed) != len(l.nodes)
+		for name, zone := range listed {
+			if current, ok := l.nodes[name]; !ok || current != zone {
+				nodesChanged = true
+			}
+		}
+		if nodesChanged {
+			l.nodes = listed
+			change = l.reflowNodes()
+		}
+	}
+
+	if pods != nil {
+		listed := make(map[string]bool, len(pods))
+		for _, pod := range pods {
+			listed[pod.ID] = true
+		}
+		for _, id := range l.sortedPodIDs() {
+			if !listed[id] {
+				l.removePod(id)
+			}
+		}
+
+		sorted := make([]LayoutPod, len(pods))
+		copy(sorted, pods)
+		sort.Slice(sorted, func(i, j int) bool {
+			if sorted[i].Namespace != sorted[j].Namespace {
+				return sorted[i].Namespace < sorted[j].Namespace
+			}
+			return sorted[i].Name < sorted[j].Name
+		})
+
+		for _, pod := range sorted {
+			group := l.groupKey(pod.NodeName, pod.Namespace)
+			if placement, ok := l.pods[pod.ID]; ok {
+				if placement.group == group {
+					continue
+				}
+				l.removePod(pod.ID)
+			}
+			placement := l.placePod(pod.ID, pod.NodeName, group)
+			if change.Pods == nil {
+				change.Pods = make(map[string]Position)
+			}
+			change.Pods[pod.ID] = l.podPosition(placement)
+		}
+	}
+
+	return change
+}
+
+// groupKey returns the slot group a pod belongs to
+func (l *Layout) groupKey(node, namespace string) string {
+	if l.strategy == LayoutByNamespace {
+		return node + "/" + namespace
+	}
+	return node
+}
+
+// placePod puts a pod into the first free slot of its group
+func (l *Layout) placePod(id, node, groupKey string) podPlacement {
+	group, ok := l.groups[groupKey]
+	if !ok {
+		group = &slotGroup{node: node, layer: l.claimLayer(node, groupKey)}
+		l.groups[groupKey] = group
+	}
+
+	slot := -1
+	for i, occupant := range group.slots {
+		if occupant == "" {
+			slot = i
+			break
+		}
+	}
+	if slot < 0 {
+		slot = len(group.slots)
+		group.slots = append(group.slots, "")
+	}
+	group.slots[slot] = id
+
+	placement := podPlacement{node: node, group: groupKey, slot: slot}
+	l.pods[id] = placement
+	return placement
+}
+
+// removePod frees a pod's slot, dropping free slots from the end of its group
+func (l *Layout) removePod(id string) {
+	placement, ok := l.pods[id]
+	if !ok {
+		return
+	}
+	delete(l.pods, id)
+
+	group := l.groups[placement.group]
+	group.slots[placement.slot] = ""
+	for len(group.slots) > 0 && group.slots[len(group.slots)-1] == "" {
+		group.slots = group.slots[:len(group.slots)-1]
+	}
+
+	if len(group.slots) == 0 {
+		delete(l.groups, placement.group)
+		l.releaseLayer(placement.node, placement.group)
+	}
+}
+
+// claimLayer assigns a group the lowest free vertical layer on its node
+func (l *Layout) claimLayer(node, groupKey string) int {
+	layers := l.layers[node]
+	for i, occupant := range layers {
+		if occupant == "" {
+			layers[i] = groupKey
+			return i
+		}
+	}
+	l.layers[node] = append(layers, groupKey)
+	return len(layers)
+}
+
+// releaseLayer frees the layer held by a group
+func (l *Layout) releaseLayer(node, groupKey string) {
+	layers := l.layers[node]
+	for i, occupant := range layers {
+		if occupant == groupKey {
+			layers[i] = ""
+		}
+	}
+	for len(layers) > 0 && layers[len(layers)-1] == "" {
+		layers = layers[:len(layers)-1]
+	}
+	if len(layers) == 0 {
+		delete(l.layers, node)
+		return
+	}
+	l.layers[node] = layers
+}
+
+// podPosition computes a pod's position from its slot and its node's position
+func (l *Layout) podPosition(placement podPlacement) Position {
+	nodePos := l.nodePositions[placement.node]
+	group := l.groups[placement.group]
+
+	// Find the orbit the slot falls on; orbit k holds (k+1)*PodOrbitCapacity slots
+	orbit, index, capacity := 0, placement.slot, l.geometry.PodOrbitCapacity
+	for index >= capacity {
+		index -= capacity
+		orbit++
+		capacity = (orbit + 1) * l.geometry.PodOrbitCapacity
+	}
+
+	// Stagger successive orbits so pods don't line up radially
+	angle := (float64(index) + 0.5*float64(orbit%2)) * 2.0 * math.Pi / float64(capacity)
+	radius := l.geometry.PodOrbitRadius + float64(orbit)*l.geometry.PodOrbitSpacing
+
+	return Position{
+		X: nodePos.X + radius*math.Cos(angle),
+		Y: nodePos.Y + float64(group.layer)*l.geometry.LayerHeight,
+		Z: nodePos.Z + radius*math.Sin(angle),
+	}
+}
+
+// reflowNodes recomputes every node position and reports what moved
+func (l *Layout) reflowNodes() LayoutChange {
+	names := make([]string, 0, len(l.nodes))
+	for name := range l.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var positions map[string]Position
+	switch l.strategy {
+	case LayoutGrid:
+		positions = l.gridPositions(names)
+	case LayoutByZone:
+		positions = l.zonePositions(names, l.nodes)
+	default:
+		positions = l.ringPositions(names, Position{}, l.geometry.MinRingRadius)
+	}
+
+	change := LayoutChange{}
+	moved := make(map[string]bool)
+	for _, name := range names {
+		if old, ok := l.nodePositions[name]; ok && old == positions[name] {
+			continue
+		}
+		if change.Nodes == nil {
+			change.Nodes = make(map[string]Position)
+		}
+		change.Nodes[name] = positions[name]
+		moved[name] = true
+	}
+	// Pods left behind by a removed node fall back to the origin
+	for name := range l.nodePositions {
+		if _, ok := positions[name]; !ok {
+			moved[name] = true
+		}
+	}
+	l.nodePositions = positions
+
+	// Pods follow their node
+	for id, placement := range l.pods {
+		if moved[placement.node] {
+			if change.Pods == nil {
+				change.Pods = make(map[string]Position)
+			}
+			change.Pods[id] = l.podPosition(placement)
+		}
+	}
+
+	return change
+}
+
+// sortedPodIDs returns the IDs of all placed pods in a stable order
+func (l *Layout) sortedPodIDs() []string {
+	ids := make([]string, 0, len(l.pods))
+	for id := range l.pods {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ringPositions spaces nodes evenly on a circle around center
+func (l *Layout) ringPositions(names []string, center Position, minRadius float64) map[string]Position {
+	positions := make(map[string]Position, len(names))
+	if len(names) == 1 && minRadius < l.geometry.MinRingRadius {
+		positions[names[0]] = center
+		return positions
+	}
+
+	radius := math.Max(minRadius, float64(len(names))*l.geometry.NodeSpacing/(2.0*math.Pi))
+	for i, name := range names {
+		angle := float64(i) * 2.0 * math.Pi / float64(len(names))
+		positions[name] = Position{
+			X: center.X + radius*math.Cos(angle),
+			Y: center.Y,
+			Z: center.Z + radius*math.Sin(angle),
+		}
+	}
+	return positions
+}
+
+// gridPositions lays nodes out row by row on a square grid centered on the origin
+func (l *Layout) gridPositions(names []string) map[string]Position {
+	positions := make(map[string]Position, len(names))
+	cols := int(math.Ceil(math.Sqrt(float64(len(names)))))
+	if cols == 0 {
+		return positions
+	}
+	rows := (len(names) + cols - 1) / cols
+
+	for i, name := range names {
+		row, col := i/cols, i%cols
+		positions[name] = Position{
+			X: (float64(col) - float64(cols-1)/2.0) * l.geometry.NodeSpacing,
+			Y: 0,
+			Z: (float64(row) - float64(rows-1)/2.0) * l.geometry.NodeSpacing,
+		}
+	}
+	return positions
+}
+
+// zonePositions places each zone on an outer ring and its nodes on a small ring around it
+func (l *Layout) zonePositions(names []string, zones map[string]string) map[string]Position {
+	byZone := make(map[string][]string)
+	for _, name := range names {
+		byZone[zones[name]] = append(byZone[zones[name]], name)
+	}
+
+	zoneNames := make([]string, 0, len(byZone))
+	nodeSpacing, minZoneRadius := l.geometry.NodeSpacing, l.geometry.MinZoneRadius
+	maxZoneRadius := minZoneRadius
+	for zone, members := range byZone {
+		zoneNames = append(zoneNames, zone)
+		maxZoneRadius = math.Max(maxZoneRadius, float64(len(members))*nodeSpacing/(2.0*math.Pi))
+	}
+	sort.Strings(zoneNames)
+
+	centers := map[string]Position{}
+	if len(zoneNames) == 1 {
+		centers[zoneNames[0]] = Position{}
+	} else {
+		// Keep neighbouring zones far enough apart that their node rings don't overlap
+		centers = l.ringPositions(zoneNames, Position{}, math.Max(l.geometry.MinRingRadius, (2*maxZoneRadius+nodeSpacing)*float64(len(zoneNames))/(2.0*math.Pi)))
+	}
+
+	positions := make(map[string]Position, len(names))
+	for _, zone := range zoneNames {
+		for name, pos := range l.ringPositions(byZone[zone], centers[zone], minZoneRadius) {
+			positions[name] = pos
+		}
+	}
+	return positions
+}
@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+
+	"github.com/craigderington/lantern/internal/config"
+)
+
+var layoutStrategies = []LayoutStrategy{LayoutRing, LayoutGrid, LayoutByNamespace, LayoutByZone}
+
+func newTestLayout(t *testing.T, strategy LayoutStrategy) *Layout {
+	t.Helper()
+	cfg := config.Default().Layout
+	cfg.Strategy = string(strategy)
+	layout, err := NewLayout(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layout
+}
+
+func testCluster() ([]LayoutNode, []LayoutPod) {
+	nodes := []LayoutNode{
+		{Name: "node-a", Zone: "zone-1"},
+		{Name: "node-b", Zone: "zone-1"},
+		{Name: "node-c", Zone: "zone-2"},
+	}
+	var pods []LayoutPod
+	for i := 0; i < 30; i++ {
+		pods = append(pods, LayoutPod{
+			ID:        fmt.Sprintf("uid-%02d", i),
+			Namespace: []string{"default", "kube-system", "web"}[(i/3)%3],
+			Name:      fmt.Sprintf("pod-%02d", i),
+			NodeName:  nodes[i%len(nodes)].Name,
+		})
+	}
+	return nodes, pods
+}
+
+func TestLayoutPodChurnKeepsSiblings(t *testing.T) {
+	for _, strategy := range layoutStrategies {
+		t.Run(string(strategy), func(t *testing.T) {
+			nodes, pods := testCluster()
+			layout := newTestLayout(t, strategy)
+			layout.Reconcile(nodes, pods)
+
+			positions := func() map[string]Position {
+				placed := make(map[string]Position)
+				for _, pod := range pods {
+					if position, ok := layout.PodPosition(pod.ID); ok {
+						placed[pod.ID] = position
+					}
+				}
+				return placed
+			}
+			before := positions()
+
+			added := LayoutPod{ID: "uid-new", Namespace: "default", Name: "new", NodeName: "node-a"}
+			layout.PlacePod(added)
+			if after := positions(); !maps.Equal(before, after) {
+				t.Fatalf("adding a pod moved its siblings")
+			}
+
+			// Removing a pod from the middle of an orbit leaves the others in place
+			removed := pods[3]
+			freed := before[removed.ID]
+			layout.RemovePod(removed.ID)
+			delete(before, removed.ID)
+			if after := positions(); !maps.Equal(before, after) {
+				t.Fatalf("removing a pod moved its siblings")
+			}
+
+			// The next pod in the same orbit takes the freed slot
+			replacement := LayoutPod{ID: "uid-replacement", Namespace: removed.Namespace, Name: "replacement", NodeName: removed.NodeName}
+			if got := layout.PlacePod(replacement); got != freed {
+				t.Errorf("replacement placed at %v, want the freed slot at %v", got, freed)
+			}
+		})
+	}
+}
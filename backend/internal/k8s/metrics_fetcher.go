@@ -1,60 +1,138 @@
 package k8s
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/craigderington/lantern/internal/config"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // PodMetricsData represents metrics for a single pod
 type PodMetricsData struct {
-	PodID            string                   `json:"podId"`
-	Name             string                   `json:"name"`
-	Namespace        string                   `json:"namespace"`
-	TotalCPU         float64                  `json:"totalCpu"`
-	TotalMemory      float64                  `json:"totalMemory"`
-	ContainerMetrics []ContainerMetricsData   `json:"containers"`
-	Timestamp        time.Time                `json:"timestamp"`
+	PodID            string                 `json:"podId"`
+	Name             string                 `json:"name"`
+	Namespace        string                 `json:"namespace"`
+	Workload         string                 `json:"workload,omitempty"` // e.g. "Deployment/web"
+	Labels           map[string]string      `json:"-"`                  // for label selector subscriptions
+	TotalCPU         float64                `json:"totalCpu"`
+	TotalMemory      float64                `json:"totalMemory"`
+	ContainerMetrics []ContainerMetricsData `json:"containers"`
+	Restarts         *int32                 `json:"restarts,omitempty"` // only from sources that report it, e.g. Prometheus
+	Network          *NetworkRates          `json:"network,omitempty"`
+	Filesystem       *FilesystemUsage       `json:"filesystem,omitempty"` // ephemeral storage
+	Volumes          []VolumeUsage          `json:"volumes,omitempty"`
+	Timestamp        time.Time              `json:"timestamp"`
 }
 
 // MetricsUpdate represents a batch metrics update
 type MetricsUpdate struct {
-	Type      string            `json:"type"`
-	Pods      []PodMetricsData  `json:"pods"`
-	Timestamp time.Time         `json:"timestamp"`
+	Type      string           `json:"type"`
+	Pods      []PodMetricsData `json:"pods"`
+	Nodes     []NodeMetrics    `json:"nodes,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
 }
 
 // MetricsFetcher periodically fetches and broadcasts pod metrics
 type MetricsFetcher struct {
-	client   *Client
-	interval time.Duration
-	stop     chan struct{}
+	client     *Client
+	source     MetricsSource
+	bufferSize int
+
+	// interval is read by the fetch loop after a signal on reset
+	interval atomic.Int64
+	reset    chan struct{}
+
+	mu     sync.RWMutex
+	latest *MetricsUpdate
+	status MetricsStatus
+
+	// Metrics from the latest fetch for the metrics endpoints, by namespace/name and node name
+	pods  map[string]PodMetrics
+	nodes map[string]NodeMetrics
+
+	// Network counters from previous fetches, by pod UID or node name. Only used by the fetch loop.
+	rates map[string]networkRate
+}
+
+// networkRate is the last network counters seen for a pod or node and the
+// rates computed from them
+type networkRate struct {
+	counters NetworkCounters
+	rates    *NetworkRates
+}
+
+// MetricsStatus reports how recently metrics were fetched
+type MetricsStatus struct {
+	// Source is the metrics source in use
+	Source      string        `json:"source"`
+	Interval    time.Duration `json:"-"`
+	LastSuccess time.Time     `json:"lastSuccess,omitzero"`
+	LastError   string        `json:"lastError,omitempty"`
+	LastErrorAt time.Time     `json:"lastErrorAt,omitzero"`
 }
 
-// NewMetricsFetcher creates a new metrics fetcher
-func NewMetricsFetcher(client *Client, interval time.Duration) *MetricsFetcher {
-	return &MetricsFetcher{
-		client:   client,
-		interval: interval,
-		stop:     make(chan struct{}),
+// Healthy reports whether the last fetch succeeded and is no older than a
+// few intervals. Before the first fetch there is nothing to report.
+func (s MetricsStatus) Healthy(now time.Time) bool {
+	if s.LastErrorAt.After(s.LastSuccess) {
+		return false
 	}
+	return s.LastSuccess.IsZero() || now.Sub(s.LastSuccess) <= 3*s.Interval
+}
+
+// NewMetricsFetcher creates a new metrics fetcher reading from source
+func NewMetricsFetcher(client *Client, source MetricsSource, cfg *config.Config) *MetricsFetcher {
+	mf := &MetricsFetcher{
+		client:     client,
+		source:     source,
+		bufferSize: cfg.Stream.BufferSize,
+		reset:      make(chan struct{}, 1),
+	}
+	mf.interval.Store(int64(cfg.Metrics.Interval.Duration))
+	return mf
+}
+
+// Reconfigure prepares the fetcher for a reloaded configuration; a new
+// interval takes effect from the next tick
+func (mf *MetricsFetcher) Reconfigure(cfg *config.Config) (func(), error) {
+	interval := int64(cfg.Metrics.Interval.Duration)
+	return func() {
+		if mf.interval.Swap(interval) == interval {
+			return
+		}
+		select {
+		case mf.reset <- struct{}{}:
+		default:
+		}
+	}, nil
 }
 
-// Start begins the periodic metrics collection
-func (mf *MetricsFetcher) Start() <-chan MetricsUpdate {
-	updates := make(chan MetricsUpdate, 256)
+// Start begins the periodic metrics collection. The updates channel is
+// closed once ctx is cancelled.
+func (mf *MetricsFetcher) Start(ctx context.Context) <-chan MetricsUpdate {
+	updates := make(chan MetricsUpdate, mf.bufferSize)
 
 	go func() {
-		ticker := time.NewTicker(mf.interval)
+		ticker := time.NewTicker(time.Duration(mf.interval.Load()))
 		defer ticker.Stop()
 		defer close(updates)
 
 		for {
 			select {
 			case <-ticker.C:
-				mf.fetchAndBroadcast(updates)
-			case <-mf.stop:
+				mf.fetchAndBroadcast(ctx, updates)
+			case <-mf.reset:
+				interval := time.Duration(mf.interval.Load())
+				ticker.Reset(interval)
+				log.Printf("Metrics fetcher interval changed to %s", interval)
+			case <-ctx.Done():
 				log.Println("Metrics fetcher stopped")
 				return
 			}
@@ -64,55 +142,223 @@ func (mf *MetricsFetcher) Start() <-chan MetricsUpdate {
 	return updates
 }
 
-// Stop halts the metrics fetcher
-func (mf *MetricsFetcher) Stop() {
-	close(mf.stop)
+// Latest returns the most recent metrics update, or nil if none was fetched yet
+func (mf *MetricsFetcher) Latest() *MetricsUpdate {
+	mf.mu.RLock()
+	defer mf.mu.RUnlock()
+	return mf.latest
 }
 
-// fetchAndBroadcast fetches metrics for all pods
-func (mf *MetricsFetcher) fetchAndBroadcast(updates chan<- MetricsUpdate) {
-	// Get all pods
-	pods, err := mf.client.Clientset.CoreV1().Pods("").List(mf.client.ctx, metav1.ListOptions{})
+// Status returns the outcome of recent fetches
+func (mf *MetricsFetcher) Status() MetricsStatus {
+	mf.mu.RLock()
+	defer mf.mu.RUnlock()
+	status := mf.status
+	status.Source = mf.source.Name()
+	status.Interval = time.Duration(mf.interval.Load())
+	return status
+}
+
+// PodMetrics returns a pod's usage from the latest fetch
+func (mf *MetricsFetcher) PodMetrics(namespace, name string) (*PodMetrics, bool) {
+	mf.mu.RLock()
+	defer mf.mu.RUnlock()
+	metrics, ok := mf.pods[namespace+"/"+name]
+	if !ok {
+		return nil, false
+	}
+	return &metrics, true
+}
+
+// NodeMetrics returns a node's usage from the latest fetch
+func (mf *MetricsFetcher) NodeMetrics(name string) (*NodeMetrics, bool) {
+	mf.mu.RLock()
+	defer mf.mu.RUnlock()
+	metrics, ok := mf.nodes[name]
+	if !ok {
+		return nil, false
+	}
+	return &metrics, true
+}
+
+// networkRates computes transfer rates from a pod or node's cumulative
+// counters and those of the previous fetch, recording them in next. Rates
+// are unknown on the first fetch and after the counters were reset.
+func (mf *MetricsFetcher) networkRates(key string, counters *NetworkCounters, fetchedAt time.Time, next map[string]networkRate) *NetworkRates {
+	if counters == nil {
+		return nil
+	}
+	current := *counters
+	if current.Time.IsZero() {
+		current.Time = fetchedAt
+	}
+
+	previous, ok := mf.rates[key]
+	switch {
+	case !ok || current.RxBytes < previous.counters.RxBytes || current.TxBytes < previous.counters.TxBytes:
+		next[key] = networkRate{counters: current}
+	case !current.Time.After(previous.counters.Time):
+		// The source hasn't refreshed the counters since the last fetch
+		next[key] = previous
+	default:
+		seconds := current.Time.Sub(previous.counters.Time).Seconds()
+		next[key] = networkRate{
+			counters: current,
+			rates: &NetworkRates{
+				RxBytesPerSecond: float64(current.RxBytes-previous.counters.RxBytes) / seconds,
+				TxBytesPerSecond: float64(current.TxBytes-previous.counters.TxBytes) / seconds,
+			},
+		}
+	}
+	return next[key].rates
+}
+
+// recordResult updates the fetch status with the outcome of a fetch
+func (mf *MetricsFetcher) recordResult(err error) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	if err != nil {
+		mf.status.LastError = err.Error()
+		mf.status.LastErrorAt = time.Now()
+		return
+	}
+	mf.status.LastSuccess = time.Now()
+}
+
+// fetchAndBroadcast fetches metrics for all pods and nodes. A fetch is given
+// up to one interval, after which the next one is due anyway.
+func (mf *MetricsFetcher) fetchAndBroadcast(ctx context.Context, updates chan<- MetricsUpdate) {
+	fetchCtx, cancel := context.WithTimeout(ctx, time.Duration(mf.interval.Load()))
+	defer cancel()
+	sample, err := mf.source.Fetch(fetchCtx)
+	if ctx.Err() != nil {
+		// Stopping
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching metrics from %s: %v", mf.source.Name(), err)
+		mf.recordResult(err)
+		return
+	}
+	fetchedAt := time.Now()
+
+	// Match usage to the watched pods for their IDs, workloads and labels
+	pods, err := mf.client.informers.Core().V1().Pods().Lister().List(labels.Everything())
 	if err != nil {
 		log.Printf("Error listing pods for metrics: %v", err)
+		mf.recordResult(err)
 		return
 	}
 
-	podMetrics := make([]PodMetricsData, 0, len(pods.Items))
+	// A pod recreated under the same name has new counters, so pods' rates are
+	// kept by UID. Pods not in the watch cache yet get rates from the next fetch.
+	uids := make(map[string]string, len(pods))
+	for _, pod := range pods {
+		uids[pod.Namespace+"/"+pod.Name] = string(pod.UID)
+	}
 
-	for _, pod := range pods.Items {
-		// Fetch metrics for this pod
-		metrics, err := mf.client.GetPodMetrics(pod.Namespace, pod.Name)
-		if err != nil {
-			// Metrics might not be available for all pods (pending, completed, etc.)
-			// Log at debug level and skip
-			continue
+	rates := make(map[string]networkRate, len(sample.Pods)+len(sample.Nodes))
+
+	podUsage := make(map[string]PodUsage, len(sample.Pods))
+	podEndpoint := make(map[string]PodMetrics, len(sample.Pods))
+	for _, usage := range sample.Pods {
+		key := usage.Namespace + "/" + usage.Name
+		var network *NetworkRates
+		if uid, ok := uids[key]; ok {
+			network = mf.networkRates("pod/"+uid, usage.Network, fetchedAt, rates)
+		}
+		podUsage[key] = usage
+		podEndpoint[key] = PodMetrics{
+			Name:        usage.Name,
+			Namespace:   usage.Namespace,
+			CPUUsage:    usage.CPU,
+			MemoryUsage: usage.Memory,
+			Network:     network,
+			Filesystem:  usage.Filesystem,
+			Volumes:     usage.Volumes,
+			Timestamp:   usage.Timestamp.Format(time.RFC3339),
 		}
+	}
 
-		// Also get per-container metrics
-		containerMetrics, err := mf.client.GetPodMetricsDetailed(pod.Namespace, pod.Name)
-		if err != nil {
-			// Skip if detailed metrics not available
+	nodeMetrics := make([]NodeMetrics, 0, len(sample.Nodes))
+	nodeEndpoint := make(map[string]NodeMetrics, len(sample.Nodes))
+	for _, usage := range sample.Nodes {
+		metrics := NodeMetrics{
+			Name:        usage.Name,
+			CPUUsage:    usage.CPU,
+			MemoryUsage: usage.Memory,
+			Network:     mf.networkRates("node/"+usage.Name, usage.Network, fetchedAt, rates),
+			Filesystem:  usage.Filesystem,
+			Timestamp:   usage.Timestamp.Format(time.RFC3339),
+		}
+		nodeMetrics = append(nodeMetrics, metrics)
+		nodeEndpoint[usage.Name] = metrics
+	}
+	sort.Slice(nodeMetrics, func(i, j int) bool { return nodeMetrics[i].Name < nodeMetrics[j].Name })
+	mf.rates = rates
+
+	podMetrics := make([]PodMetricsData, 0, len(sample.Pods))
+	for _, pod := range pods {
+		// Metrics might not be available for all pods (pending, completed, etc.)
+		key := pod.Namespace + "/" + pod.Name
+		usage, ok := podUsage[key]
+		if !ok {
 			continue
 		}
 
+		_, owner := convertOwnerReferences(pod.OwnerReferences)
+
 		podMetrics = append(podMetrics, PodMetricsData{
 			PodID:            string(pod.UID),
 			Name:             pod.Name,
 			Namespace:        pod.Namespace,
-			TotalCPU:         metrics.CPUUsage,
-			TotalMemory:      metrics.MemoryUsage,
-			ContainerMetrics: containerMetrics,
-			Timestamp:        time.Now(),
+			Workload:         WorkloadName(pod.Name, owner, pod.Labels),
+			Labels:           maps.Clone(pod.Labels),
+			TotalCPU:         usage.CPU,
+			TotalMemory:      usage.Memory,
+			ContainerMetrics: usage.Containers,
+			Restarts:         usage.Restarts,
+			Network:          podEndpoint[key].Network,
+			Filesystem:       usage.Filesystem,
+			Volumes:          usage.Volumes,
+			Timestamp:        fetchedAt,
 		})
 	}
+	sort.Slice(podMetrics, func(i, j int) bool {
+		if podMetrics[i].Namespace != podMetrics[j].Namespace {
+			return podMetrics[i].Namespace < podMetrics[j].Namespace
+		}
+		return podMetrics[i].Name < podMetrics[j].Name
+	})
+
+	if len(podMetrics) == 0 && len(pods) > 0 {
+		mf.recordResult(fmt.Errorf("%s reported no metrics for any of %d pods", mf.source.Name(), len(pods)))
+	} else {
+		mf.recordResult(nil)
+	}
+
+	mf.mu.Lock()
+	mf.pods = podEndpoint
+	mf.nodes = nodeEndpoint
+	mf.mu.Unlock()
 
-	if len(podMetrics) > 0 {
-		updates <- MetricsUpdate{
+	if len(podMetrics) > 0 || len(nodeMetrics) > 0 {
+		update := MetricsUpdate{
 			Type:      "metrics_update",
 			Pods:      podMetrics,
+			Nodes:     nodeMetrics,
 			Timestamp: time.Now(),
 		}
-		log.Printf("Broadcasted metrics for %d pods", len(podMetrics))
+
+		mf.mu.Lock()
+		mf.latest = &update
+		mf.mu.Unlock()
+
+		select {
+		case updates <- update:
+		case <-ctx.Done():
+			return
+		}
+		log.Printf("Broadcasted metrics for %d pods and %d nodes", len(podMetrics), len(nodeMetrics))
 	}
 }
@@ -0,0 +1,209 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// blockingSource hands each fetch's context to the test and waits for it to be done
+type blockingSource struct {
+	fetches chan context.Context
+}
+
+func (s *blockingSource) Name() string                        { return "blocking" }
+func (s *blockingSource) Available(ctx context.Context) error { return nil }
+
+func (s *blockingSource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	s.fetches <- ctx
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMetricsFetcherStopsFetchWithStartContext(t *testing.T) {
+	cfg := config.Default()
+	interval := 50 * time.Millisecond
+	cfg.Metrics.Interval = metav1.Duration{Duration: interval}
+
+	// The client outlives the fetcher
+	client, err := NewClientForConfig(context.Background(), cfg, &rest.Config{Host: "http://localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &blockingSource{fetches: make(chan context.Context, 1)}
+	fetcher := NewMetricsFetcher(client, source, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := fetcher.Start(ctx)
+
+	fetchCtx := <-source.fetches
+	deadline, ok := fetchCtx.Deadline()
+	if !ok || time.Until(deadline) > interval {
+		t.Errorf("fetch deadline in %s, want at most one interval", time.Until(deadline))
+	}
+
+	cancel()
+	select {
+	case <-fetchCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch not cancelled with the Start context")
+	}
+	if !errors.Is(fetchCtx.Err(), context.Canceled) {
+		t.Errorf("fetch ended with %v, want it cancelled", fetchCtx.Err())
+	}
+
+	for range updates {
+		t.Error("update sent after the fetch was cancelled")
+	}
+	if status := fetcher.Status(); status.LastError != "" {
+		t.Errorf("cancelled fetch recorded as an error: %s", status.LastError)
+	}
+}
+
+func TestNetworkRates(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int, rx, tx uint64) *NetworkCounters {
+		return &NetworkCounters{RxBytes: rx, TxBytes: tx, Time: start.Add(time.Duration(seconds) * time.Second)}
+	}
+
+	tests := []struct {
+		name    string
+		samples []*NetworkCounters
+		want    []*NetworkRates
+	}{
+		{
+			name:    "first sample",
+			samples: []*NetworkCounters{at(0, 1000, 2000)},
+			want:    []*NetworkRates{nil},
+		},
+		{
+			name:    "steady state",
+			samples: []*NetworkCounters{at(0, 1000, 2000), at(10, 2000, 2500), at(20, 2000, 4500)},
+			want:    []*NetworkRates{nil, {RxBytesPerSecond: 100, TxBytesPerSecond: 50}, {RxBytesPerSecond: 0, TxBytesPerSecond: 200}},
+		},
+		{
+			name:    "counter reset",
+			samples: []*NetworkCounters{at(0, 1000, 2000), at(10, 50, 2500), at(20, 1050, 3500)},
+			want:    []*NetworkRates{nil, nil, {RxBytesPerSecond: 100, TxBytesPerSecond: 100}},
+		},
+		{
+			name:    "zero time delta",
+			samples: []*NetworkCounters{at(0, 1000, 2000), at(10, 2000, 3000), at(10, 2000, 3000), at(10, 9000, 9000)},
+			want:    []*NetworkRates{nil, {RxBytesPerSecond: 100, TxBytesPerSecond: 100}, {RxBytesPerSecond: 100, TxBytesPerSecond: 100}, {RxBytesPerSecond: 100, TxBytesPerSecond: 100}},
+		},
+		{
+			name:    "not reported",
+			samples: []*NetworkCounters{at(0, 1000, 2000), nil, at(20, 3000, 4000)},
+			want:    []*NetworkRates{nil, nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mf := &MetricsFetcher{}
+			for i, counters := range tt.samples {
+				next := make(map[string]networkRate)
+				got := mf.networkRates("pod/uid-web", counters, start, next)
+				mf.rates = next
+
+				want := tt.want[i]
+				if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+					t.Errorf("sample %d: rates %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	// Counters without a time of their own are timed by the fetch
+	mf := &MetricsFetcher{}
+	next := make(map[string]networkRate)
+	mf.networkRates("node/node-a", &NetworkCounters{RxBytes: 0}, start, next)
+	mf.rates, next = next, make(map[string]networkRate)
+	got := mf.networkRates("node/node-a", &NetworkCounters{RxBytes: 500}, start.Add(5*time.Second), next)
+	if got == nil || got.RxBytesPerSecond != 100 {
+		t.Errorf("rates %+v, want 100 bytes per second received", got)
+	}
+}
+
+// scriptedSource returns its samples one fetch at a time
+type scriptedSource struct {
+	samples []*MetricsSample
+}
+
+func (s *scriptedSource) Name() string                        { return "scripted" }
+func (s *scriptedSource) Available(ctx context.Context) error { return nil }
+
+func (s *scriptedSource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	sample := s.samples[0]
+	s.samples = s.samples[1:]
+	return sample, nil
+}
+
+func TestMetricsFetcherKeysRatesByPodUID(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	web := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", UID: "uid-1"}}
+	client, clientset := newFakeClient(t, LayoutRing, web)
+	informer := client.informers.Core().V1().Pods().Informer()
+	client.informers.Start(client.ctx.Done())
+	client.informers.WaitForCacheSync(client.ctx.Done())
+
+	usage := func(seconds int, rx uint64) *MetricsSample {
+		return &MetricsSample{Pods: []PodUsage{{
+			Namespace: "default",
+			Name:      "web-0",
+			Network:   &NetworkCounters{RxBytes: rx, TxBytes: rx, Time: start.Add(time.Duration(seconds) * time.Second)},
+		}}}
+	}
+	source := &scriptedSource{samples: []*MetricsSample{usage(0, 1000), usage(10, 2000), usage(20, 5000)}}
+	cfg := config.Default()
+	fetcher := NewMetricsFetcher(client, source, cfg)
+	updates := make(chan MetricsUpdate, 3)
+
+	fetcher.fetchAndBroadcast(context.Background(), updates)
+	fetcher.fetchAndBroadcast(context.Background(), updates)
+	if metrics, _ := fetcher.PodMetrics("default", "web-0"); metrics == nil || metrics.Network == nil || metrics.Network.RxBytesPerSecond != 100 {
+		t.Fatalf("web-0 metrics %+v, want 100 bytes per second received", metrics)
+	}
+
+	// The pod is recreated under the same name with higher counters
+	if err := clientset.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), "default", "web-0"); err != nil {
+		t.Fatal(err)
+	}
+	recreated := web.DeepCopy()
+	recreated.UID = types.UID("uid-2")
+	if _, err := clientset.CoreV1().Pods("default").Create(context.Background(), recreated, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		obj, ok, _ := informer.GetStore().GetByKey("default/web-0")
+		if ok && obj.(*corev1.Pod).UID == "uid-2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("recreated pod not in the watch cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fetcher.fetchAndBroadcast(context.Background(), updates)
+	metrics, _ := fetcher.PodMetrics("default", "web-0")
+	if metrics == nil || metrics.Network != nil {
+		t.Errorf("recreated pod's metrics %+v, want no rates until its second fetch", metrics)
+	}
+	update := <-updates
+	for len(updates) > 0 {
+		update = <-updates
+	}
+	if len(update.Pods) != 1 || update.Pods[0].PodID != "uid-2" || update.Pods[0].Network != nil {
+		t.Errorf("update %+v, want uid-2 without rates", update.Pods)
+	}
+}
@@ -0,0 +1,142 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsServerPath is the metrics.k8s.io API served by metrics-server
+const metricsServerPath = "/apis/metrics.k8s.io/v1beta1"
+
+// metricsServerSource reads usage from the metrics.k8s.io API
+type metricsServerSource struct {
+	client *Client
+}
+
+func (s *metricsServerSource) Name() string {
+	return "metrics-server"
+}
+
+// Available checks that the metrics.k8s.io API is registered and its backend answers
+func (s *metricsServerSource) Available(ctx context.Context) error {
+	_, err := s.client.Clientset.RESTClient().Get().AbsPath(metricsServerPath).DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("metrics.k8s.io API not available: %w", err)
+	}
+	return nil
+}
+
+// metricsServerUsage is the usage of a pod container or node in the metrics.k8s.io API
+type metricsServerUsage struct {
+	CPU    string `json:"cpu"`
+	Memory string `json:"memory"`
+}
+
+// Fetch lists the metrics of every pod and node, one request each
+func (s *metricsServerSource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	var podList struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Timestamp  time.Time `json:"timestamp"`
+			Containers []struct {
+				Name  string             `json:"name"`
+				Usage metricsServerUsage `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err := s.get(ctx, "/pods", &podList); err != nil {
+		return nil, fmt.Errorf("failed to get pod metrics: %w", err)
+	}
+
+	var nodeList struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Timestamp time.Time          `json:"timestamp"`
+			Usage     metricsServerUsage `json:"usage"`
+		} `json:"items"`
+	}
+	if err := s.get(ctx, "/nodes", &nodeList); err != nil {
+		return nil, fmt.Errorf("failed to get node metrics: %w", err)
+	}
+
+	sample := &MetricsSample{
+		Pods:  make([]PodUsage, 0, len(podList.Items)),
+		Nodes: make([]NodeUsage, 0, len(nodeList.Items)),
+	}
+	for _, item := range podList.Items {
+		pod := PodUsage{
+			Namespace:  item.Metadata.Namespace,
+			Name:       item.Metadata.Name,
+			Containers: make([]ContainerMetricsData, 0, len(item.Containers)),
+			Timestamp:  item.Timestamp,
+		}
+		for _, container := range item.Containers {
+			cpu := parseMetricValue(container.Usage.CPU, "cpu")
+			memory := parseMetricValue(container.Usage.Memory, "memory")
+			pod.CPU += cpu
+			pod.Memory += memory
+			pod.Containers = append(pod.Containers, ContainerMetricsData{
+				Name:   container.Name,
+				CPU:    cpu,
+				Memory: memory,
+			})
+		}
+		sample.Pods = append(sample.Pods, pod)
+	}
+	for _, item := range nodeList.Items {
+		sample.Nodes = append(sample.Nodes, NodeUsage{
+			Name:      item.Metadata.Name,
+			CPU:       parseMetricValue(item.Usage.CPU, "cpu"),
+			Memory:    parseMetricValue(item.Usage.Memory, "memory"),
+			Timestamp: item.Timestamp,
+		})
+	}
+	return sample, nil
+}
+
+// get decodes a list from the metrics.k8s.io API
+func (s *metricsServerSource) get(ctx context.Context, resource string, into interface{}) error {
+	data, err := s.client.Clientset.RESTClient().Get().AbsPath(metricsServerPath + resource).DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return nil
+}
+
+// parseMetricValue parses Kubernetes metric values into float64
+func parseMetricValue(value string, metricType string) float64 {
+	if metricType == "cpu" {
+		if strings.HasSuffix(value, "n") {
+			// nanocores to millicores
+			val, _ := strconv.ParseFloat(strings.TrimSuffix(value, "n"), 64)
+			return val / 1000000
+		} else if strings.HasSuffix(value, "m") {
+			// millicores
+			val, _ := strconv.ParseFloat(strings.TrimSuffix(value, "m"), 64)
+			return val
+		}
+	} else if metricType == "memory" {
+		if strings.HasSuffix(value, "Ki") {
+			// KiB to MB
+			val, _ := strconv.ParseFloat(strings.TrimSuffix(value, "Ki"), 64)
+			return val / 1024
+		} else if strings.HasSuffix(value, "Mi") {
+			// MiB
+			val, _ := strconv.ParseFloat(strings.TrimSuffix(value, "Mi"), 64)
+			return val
+		}
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+)
+
+// MetricsSource reads the resource usage of the cluster's pods and nodes
+type MetricsSource interface {
+	// Name identifies the source in logs and status reports
+	Name() string
+	// Available reports why the source can't be used in this cluster, if it can't
+	Available(ctx context.Context) error
+	// Fetch reads the current usage of every pod and node the source knows about
+	Fetch(ctx context.Context) (*MetricsSample, error)
+}
+
+// MetricsSample is the usage read from a metrics source at one point in time
+type MetricsSample struct {
+	Pods  []PodUsage
+	Nodes []NodeUsage
+}
+
+// PodUsage is the resource usage of one pod
+type PodUsage struct {
+	Namespace  string
+	Name       string
+	CPU        float64 // millicores
+	Memory     float64 // MB
+	Containers []ContainerMetricsData
+	// Network and Filesystem are nil when the source doesn't report them
+	Network    *NetworkCounters
+	Filesystem *FilesystemUsage
+	Volumes    []VolumeUsage
+	// Restarts is the pod's container restart count, if the source reports it
+	Restarts  *int32
+	Timestamp time.Time
+}
+
+// NodeUsage is the resource usage of one node
+type NodeUsage struct {
+	Name       string
+	CPU        float64 // millicores
+	Memory     float64 // MB
+	Network    *NetworkCounters
+	Filesystem *FilesystemUsage
+	Timestamp  time.Time
+}
+
+// NetworkCounters are cumulative bytes received and sent since the pod or
+// node started. The fetcher turns them into rates.
+type NetworkCounters struct {
+	RxBytes uint64
+	TxBytes uint64
+	// Time the counters were read, if the source reports it
+	Time time.Time
+}
+
+// NetworkRates are bytes per second received and sent between two fetches
+type NetworkRates struct {
+	RxBytesPerSecond float64 `json:"rxBytesPerSecond"`
+	TxBytesPerSecond float64 `json:"txBytesPerSecond"`
+}
+
+// FilesystemUsage is the space used on a pod's ephemeral storage or a node's root filesystem
+type FilesystemUsage struct {
+	UsedBytes     uint64 `json:"usedBytes"`
+	CapacityBytes uint64 `json:"capacityBytes,omitempty"` // 0 when unknown
+}
+
+// VolumeUsage is the space used on one of a pod's volumes
+type VolumeUsage struct {
+	Name          string `json:"name"`
+	UsedBytes     uint64 `json:"usedBytes"`
+	CapacityBytes uint64 `json:"capacityBytes,omitempty"`
+}
+
+// NewMetricsSource creates the metrics source named by cfg.Source
+func NewMetricsSource(client *Client, cfg config.Metrics) (MetricsSource, error) {
+	switch cfg.Source {
+	case "metrics-server":
+		return &metricsServerSource{client: client}, nil
+	case "kubelet":
+		return &kubeletSummarySource{client: client}, nil
+	case "prometheus":
+		return NewPrometheusSource(cfg.Prometheus)
+	case "auto", "":
+		return &fallbackSource{
+			primary:  &metricsServerSource{client: client},
+			fallback: &kubeletSummarySource{client: client},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown metrics source %q", cfg.Source)
+	}
+}
+
+// fallbackRecheckInterval is how often the primary source is retried while the fallback is in use
+const fallbackRecheckInterval = time.Minute
+
+// fallbackSource reads from the primary source, switching to the fallback
+// while the primary is unavailable, e.g. metrics-server isn't installed
+type fallbackSource struct {
+	primary  MetricsSource
+	fallback MetricsSource
+
+	mu        sync.Mutex
+	active    MetricsSource
+	checkedAt time.Time
+}
+
+// Name returns the name of the source in use
+func (s *fallbackSource) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return s.primary.Name()
+	}
+	return s.active.Name()
+}
+
+// Available reports whether either source can be used
+func (s *fallbackSource) Available(ctx context.Context) error {
+	if err := s.primary.Available(ctx); err == nil {
+		return nil
+	}
+	return s.fallback.Available(ctx)
+}
+
+// Fetch reads from the source in use, falling back if the primary fails
+func (s *fallbackSource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	source := s.choose(ctx)
+	sample, err := source.Fetch(ctx)
+	if err == nil || source == s.fallback {
+		return sample, err
+	}
+
+	log.Printf("Metrics source %s failed, falling back to %s: %v", s.primary.Name(), s.fallback.Name(), err)
+	s.use(s.fallback)
+	return s.fallback.Fetch(ctx)
+}
+
+// choose returns the source to read from, checking whether the primary
+// became available once in a while when the fallback is in use
+func (s *fallbackSource) choose(ctx context.Context) MetricsSource {
+	s.mu.Lock()
+	active, checkedAt := s.active, s.checkedAt
+	s.mu.Unlock()
+
+	if active == s.primary || (active != nil && time.Since(checkedAt) < fallbackRecheckInterval) {
+		return active
+	}
+
+	if err := s.primary.Available(ctx); err != nil {
+		if active == nil {
+			log.Printf("Metrics source %s unavailable, using %s: %v", s.primary.Name(), s.fallback.Name(), err)
+		}
+		s.use(s.fallback)
+		return s.fallback
+	}
+	if active != nil {
+		log.Printf("Metrics source %s available again, switching from %s", s.primary.Name(), s.fallback.Name())
+	}
+	s.use(s.primary)
+	return s.primary
+}
+
+func (s *fallbackSource) use(source MetricsSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = source
+	s.checkedAt = time.Now()
+}
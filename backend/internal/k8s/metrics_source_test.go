@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource is a metrics source whose availability and fetches are set by the test
+type fakeSource struct {
+	name string
+
+	mu           sync.Mutex
+	availableErr error
+	fetchErr     error
+	fetches      int
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) Available(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.availableErr
+}
+
+func (s *fakeSource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	if s.fetchErr != nil {
+		return nil, s.fetchErr
+	}
+	return &MetricsSample{Nodes: []NodeUsage{{Name: s.name}}}, nil
+}
+
+// set changes the errors the source returns
+func (s *fakeSource) set(availableErr, fetchErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.availableErr, s.fetchErr = availableErr, fetchErr
+}
+
+// fetchFrom fetches from s, returning the name of the source that answered
+func fetchFrom(t *testing.T, s *fallbackSource) string {
+	t.Helper()
+	sample, err := s.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sample.Nodes[0].Name
+}
+
+func TestFallbackSourceSwitchesOnError(t *testing.T) {
+	primary, fallback := &fakeSource{name: "metrics-server"}, &fakeSource{name: "kubelet"}
+	s := &fallbackSource{primary: primary, fallback: fallback}
+
+	if got := fetchFrom(t, s); got != "metrics-server" || s.Name() != "metrics-server" {
+		t.Errorf("fetched from %s, want metrics-server", got)
+	}
+
+	// A failed fetch is retried from the fallback at once
+	primary.set(nil, errors.New("the server is currently unable to handle the request"))
+	if got := fetchFrom(t, s); got != "kubelet" || s.Name() != "kubelet" {
+		t.Errorf("fetched from %s after the primary failed, want kubelet", got)
+	}
+
+	// Within the recheck interval the primary isn't tried again
+	primary.set(nil, nil)
+	fetches := primary.fetches
+	if got := fetchFrom(t, s); got != "kubelet" || primary.fetches != fetches {
+		t.Errorf("fetched from %s before the recheck, want kubelet", got)
+	}
+
+	// Once it is due, the primary is back in use if available
+	s.checkedAt = time.Now().Add(-fallbackRecheckInterval)
+	if got := fetchFrom(t, s); got != "metrics-server" || s.Name() != "metrics-server" {
+		t.Errorf("fetched from %s after the recheck, want metrics-server", got)
+	}
+}
+
+func TestFallbackSourceRecheckKeepsFallback(t *testing.T) {
+	primary, fallback := &fakeSource{name: "metrics-server"}, &fakeSource{name: "kubelet"}
+	primary.set(errors.New("metrics.k8s.io not served"), nil)
+	s := &fallbackSource{primary: primary, fallback: fallback}
+
+	// An unavailable primary is never fetched from
+	if got := fetchFrom(t, s); got != "kubelet" || primary.fetches != 0 {
+		t.Errorf("fetched from %s, want kubelet", got)
+	}
+
+	s.checkedAt = time.Now().Add(-fallbackRecheckInterval)
+	checkedAt := s.checkedAt
+	if got := fetchFrom(t, s); got != "kubelet" || primary.fetches != 0 {
+		t.Errorf("fetched from %s after the recheck, want kubelet", got)
+	}
+	if !s.checkedAt.After(checkedAt) {
+		t.Error("recheck not recorded")
+	}
+}
+
+func TestFallbackSourceFallbackError(t *testing.T) {
+	primary, fallback := &fakeSource{name: "metrics-server"}, &fakeSource{name: "kubelet"}
+	primary.set(nil, errors.New("primary failed"))
+	fallback.set(nil, errors.New("fallback failed"))
+	s := &fallbackSource{primary: primary, fallback: fallback}
+
+	if _, err := s.Fetch(context.Background()); err == nil || err.Error() != "fallback failed" {
+		t.Errorf("Fetch() = %v, want the fallback's error", err)
+	}
+	if primary.fetches != 1 || fallback.fetches != 1 {
+		t.Errorf("fetched %d times from the primary and %d from the fallback, want once each", primary.fetches, fallback.fetches)
+	}
+
+	// Available while either source is
+	if err := s.Available(context.Background()); err != nil {
+		t.Errorf("Available() = %v", err)
+	}
+	primary.set(errors.New("primary unavailable"), nil)
+	fallback.set(errors.New("fallback unavailable"), nil)
+	if err := s.Available(context.Background()); err == nil || err.Error() != "fallback unavailable" {
+		t.Errorf("Available() = %v, want the fallback's error", err)
+	}
+}
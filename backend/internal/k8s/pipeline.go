@@ -0,0 +1,228 @@
+package k8s
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventPodsChanged is a batch of pod changes collected by the EventPipeline
+const EventPodsChanged EventType = "pods_changed"
+
+// PodChange is a modified pod along with the fields that changed
+type PodChange struct {
+	Pod     Pod      `json:"pod"`
+	Changed []string `json:"changed"` // JSON field names, e.g. ["status", "ready"]
+
+	// Previous is the pod as last sent, so that filtered streams can tell a
+	// pod entering or leaving their filter from one changing within it
+	Previous *Pod `json:"-"`
+}
+
+// PodsChanged is every pod change seen during one batching window
+type PodsChanged struct {
+	Added    []Pod         `json:"added,omitempty"`
+	Modified []PodChange   `json:"modified,omitempty"`
+	Deleted  []Pod         `json:"deleted,omitempty"`
+	Layout   *LayoutChange `json:"layout,omitempty"`
+}
+
+// pendingPod is the net change to one pod within the current window
+type pendingPod struct {
+	pod     Pod
+	added   bool
+	deleted bool
+}
+
+// EventPipeline turns the raw watch event stream into what clients need to
+// see: pod events are batched over a short window into a single pods_changed
+// event, modifications that change nothing visible are dropped, and layout
+// moves are folded into the same batch. Node events are passed through,
+// after flushing any pending pod changes so ordering is preserved.
+type EventPipeline struct {
+	window time.Duration
+
+	// Last state sent for every pod, keyed by pod ID
+	sent map[string]Pod
+
+	pending         map[string]*pendingPod
+	order           []string // pod IDs in the order they first changed
+	layout          LayoutChange
+	resourceVersion uint64
+}
+
+// NewEventPipeline creates a pipeline batching pod changes over the given window
+func NewEventPipeline(window time.Duration) *EventPipeline {
+	return &EventPipeline{
+		window:  window,
+		sent:    make(map[string]Pod),
+		pending: make(map[string]*pendingPod),
+	}
+}
+
+// Run reads watch events until in is closed, writing batched events to out
+func (p *EventPipeline) Run(in <-chan WatchEvent, out chan<- WatchEvent) {
+	timer := time.NewTimer(p.window)
+	timer.Stop()
+	timerRunning := false
+
+	for {
+		select {
+		case event, ok := <-in:
+			if !ok {
+				p.flush(out)
+				close(out)
+				return
+			}
+
+			switch event.Type {
+			case EventPodAdded, EventPodModified, EventPodDeleted:
+				p.record(event)
+			case EventLayoutChanged:
+				p.mergeLayout(event.Layout)
+			default:
+				p.flush(out)
+				out <- event
+				continue
+			}
+
+			if !timerRunning {
+				timer.Reset(p.window)
+				timerRunning = true
+			}
+
+		case <-timer.C:
+			timerRunning = false
+			p.flush(out)
+		}
+	}
+}
+
+// record folds a pod event into the pending batch
+func (p *EventPipeline) record(event WatchEvent) {
+	if v, err := strconv.ParseUint(event.ResourceVersion, 10, 64); err == nil && v > p.resourceVersion {
+		p.resourceVersion = v
+	}
+
+	id := event.Pod.ID
+	pending, ok := p.pending[id]
+	if !ok {
+		pending = &pendingPod{}
+		p.pending[id] = pending
+		p.order = append(p.order, id)
+	}
+
+	switch event.Type {
+	case EventPodAdded:
+		pending.added = true
+	case EventPodDeleted:
+		if pending.added {
+			// Created and deleted within the window: clients never need to know,
+			// including where it was placed
+			delete(p.pending, id)
+			delete(p.layout.Pods, id)
+			return
+		}
+		pending.deleted = true
+	}
+	pending.pod = *event.Pod
+}
+
+// mergeLayout folds layout moves into the pending batch, later moves winning
+func (p *EventPipeline) mergeLayout(change *LayoutChange) {
+	if change == nil {
+		return
+	}
+	if p.layout.Nodes == nil {
+		p.layout = LayoutChange{Nodes: make(map[string]Position), Pods: make(map[string]Position)}
+	}
+	for name, position := range change.Nodes {
+		p.layout.Nodes[name] = position
+	}
+	for id, position := range change.Pods {
+		p.layout.Pods[id] = position
+	}
+}
+
+// flush sends the pending batch, if anything in it is visible to clients
+func (p *EventPipeline) flush(out chan<- WatchEvent) {
+	changes := PodsChanged{}
+	for _, id := range p.order {
+		pending, ok := p.pending[id]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case pending.deleted:
+			changes.Deleted = append(changes.Deleted, pending.pod)
+			delete(p.sent, id)
+			delete(p.layout.Pods, id)
+		case pending.added:
+			changes.Added = append(changes.Added, pending.pod)
+			p.sent[id] = pending.pod
+		default:
+			changed := DiffPods(p.sent[id], pending.pod)
+			if len(changed) == 0 {
+				continue
+			}
+			previous := p.sent[id]
+			changes.Modified = append(changes.Modified, PodChange{Pod: pending.pod, Changed: changed, Previous: &previous})
+			p.sent[id] = pending.pod
+		}
+	}
+
+	// Clients apply layout moves, so later modifications of a moved pod
+	// should not report its position as changed again
+	for id, position := range p.layout.Pods {
+		if pod, ok := p.sent[id]; ok {
+			pod.Position = position
+			p.sent[id] = pod
+		}
+	}
+	if !p.layout.Empty() {
+		layout := p.layout
+		changes.Layout = &layout
+	}
+
+	resourceVersion := p.resourceVersion
+	p.pending = make(map[string]*pendingPod)
+	p.order = nil
+	p.layout = LayoutChange{}
+	p.resourceVersion = 0
+
+	if len(changes.Added) == 0 && len(changes.Modified) == 0 && len(changes.Deleted) == 0 && changes.Layout == nil {
+		return
+	}
+
+	event := WatchEvent{Type: EventPodsChanged, Changes: &changes}
+	if resourceVersion > 0 {
+		event.ResourceVersion = strconv.FormatUint(resourceVersion, 10)
+	}
+	out <- event
+}
+
+// DiffPods returns the JSON names of the fields that differ between two pods
+func DiffPods(before, after Pod) []string {
+	var changed []string
+
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(after)
+	podType := beforeValue.Type()
+	for i := 0; i < podType.NumField(); i++ {
+		if !reflect.DeepEqual(beforeValue.Field(i).Interface(), afterValue.Field(i).Interface()) {
+			changed = append(changed, jsonFieldName(podType.Field(i)))
+		}
+	}
+	return changed
+}
+
+// jsonFieldName returns the name a struct field is encoded as
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// startPipeline runs a pipeline, returning its input and output
+func startPipeline(t *testing.T, window time.Duration) (chan<- WatchEvent, <-chan WatchEvent) {
+	t.Helper()
+	in := make(chan WatchEvent, 16)
+	out := make(chan WatchEvent, 16)
+	go NewEventPipeline(window).Run(in, out)
+	t.Cleanup(func() { close(in) })
+	return in, out
+}
+
+// next waits for the pipeline's next event
+func next(t *testing.T, out <-chan WatchEvent) WatchEvent {
+	t.Helper()
+	select {
+	case event := <-out:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event from the pipeline")
+		return WatchEvent{}
+	}
+}
+
+func podEvent(eventType EventType, pod Pod, resourceVersion string) WatchEvent {
+	return WatchEvent{Type: eventType, Pod: &pod, ResourceVersion: resourceVersion}
+}
+
+func TestPipelineBatchesWindow(t *testing.T) {
+	in, out := startPipeline(t, 50*time.Millisecond)
+	web, api := Pod{ID: "uid-web", Name: "web"}, Pod{ID: "uid-api", Name: "api"}
+
+	in <- podEvent(EventPodAdded, web, "10")
+	in <- podEvent(EventPodAdded, api, "12")
+	in <- WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Pods: map[string]Position{"uid-web": {X: 1}}}}
+
+	event := next(t, out)
+	if event.Type != EventPodsChanged || event.ResourceVersion != "12" {
+		t.Fatalf("got %s at %q, want pods_changed at 12", event.Type, event.ResourceVersion)
+	}
+	changes := event.Changes
+	if len(changes.Added) != 2 || changes.Added[0].ID != "uid-web" || changes.Added[1].ID != "uid-api" {
+		t.Errorf("added %+v, want web then api", changes.Added)
+	}
+	if changes.Layout == nil || changes.Layout.Pods["uid-web"] != (Position{X: 1}) {
+		t.Errorf("layout %+v, want web's move", changes.Layout)
+	}
+}
+
+func TestPipelineDropsPodsAddedAndDeletedInWindow(t *testing.T) {
+	in, out := startPipeline(t, time.Hour)
+	pod := Pod{ID: "uid-web", Name: "web"}
+
+	in <- podEvent(EventPodAdded, pod, "10")
+	in <- WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Pods: map[string]Position{"uid-web": {X: 1}}}}
+	in <- podEvent(EventPodDeleted, pod, "11")
+
+	// A node event flushes the batch before being passed on
+	in <- WatchEvent{Type: EventNodeAdded, Node: &Node{Name: "node-a"}}
+	if event := next(t, out); event.Type != EventNodeAdded {
+		t.Errorf("got %s with %+v, want only node_added", event.Type, event.Changes)
+	}
+}
+
+func TestPipelineSuppressesNoOpModifications(t *testing.T) {
+	in, out := startPipeline(t, 10*time.Millisecond)
+	pod := Pod{ID: "uid-web", Name: "web", Status: "Pending"}
+
+	in <- podEvent(EventPodAdded, pod, "10")
+	next(t, out)
+
+	// Unchanged, then changed
+	in <- podEvent(EventPodModified, pod, "11")
+	in <- WatchEvent{Type: EventNodeAdded, Node: &Node{Name: "node-a"}}
+	if event := next(t, out); event.Type != EventNodeAdded {
+		t.Fatalf("no-op modification sent as %s with %+v", event.Type, event.Changes)
+	}
+
+	previous := pod
+	pod.Status, pod.Ready = "Running", true
+	in <- podEvent(EventPodModified, pod, "12")
+	event := next(t, out)
+	if event.Type != EventPodsChanged || len(event.Changes.Modified) != 1 {
+		t.Fatalf("got %s with %+v, want one modification", event.Type, event.Changes)
+	}
+	change := event.Changes.Modified[0]
+	if !slices.Equal(change.Changed, []string{"status", "ready"}) {
+		t.Errorf("changed %v, want status and ready", change.Changed)
+	}
+	if change.Previous == nil || change.Previous.Status != previous.Status {
+		t.Errorf("previous %+v, want the pod as sent before", change.Previous)
+	}
+}
+
+func TestPipelineFlushesLayoutOnlyBatch(t *testing.T) {
+	in, out := startPipeline(t, 10*time.Millisecond)
+
+	in <- WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Nodes: map[string]Position{"node-a": {X: 5}}}}
+	event := next(t, out)
+	if event.Type != EventPodsChanged || event.Changes.Layout == nil || event.Changes.Layout.Nodes["node-a"] != (Position{X: 5}) {
+		t.Fatalf("got %s with %+v, want the layout move", event.Type, event.Changes)
+	}
+	if len(event.Changes.Added)+len(event.Changes.Modified)+len(event.Changes.Deleted) != 0 || event.ResourceVersion != "" {
+		t.Errorf("layout-only batch carries %+v at %q", event.Changes, event.ResourceVersion)
+	}
+}
+
+func TestPipelineMovedPodIsNotModified(t *testing.T) {
+	in, out := startPipeline(t, 10*time.Millisecond)
+	pod := Pod{ID: "uid-web", Name: "web"}
+
+	in <- podEvent(EventPodAdded, pod, "10")
+	next(t, out)
+	in <- WatchEvent{Type: EventLayoutChanged, Layout: &LayoutChange{Pods: map[string]Position{"uid-web": {X: 1}}}}
+	next(t, out)
+
+	// Clients applied the move, so the pod at its new position changed nothing
+	pod.Position = Position{X: 1}
+	in <- podEvent(EventPodModified, pod, "11")
+	in <- WatchEvent{Type: EventNodeAdded, Node: &Node{Name: "node-a"}}
+	if event := next(t, out); event.Type != EventNodeAdded {
+		t.Errorf("got %s with %+v after the move", event.Type, event.Changes)
+	}
+}
+
+func TestDiffPods(t *testing.T) {
+	before := Pod{ID: "uid-web", Labels: map[string]string{"app": "web"}, Containers: []Container{{Name: "app"}}}
+	after := before
+	if changed := DiffPods(before, after); len(changed) != 0 {
+		t.Errorf("identical pods differ in %v", changed)
+	}
+
+	after.Labels = map[string]string{"app": "web", "tier": "frontend"}
+	after.Containers = []Container{{Name: "app", Ready: true}}
+	after.Position = Position{Y: 2}
+	if changed := DiffPods(before, after); !slices.Equal(changed, []string{"labels", "containers", "position"}) {
+		t.Errorf("changed %v, want labels, containers and position", changed)
+	}
+}
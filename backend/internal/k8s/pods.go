@@ -2,101 +2,86 @@ package k8s
 
 import (
 	"log"
-	"math"
+	"maps"
+	"unicode/utf8"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// GetPods fetches all pods from the cluster
+// GetPods fetches all pods from the cluster. Positions are read from the
+// layout without changing it: only the watchers move pods, so that every
+// move reaches WebSocket clients. Pods the watchers haven't placed yet are
+// at the origin.
 func (c *Client) GetPods() ([]Pod, error) {
 	podList, err := c.Clientset.CoreV1().Pods("").List(c.ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	// First get nodes to know their positions
-	nodes, err := c.GetNodes()
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a map of node names to their positions
-	nodePositions := make(map[string]Position)
-	for _, node := range nodes {
-		nodePositions[node.Name] = node.Position
+	pods := make([]Pod, 0, len(podList.Items))
+	for i := range podList.Items {
+		pods = append(pods, c.convertPod(&podList.Items[i]))
 	}
 
-	pods := make([]Pod, 0, len(podList.Items))
+	log.Printf("Fetched %d pods from cluster", len(pods))
+	return pods, nil
+}
 
-	// Group pods by node for positioning
-	podsByNode := make(map[string]int)
+// layoutPod extracts the fields the layout needs from a pod
+func layoutPod(pod *corev1.Pod) LayoutPod {
+	return LayoutPod{
+		ID:        string(pod.UID),
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		NodeName:  pod.Spec.NodeName,
+	}
+}
 
-	for _, pod := range podList.Items {
-		// Extract container info
-		containers := make([]Container, 0, len(pod.Status.ContainerStatuses))
-		for i, cs := range pod.Status.ContainerStatuses {
-			status := "Unknown"
-			if cs.State.Running != nil {
-				status = "Running"
-			} else if cs.State.Waiting != nil {
-				status = "Waiting"
-			} else if cs.State.Terminated != nil {
-				status = "Terminated"
-			}
+// convertOwnerReferences maps owner references to our type and picks out the controlling owner
+func convertOwnerReferences(refs []metav1.OwnerReference) ([]OwnerReference, *OwnerReference) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
 
-			containers = append(containers, Container{
-				Name:     cs.Name,
-				Status:   status,
-				Restarts: cs.RestartCount,
-				Type:     determineContainerType(cs.Name, false, i),
-				CPU:      0, // Will be updated by metrics_update events
-				Memory:   0, // Will be updated by metrics_update events
-			})
+	owners := make([]OwnerReference, 0, len(refs))
+	var controller *OwnerReference
+	for _, ref := range refs {
+		owners = append(owners, OwnerReference{
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			UID:        string(ref.UID),
+			Controller: ref.Controller != nil && *ref.Controller,
+		})
+	}
+	for i := range owners {
+		if owners[i].Controller {
+			controller = &owners[i]
+			break
 		}
+	}
 
-		// Calculate position around the node
-		nodeName := pod.Spec.NodeName
-		podIndex := podsByNode[nodeName]
-		totalPodsOnNode := 0
-
-		// Count total pods on this node for better angle distribution
-		for _, p := range podList.Items {
-			if p.Spec.NodeName == nodeName {
-				totalPodsOnNode++
-			}
-		}
+	return owners, controller
+}
 
-		// Calculate orbit angle
-		angle := float64(podIndex) * 2.0 * math.Pi / math.Max(float64(totalPodsOnNode), 1.0)
-		orbitRadius := 3.0
+// trimAnnotations copies the annotations, shortening values longer than
+// limit bytes without splitting a UTF-8 character. A limit of zero copies
+// them unchanged.
+func trimAnnotations(annotations map[string]string, limit int) map[string]string {
+	if limit <= 0 || len(annotations) == 0 {
+		return maps.Clone(annotations)
+	}
 
-		// Get node position (default to origin if not found)
-		nodePos := Position{X: 0, Y: 0, Z: 0}
-		if pos, ok := nodePositions[nodeName]; ok {
-			nodePos = pos
+	trimmed := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		if len(v) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(v[cut]) {
+				cut--
+			}
+			v = v[:cut] + "...(truncated)"
 		}
-
-		// Position pod relative to its node
-		pods = append(pods, Pod{
-			ID:         string(pod.UID),
-			Name:       pod.Name,
-			Namespace:  pod.Namespace,
-			Status:     string(pod.Status.Phase),
-			NodeName:   nodeName,
-			Containers: containers,
-			CreatedAt:  pod.CreationTimestamp.Time,
-			Position: Position{
-				X: nodePos.X + orbitRadius*math.Cos(angle),
-				Y: nodePos.Y,
-				Z: nodePos.Z + orbitRadius*math.Sin(angle),
-			},
-			CPU:    0, // Will be updated by metrics_update events
-			Memory: 0, // Will be updated by metrics_update events
-		})
-
-		podsByNode[nodeName]++
+		trimmed[k] = v
 	}
-
-	log.Printf("Fetched %d pods from cluster", len(pods))
-	return pods, nil
+	return trimmed
 }
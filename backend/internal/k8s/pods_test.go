@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTrimAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		"short": "ok",
+		"ascii": strings.Repeat("a", 20),
+		// Each "é" is two bytes, so a cut at an odd offset falls inside one
+		"utf8": strings.Repeat("é", 10),
+	}
+
+	trimmed := trimAnnotations(annotations, 7)
+	want := map[string]string{
+		"short": "ok",
+		"ascii": "aaaaaaa...(truncated)",
+		"utf8":  "ééé...(truncated)",
+	}
+	for k, v := range want {
+		if trimmed[k] != v {
+			t.Errorf("trimmed[%q] = %q, want %q", k, trimmed[k], v)
+		}
+		if !utf8.ValidString(trimmed[k]) {
+			t.Errorf("trimmed[%q] is not valid UTF-8", k)
+		}
+	}
+
+	// The result never shares the informer cache's map
+	copied := trimAnnotations(annotations, 0)
+	copied["short"] = "changed"
+	if annotations["short"] != "ok" {
+		t.Error("trimAnnotations with no limit returned the original map")
+	}
+}
@@ -0,0 +1,364 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+)
+
+// prometheusSource reads usage from the Prometheus HTTP API with a PromQL
+// query per metric
+type prometheusSource struct {
+	endpoint  string
+	tokenFile string
+	http      *http.Client
+
+	// queries is the rendered PromQL of each metric; empty ones are skipped
+	queries config.PrometheusQueries
+}
+
+// NewPrometheusSource creates a metrics source querying the Prometheus at cfg.URL
+func NewPrometheusSource(cfg config.Prometheus) (MetricsSource, error) {
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus URL: %w", err)
+	}
+
+	// Render the templates once; they only depend on the configuration
+	vars := struct{ Window string }{Window: fmt.Sprintf("%ds", int(cfg.Window.Seconds()))}
+	render := func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid Prometheus query %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, vars); err != nil {
+			return "", fmt.Errorf("invalid Prometheus query %s: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	s := &prometheusSource{
+		endpoint:  strings.TrimSuffix(cfg.URL, "/") + "/api/v1/query",
+		tokenFile: cfg.BearerTokenFile,
+		http:      &http.Client{Timeout: cfg.Timeout.Duration},
+	}
+	queries := []struct {
+		name     string
+		text     string
+		rendered *string
+	}{
+		{"containerCpu", cfg.Queries.ContainerCPU, &s.queries.ContainerCPU},
+		{"containerMemory", cfg.Queries.ContainerMemory, &s.queries.ContainerMemory},
+		{"podNetworkReceive", cfg.Queries.PodNetworkReceive, &s.queries.PodNetworkReceive},
+		{"podNetworkTransmit", cfg.Queries.PodNetworkTransmit, &s.queries.PodNetworkTransmit},
+		{"podRestarts", cfg.Queries.PodRestarts, &s.queries.PodRestarts},
+		{"podFilesystem", cfg.Queries.PodFilesystem, &s.queries.PodFilesystem},
+		{"nodeCpu", cfg.Queries.NodeCPU, &s.queries.NodeCPU},
+		{"nodeMemory", cfg.Queries.NodeMemory, &s.queries.NodeMemory},
+		{"nodeNetworkReceive", cfg.Queries.NodeNetworkReceive, &s.queries.NodeNetworkReceive},
+		{"nodeNetworkTransmit", cfg.Queries.NodeNetworkTransmit, &s.queries.NodeNetworkTransmit},
+		{"nodeFilesystem", cfg.Queries.NodeFilesystem, &s.queries.NodeFilesystem},
+	}
+	for _, q := range queries {
+		rendered, err := render(q.name, q.text)
+		if err != nil {
+			return nil, err
+		}
+		*q.rendered = rendered
+	}
+	return s, nil
+}
+
+func (s *prometheusSource) Name() string {
+	return "prometheus"
+}
+
+// Available checks that Prometheus answers queries
+func (s *prometheusSource) Available(ctx context.Context) error {
+	_, err := s.query(ctx, "vector(1)", time.Now())
+	return err
+}
+
+// promSample is one series of an instant vector
+type promSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// Fetch runs every configured query at the same evaluation time. A failed
+// query leaves its metric empty; only when all of them fail is there no sample.
+func (s *prometheusSource) Fetch(ctx context.Context) (*MetricsSample, error) {
+	now := time.Now()
+	q := s.queries
+	queries := []struct{ name, text string }{
+		{"containerCpu", q.ContainerCPU},
+		{"containerMemory", q.ContainerMemory},
+		{"podNetworkReceive", q.PodNetworkReceive},
+		{"podNetworkTransmit", q.PodNetworkTransmit},
+		{"podRestarts", q.PodRestarts},
+		{"podFilesystem", q.PodFilesystem},
+		{"nodeCpu", q.NodeCPU},
+		{"nodeMemory", q.NodeMemory},
+		{"nodeNetworkReceive", q.NodeNetworkReceive},
+		{"nodeNetworkTransmit", q.NodeNetworkTransmit},
+		{"nodeFilesystem", q.NodeFilesystem},
+	}
+
+	results := make([][]promSample, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	var run int
+	for i, query := range queries {
+		if query.text == "" {
+			continue
+		}
+		run++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.query(ctx, query.text, now)
+		}()
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", queries[i].name, err))
+		}
+	}
+	if len(failed) > 0 {
+		if len(failed) == run {
+			return nil, errors.Join(failed...)
+		}
+		log.Printf("Skipped %d of %d Prometheus queries: %v", len(failed), run, errors.Join(failed...))
+	}
+	containerCPU, containerMemory, podRx, podTx, podRestarts, podFS := results[0], results[1], results[2], results[3], results[4], results[5]
+	nodeCPU, nodeMemory, nodeRx, nodeTx, nodeFS := results[6], results[7], results[8], results[9], results[10]
+
+	// Pods, keyed by namespace/name, in the order first seen
+	pods := make(map[string]*PodUsage)
+	var podOrder []string
+	pod := func(sample promSample) *PodUsage {
+		namespace, name := sample.labels["namespace"], sample.labels["pod"]
+		if namespace == "" || name == "" {
+			return nil
+		}
+		key := namespace + "/" + name
+		if _, ok := pods[key]; !ok {
+			pods[key] = &PodUsage{Namespace: namespace, Name: name, Timestamp: now}
+			podOrder = append(podOrder, key)
+		}
+		return pods[key]
+	}
+	container := func(p *PodUsage, name string) *ContainerMetricsData {
+		for i := range p.Containers {
+			if p.Containers[i].Name == name {
+				return &p.Containers[i]
+			}
+		}
+		p.Containers = append(p.Containers, ContainerMetricsData{Name: name})
+		return &p.Containers[len(p.Containers)-1]
+	}
+
+	for _, sample := range containerCPU {
+		if p := pod(sample); p != nil && sample.labels["container"] != "" {
+			millicores := sample.value * 1000
+			container(p, sample.labels["container"]).CPU = millicores
+			p.CPU += millicores
+		}
+	}
+	for _, sample := range containerMemory {
+		if p := pod(sample); p != nil && sample.labels["container"] != "" {
+			megabytes := sample.value / (1024 * 1024)
+			container(p, sample.labels["container"]).Memory = megabytes
+			p.Memory += megabytes
+		}
+	}
+	for _, sample := range podRx {
+		if p := pod(sample); p != nil {
+			if p.Network == nil {
+				p.Network = &NetworkCounters{}
+			}
+			p.Network.RxBytes = uint64(sample.value)
+		}
+	}
+	for _, sample := range podTx {
+		if p := pod(sample); p != nil {
+			if p.Network == nil {
+				p.Network = &NetworkCounters{}
+			}
+			p.Network.TxBytes = uint64(sample.value)
+		}
+	}
+	for _, sample := range podRestarts {
+		if p := pod(sample); p != nil {
+			restarts := int32(sample.value)
+			p.Restarts = &restarts
+		}
+	}
+	for _, sample := range podFS {
+		if p := pod(sample); p != nil {
+			p.Filesystem = &FilesystemUsage{UsedBytes: uint64(sample.value)}
+		}
+	}
+
+	nodes := make(map[string]*NodeUsage)
+	var nodeOrder []string
+	node := func(sample promSample) *NodeUsage {
+		name := sample.labels["node"]
+		if name == "" {
+			return nil
+		}
+		if _, ok := nodes[name]; !ok {
+			nodes[name] = &NodeUsage{Name: name, Timestamp: now}
+			nodeOrder = append(nodeOrder, name)
+		}
+		return nodes[name]
+	}
+	for _, sample := range nodeCPU {
+		if n := node(sample); n != nil {
+			n.CPU = sample.value * 1000
+		}
+	}
+	for _, sample := range nodeMemory {
+		if n := node(sample); n != nil {
+			n.Memory = sample.value / (1024 * 1024)
+		}
+	}
+	for _, sample := range nodeRx {
+		if n := node(sample); n != nil {
+			if n.Network == nil {
+				n.Network = &NetworkCounters{}
+			}
+			n.Network.RxBytes = uint64(sample.value)
+		}
+	}
+	for _, sample := range nodeTx {
+		if n := node(sample); n != nil {
+			if n.Network == nil {
+				n.Network = &NetworkCounters{}
+			}
+			n.Network.TxBytes = uint64(sample.value)
+		}
+	}
+	for _, sample := range nodeFS {
+		if n := node(sample); n != nil {
+			n.Filesystem = &FilesystemUsage{UsedBytes: uint64(sample.value)}
+		}
+	}
+
+	sample := &MetricsSample{
+		Pods:  make([]PodUsage, 0, len(podOrder)),
+		Nodes: make([]NodeUsage, 0, len(nodeOrder)),
+	}
+	for _, key := range podOrder {
+		sample.Pods = append(sample.Pods, *pods[key])
+	}
+	for _, name := range nodeOrder {
+		sample.Nodes = append(sample.Nodes, *nodes[name])
+	}
+	return sample, nil
+}
+
+// query evaluates an instant query
+func (s *prometheusSource) query(ctx context.Context, query string, at time.Time) ([]promSample, error) {
+	form := url.Values{
+		"query": {query},
+		"time":  {strconv.FormatFloat(float64(at.UnixMilli())/1000, 'f', 3, 64)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if s.tokenFile != "" {
+		token, err := os.ReadFile(s.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Prometheus bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus query failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus query failed: %w", err)
+	}
+
+	// Errors are reported in the body with a 4xx or 5xx status
+	var result struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+		Data      struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus query failed with status %s", resp.Status)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query %q failed: %s: %s", query, result.ErrorType, result.Error)
+	}
+
+	switch result.Data.ResultType {
+	case "vector":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		}
+		if err := json.Unmarshal(result.Data.Result, &series); err != nil {
+			return nil, fmt.Errorf("failed to parse prometheus result: %w", err)
+		}
+		samples := make([]promSample, 0, len(series))
+		for _, s := range series {
+			value, err := promValue(s.Value)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, promSample{labels: s.Metric, value: value})
+		}
+		return samples, nil
+	case "scalar":
+		var value [2]interface{}
+		if err := json.Unmarshal(result.Data.Result, &value); err != nil {
+			return nil, fmt.Errorf("failed to parse prometheus result: %w", err)
+		}
+		v, err := promValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return []promSample{{value: v}}, nil
+	default:
+		return nil, fmt.Errorf("prometheus query %q returned a %s, not an instant vector", query, result.Data.ResultType)
+	}
+}
+
+// promValue parses the [timestamp, "value"] pair of a sample
+func promValue(pair [2]interface{}) (float64, error) {
+	text, ok := pair[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected prometheus sample value %v", pair[1])
+	}
+	return strconv.ParseFloat(text, 64)
+}
@@ -0,0 +1,324 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// promResponse is the fake Prometheus' answer to one query
+type promResponse struct {
+	status int
+	body   string
+}
+
+// fakePrometheus answers instant queries from responses, keyed by PromQL, and
+// records the queries and Authorization headers it receives
+type fakePrometheus struct {
+	*httptest.Server
+	mu            sync.Mutex
+	queries       []string
+	authorization []string
+}
+
+func newFakePrometheus(t *testing.T, responses map[string]promResponse) *fakePrometheus {
+	t.Helper()
+	p := &fakePrometheus{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/query" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		query := r.PostFormValue("query")
+		p.mu.Lock()
+		p.queries = append(p.queries, query)
+		p.authorization = append(p.authorization, r.Header.Get("Authorization"))
+		p.mu.Unlock()
+
+		resp, ok := responses[query]
+		if !ok {
+			resp = promResponse{http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"unknown query"}`}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		fmt.Fprint(w, resp.body)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// vector is a successful instant vector response holding the given series
+func vector(series ...string) promResponse {
+	return promResponse{http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[` + strings.Join(series, ",") + `]}}`}
+}
+
+// series is one sample of a vector with labels given as name, value pairs
+func series(value string, labels ...string) string {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%q:%q", labels[i], labels[i+1]))
+	}
+	return fmt.Sprintf(`{"metric":{%s},"value":[1700000000.000,%q]}`, strings.Join(pairs, ","), value)
+}
+
+// newTestPrometheusSource creates a source for p with the given queries
+func newTestPrometheusSource(t *testing.T, p *fakePrometheus, queries config.PrometheusQueries) *prometheusSource {
+	t.Helper()
+	source, err := NewPrometheusSource(config.Prometheus{
+		URL:     p.URL + "/",
+		Timeout: metav1.Duration{Duration: 5 * time.Second},
+		Window:  metav1.Duration{Duration: 2 * time.Minute},
+		Queries: queries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source.(*prometheusSource)
+}
+
+func TestPrometheusSourceRendersWindow(t *testing.T) {
+	p := newFakePrometheus(t, map[string]promResponse{"rate(cpu[120s])": vector()})
+	source := newTestPrometheusSource(t, p, config.PrometheusQueries{NodeCPU: "rate(cpu[{{.Window}}])"})
+
+	if _, err := source.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.queries) != 1 || p.queries[0] != "rate(cpu[120s])" {
+		t.Errorf("queries %q, want only rate(cpu[120s])", p.queries)
+	}
+
+	// Unknown variables and malformed templates are rejected up front
+	for _, text := range []string{"rate(cpu[{{.Range}}])", "rate(cpu[{{.Window])"} {
+		_, err := NewPrometheusSource(config.Prometheus{URL: p.URL, Queries: config.PrometheusQueries{NodeCPU: text}})
+		if err == nil || !strings.Contains(err.Error(), "nodeCpu") {
+			t.Errorf("NewPrometheusSource with %q = %v, want an error naming nodeCpu", text, err)
+		}
+	}
+}
+
+func TestPrometheusQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    promResponse
+		want    []promSample
+		wantErr string
+	}{
+		{
+			name: "vector",
+			resp: vector(series("0.25", "node", "node-a"), series("1e3", "node", "node-b")),
+			want: []promSample{{labels: map[string]string{"node": "node-a"}, value: 0.25}, {labels: map[string]string{"node": "node-b"}, value: 1000}},
+		},
+		{
+			name: "empty vector",
+			resp: vector(),
+			want: []promSample{},
+		},
+		{
+			name: "scalar",
+			resp: promResponse{http.StatusOK, `{"status":"success","data":{"resultType":"scalar","result":[1700000000.000,"42"]}}`},
+			want: []promSample{{value: 42}},
+		},
+		{
+			name:    "matrix",
+			resp:    promResponse{http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[]}}`},
+			wantErr: "returned a matrix",
+		},
+		{
+			name:    "bad data",
+			resp:    promResponse{http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error at char 4"}`},
+			wantErr: "bad_data: parse error at char 4",
+		},
+		{
+			name:    "execution error",
+			resp:    promResponse{http.StatusServiceUnavailable, `{"status":"error","errorType":"timeout","error":"query timed out"}`},
+			wantErr: "timeout: query timed out",
+		},
+		{
+			name:    "not JSON",
+			resp:    promResponse{http.StatusBadGateway, `<html>Bad Gateway</html>`},
+			wantErr: "status 502",
+		},
+		{
+			name:    "malformed value",
+			resp:    promResponse{http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,0.5]}]}}`},
+			wantErr: "unexpected prometheus sample value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakePrometheus(t, map[string]promResponse{"up": tt.resp})
+			source := newTestPrometheusSource(t, p, config.PrometheusQueries{})
+
+			got, err := source.query(context.Background(), "up", time.Now())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("query() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusSourceFetch(t *testing.T) {
+	const mib = 1024 * 1024
+	p := newFakePrometheus(t, map[string]promResponse{
+		"container_cpu": vector(
+			series("0.1", "namespace", "default", "pod", "web", "container", "app"),
+			series("0.05", "namespace", "default", "pod", "web", "container", "proxy"),
+			series("0.2", "namespace", "default", "pod", "web"), // no container label
+		),
+		"container_memory": vector(
+			series(fmt.Sprint(64*mib), "namespace", "default", "pod", "web", "container", "app"),
+			series(fmt.Sprint(16*mib), "namespace", "default", "pod", "web", "container", "proxy"),
+		),
+		"pod_rx":          vector(series("1000", "namespace", "default", "pod", "web"), series("5", "namespace", "kube-system", "pod", "dns")),
+		"pod_tx":          vector(series("2000", "namespace", "default", "pod", "web")),
+		"pod_restarts":    vector(series("3", "namespace", "default", "pod", "web")),
+		"pod_filesystem":  vector(series("4096", "namespace", "default", "pod", "web"), series("1", "pod", "orphan")),
+		"node_cpu":        vector(series("1.5", "node", "node-a")),
+		"node_memory":     vector(series(fmt.Sprint(2048*mib), "node", "node-a")),
+		"node_rx":         vector(series("10", "node", "node-a")),
+		"node_tx":         vector(series("20", "node", "node-a")),
+		"node_filesystem": vector(series("8192", "node", "node-a"), series("1", "instance", "x")),
+	})
+	source := newTestPrometheusSource(t, p, config.PrometheusQueries{
+		ContainerCPU:        "container_cpu",
+		ContainerMemory:     "container_memory",
+		PodNetworkReceive:   "pod_rx",
+		PodNetworkTransmit:  "pod_tx",
+		PodRestarts:         "pod_restarts",
+		PodFilesystem:       "pod_filesystem",
+		NodeCPU:             "node_cpu",
+		NodeMemory:          "node_memory",
+		NodeNetworkReceive:  "node_rx",
+		NodeNetworkTransmit: "node_tx",
+		NodeFilesystem:      "node_filesystem",
+	})
+
+	sample, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.queries) != 11 {
+		t.Errorf("ran %d queries, want 11", len(p.queries))
+	}
+
+	// Series without namespace and pod, or node, labels are dropped
+	if len(sample.Pods) != 2 || len(sample.Nodes) != 1 {
+		t.Fatalf("got %d pods and %d nodes, want 2 and 1", len(sample.Pods), len(sample.Nodes))
+	}
+	web, dns := sample.Pods[0], sample.Pods[1]
+	if web.Namespace != "default" || web.Name != "web" {
+		t.Fatalf("first pod %s/%s, want default/web", web.Namespace, web.Name)
+	}
+	if web.CPU != 150 || web.Memory != 80 {
+		t.Errorf("web uses %vm CPU and %vMB, want 150m and 80MB", web.CPU, web.Memory)
+	}
+	if len(web.Containers) != 2 ||
+		web.Containers[0] != (ContainerMetricsData{Name: "app", CPU: 100, Memory: 64}) ||
+		web.Containers[1] != (ContainerMetricsData{Name: "proxy", CPU: 50, Memory: 16}) {
+		t.Errorf("web containers %+v", web.Containers)
+	}
+	if web.Network == nil || web.Network.RxBytes != 1000 || web.Network.TxBytes != 2000 {
+		t.Errorf("web network %+v, want 1000 received and 2000 sent", web.Network)
+	}
+	if web.Restarts == nil || *web.Restarts != 3 {
+		t.Errorf("web restarts %v, want 3", web.Restarts)
+	}
+	if web.Filesystem == nil || web.Filesystem.UsedBytes != 4096 {
+		t.Errorf("web filesystem %+v, want 4096 bytes used", web.Filesystem)
+	}
+	if dns.Name != "dns" || dns.Network == nil || dns.Network.RxBytes != 5 || dns.Restarts != nil || dns.Filesystem != nil {
+		t.Errorf("dns %+v, want only network received", dns)
+	}
+
+	node := sample.Nodes[0]
+	if node.Name != "node-a" || node.CPU != 1500 || node.Memory != 2048 {
+		t.Errorf("node %s uses %vm CPU and %vMB, want node-a with 1500m and 2048MB", node.Name, node.CPU, node.Memory)
+	}
+	if node.Network == nil || node.Network.RxBytes != 10 || node.Network.TxBytes != 20 {
+		t.Errorf("node network %+v, want 10 received and 20 sent", node.Network)
+	}
+	if node.Filesystem == nil || node.Filesystem.UsedBytes != 8192 {
+		t.Errorf("node filesystem %+v, want 8192 bytes used", node.Filesystem)
+	}
+}
+
+func TestPrometheusSourceDegradesPerQuery(t *testing.T) {
+	p := newFakePrometheus(t, map[string]promResponse{
+		"node_cpu":    vector(series("0.5", "node", "node-a")),
+		"node_memory": {http.StatusUnprocessableEntity, `{"status":"error","errorType":"execution","error":"too many samples"}`},
+	})
+	source := newTestPrometheusSource(t, p, config.PrometheusQueries{NodeCPU: "node_cpu", NodeMemory: "node_memory"})
+
+	sample, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch with one failed query: %v", err)
+	}
+	if len(sample.Nodes) != 1 || sample.Nodes[0].CPU != 500 || sample.Nodes[0].Memory != 0 {
+		t.Errorf("nodes %+v, want node-a with 500m CPU and no memory", sample.Nodes)
+	}
+
+	// With every query failing there is nothing to report
+	source = newTestPrometheusSource(t, p, config.PrometheusQueries{NodeMemory: "node_memory", NodeFilesystem: "missing"})
+	_, err = source.Fetch(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "nodeMemory") || !strings.Contains(err.Error(), "nodeFilesystem") {
+		t.Errorf("Fetch with all queries failing = %v, want an error naming both", err)
+	}
+}
+
+func TestPrometheusSourceSendsBearerToken(t *testing.T) {
+	p := newFakePrometheus(t, map[string]promResponse{"vector(1)": vector(series("1"))})
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewPrometheusSource(config.Prometheus{URL: p.URL, BearerTokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := source.Available(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The file is re-read, so rotated tokens are picked up
+	if err := os.WriteFile(tokenFile, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Available(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.authorization) != 2 || p.authorization[0] != "Bearer first" || p.authorization[1] != "Bearer second" {
+		t.Errorf("Authorization headers %q, want Bearer first then Bearer second", p.authorization)
+	}
+
+	// Without a token file no header is sent
+	source, err = NewPrometheusSource(config.Prometheus{URL: p.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Available(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.authorization[2]; got != "" {
+		t.Errorf("Authorization header %q without a token file", got)
+	}
+}
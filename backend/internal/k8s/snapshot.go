@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Snapshot is the full cluster state sent to a client when it connects
+type Snapshot struct {
+	// ResourceVersions is the newest resourceVersion of each kind of object in
+	// the snapshot. Pod events (including pods_changed) at or below Pods, and
+	// node events at or below Nodes, are already reflected.
+	ResourceVersions ResourceVersions `json:"resourceVersions"`
+	Nodes            []Node           `json:"nodes"`
+	Pods             []Pod            `json:"pods"`
+	Metrics          *MetricsUpdate   `json:"metrics,omitempty"`
+	Status           *BackendStatus   `json:"status,omitempty"`
+}
+
+// ResourceVersions holds a resourceVersion per watched resource
+type ResourceVersions struct {
+	Pods  string `json:"pods"`
+	Nodes string `json:"nodes"`
+}
+
+// newestVersion tracks the highest resourceVersion seen.
+// resourceVersions are opaque, but etcd-backed clusters use increasing integers.
+type newestVersion uint64
+
+func (v *newestVersion) track(rv string) {
+	if parsed, err := strconv.ParseUint(rv, 10, 64); err == nil && parsed > uint64(*v) {
+		*v = newestVersion(parsed)
+	}
+}
+
+func (v newestVersion) String() string {
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// Snapshot builds the current nodes and pods from the informer cache.
+// The watchers must have been started. Like GetPods it leaves the layout
+// alone, so every move reaches clients as a layout change.
+func (c *Client) Snapshot() (Snapshot, error) {
+	kubeNodes, err := c.informers.Core().V1().Nodes().Lister().List(labels.Everything())
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to list cached nodes: %w", err)
+	}
+	kubePods, err := c.informers.Core().V1().Pods().Lister().List(labels.Everything())
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to list cached pods: %w", err)
+	}
+
+	var nodeVersion, podVersion newestVersion
+	nodes := make([]Node, 0, len(kubeNodes))
+	for _, node := range kubeNodes {
+		nodes = append(nodes, c.convertNode(node))
+		nodeVersion.track(node.ResourceVersion)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	pods := make([]Pod, 0, len(kubePods))
+	for _, pod := range kubePods {
+		// Positions are only read: pods the watcher hasn't placed yet are at the origin
+		pods = append(pods, c.convertPod(pod))
+		podVersion.track(pod.ResourceVersion)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	return Snapshot{
+		ResourceVersions: ResourceVersions{Pods: podVersion.String(), Nodes: nodeVersion.String()},
+		Nodes:            nodes,
+		Pods:             pods,
+	}, nil
+}
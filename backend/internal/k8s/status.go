@@ -0,0 +1,266 @@
+package k8s
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeUnreachablePodReason is set by the node lifecycle controller on pods
+// whose node stopped reporting
+const nodeUnreachablePodReason = "NodeLost"
+
+// podStatus derives the status string shown by `kubectl get pods` along with
+// the ready/total container counts and the total restart count
+func podStatus(pod *corev1.Pod) (status string, ready, total int, restarts int32) {
+	total = len(pod.Spec.Containers)
+
+	initContainers := make(map[string]*corev1.Container, len(pod.Spec.InitContainers))
+	for i := range pod.Spec.InitContainers {
+		initContainers[pod.Spec.InitContainers[i].Name] = &pod.Spec.InitContainers[i]
+		if isRestartableInitContainer(&pod.Spec.InitContainers[i]) {
+			total++
+		}
+	}
+
+	status = string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		status = pod.Status.Reason
+	}
+
+	// Pods held back by scheduling gates report a dedicated reason
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Reason == corev1.PodReasonSchedulingGated {
+			status = corev1.PodReasonSchedulingGated
+		}
+	}
+
+	// Init containers run in order, so the first one that has not completed
+	// determines the status; native sidecars keep running and count as regular containers
+	var sidecarRestarts int32
+	initializing := false
+	for i, cs := range pod.Status.InitContainerStatuses {
+		restarts += cs.RestartCount
+		if isRestartableInitContainer(initContainers[cs.Name]) {
+			sidecarRestarts += cs.RestartCount
+			if cs.Started != nil && *cs.Started {
+				if cs.Ready {
+					ready++
+				}
+				continue
+			}
+		}
+
+		switch {
+		case cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+			continue
+		case cs.State.Terminated != nil:
+			if cs.State.Terminated.Reason != "" {
+				status = "Init:" + cs.State.Terminated.Reason
+			} else {
+				status = "Init:" + terminatedReason(cs.State.Terminated)
+			}
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "" && cs.State.Waiting.Reason != "PodInitializing":
+			status = "Init:" + cs.State.Waiting.Reason
+		default:
+			status = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing || podInitialized(pod) {
+		restarts = sidecarRestarts
+		hasRunning := false
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			cs := pod.Status.ContainerStatuses[i]
+			restarts += cs.RestartCount
+
+			if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+				status = cs.State.Waiting.Reason
+			} else if cs.State.Terminated != nil && cs.State.Terminated.Reason != "" {
+				status = cs.State.Terminated.Reason
+			} else if cs.State.Terminated != nil {
+				status = terminatedReason(cs.State.Terminated)
+			} else if cs.Ready && cs.State.Running != nil {
+				hasRunning = true
+				ready++
+			}
+		}
+
+		// A completed container next to one that is still running means the pod is still up
+		if status == "Completed" && hasRunning {
+			if podReady(pod) {
+				status = "Running"
+			} else {
+				status = "NotReady"
+			}
+		}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		if pod.Status.Reason == nodeUnreachablePodReason {
+			status = "Unknown"
+		} else if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			status = "Terminating"
+		}
+	}
+
+	return status, ready, total, restarts
+}
+
+// podReady reports whether the pod's Ready condition is true
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podInitialized reports whether the pod's Initialized condition is true
+func podInitialized(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodInitialized {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isRestartableInitContainer reports whether an init container is a native
+// sidecar, i.e. declared with restartPolicy: Always
+func isRestartableInitContainer(container *corev1.Container) bool {
+	return container != nil &&
+		container.RestartPolicy != nil &&
+		*container.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// terminatedReason describes a terminated container that did not report a reason
+func terminatedReason(state *corev1.ContainerStateTerminated) string {
+	if state.Signal != 0 {
+		return fmt.Sprintf("Signal:%d", state.Signal)
+	}
+	return fmt.Sprintf("ExitCode:%d", state.ExitCode)
+}
+
+// convertContainerState flattens a Kubernetes container state into our ContainerState type
+func convertContainerState(state corev1.ContainerState) ContainerState {
+	switch {
+	case state.Running != nil:
+		return ContainerState{
+			State:     "Running",
+			StartedAt: state.Running.StartedAt.Time,
+		}
+	case state.Waiting != nil:
+		return ContainerState{
+			State:   "Waiting",
+			Reason:  state.Waiting.Reason,
+			Message: state.Waiting.Message,
+		}
+	case state.Terminated != nil:
+		reason := state.Terminated.Reason
+		if reason == "" {
+			reason = terminatedReason(state.Terminated)
+		}
+		exitCode := state.Terminated.ExitCode
+		return ContainerState{
+			State:      "Terminated",
+			Reason:     reason,
+			Message:    state.Terminated.Message,
+			ExitCode:   &exitCode,
+			StartedAt:  state.Terminated.StartedAt.Time,
+			FinishedAt: state.Terminated.FinishedAt.Time,
+		}
+	}
+	return ContainerState{State: "Unknown"}
+}
+
+// convertContainerStatus maps a Kubernetes container status to our Container type
+func convertContainerStatus(cs corev1.ContainerStatus, containerType string) Container {
+	state := convertContainerState(cs.State)
+
+	container := Container{
+		Name:     cs.Name,
+		Status:   state.State,
+		Reason:   state.Reason,
+		Message:  state.Message,
+		ExitCode: state.ExitCode,
+		Ready:    cs.Ready,
+		Restarts: cs.RestartCount,
+		Type:     containerType,
+		CPU:      0, // Will be updated by metrics_update events
+		Memory:   0, // Will be updated by metrics_update events
+	}
+
+	// Keep the previous termination around so crash loops show why they crashed
+	if cs.LastTerminationState.Terminated != nil {
+		lastState := convertContainerState(cs.LastTerminationState)
+		container.LastState = &lastState
+	}
+
+	return container
+}
+
+// convertContainers maps the init, regular and ephemeral containers of a pod
+// to our Container type, in that order. Containers that have not reported a
+// status yet are shown as waiting.
+func convertContainers(pod *corev1.Pod, classifier *ContainerClassifier) []Container {
+	containers := make([]Container, 0,
+		len(pod.Spec.InitContainers)+len(pod.Spec.Containers)+len(pod.Spec.EphemeralContainers))
+
+	classifications := classifier.ClassifyPod(pod)
+	convert := func(spec *corev1.Container, statuses []corev1.ContainerStatus) Container {
+		cs := corev1.ContainerStatus{
+			Name:  spec.Name,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}},
+		}
+		for i := range statuses {
+			if statuses[i].Name == spec.Name {
+				cs = statuses[i]
+				break
+			}
+		}
+
+		classification := classifications[spec.Name]
+		container := convertContainerStatus(cs, classification.Type)
+		container.Image = spec.Image
+		container.TypeRule = classification.Rule
+		container.NativeSidecar = classification.Rule == "native-sidecar"
+		container.Requests = convertResources(spec.Resources.Requests)
+		container.Limits = convertResources(spec.Resources.Limits)
+		return container
+	}
+
+	for i := range pod.Spec.InitContainers {
+		containers = append(containers, convert(&pod.Spec.InitContainers[i], pod.Status.InitContainerStatuses))
+	}
+
+	for i := range pod.Spec.Containers {
+		containers = append(containers, convert(&pod.Spec.Containers[i], pod.Status.ContainerStatuses))
+	}
+
+	for i := range pod.Spec.EphemeralContainers {
+		spec := corev1.Container(pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		containers = append(containers, convert(&spec, pod.Status.EphemeralContainerStatuses))
+	}
+
+	return containers
+}
+
+// convertResources converts a resource list to millicores and MB, returning nil when empty
+func convertResources(list corev1.ResourceList) *Resources {
+	if len(list) == 0 {
+		return nil
+	}
+
+	resources := &Resources{}
+	if cpu, ok := list[corev1.ResourceCPU]; ok {
+		resources.CPU = float64(cpu.MilliValue())
+	}
+	if memory, ok := list[corev1.ResourceMemory]; ok {
+		resources.Memory = memory.AsApproximateFloat64() / (1024 * 1024)
+	}
+	return resources
+}
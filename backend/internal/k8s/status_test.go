@@ -0,0 +1,273 @@
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func running(name string, ready bool, restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:         name,
+		Ready:        ready,
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}
+}
+
+func waiting(name, reason string, restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:         name,
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+	}
+}
+
+func terminated(name, reason string, exitCode int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:  name,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}},
+	}
+}
+
+func containers(names ...string) []corev1.Container {
+	list := make([]corev1.Container, 0, len(names))
+	for _, name := range names {
+		list = append(list, corev1.Container{Name: name})
+	}
+	return list
+}
+
+func condition(t corev1.PodConditionType, status corev1.ConditionStatus) corev1.PodCondition {
+	return corev1.PodCondition{Type: t, Status: status}
+}
+
+func TestPodStatus(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	started := true
+	now := metav1.Now()
+
+	tests := []struct {
+		name     string
+		pod      corev1.Pod
+		status   string
+		ready    int
+		total    int
+		restarts int32
+	}{
+		{
+			name: "running",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app", "proxy")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionTrue)},
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 1), running("proxy", true, 2)},
+				},
+			},
+			status: "Running", ready: 2, total: 2, restarts: 3,
+		},
+		{
+			name: "crash loop",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{waiting("app", "CrashLoopBackOff", 5)},
+				},
+			},
+			status: "CrashLoopBackOff", ready: 0, total: 1, restarts: 5,
+		},
+		{
+			name: "terminated with reason",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodFailed,
+					ContainerStatuses: []corev1.ContainerStatus{terminated("app", "OOMKilled", 137)},
+				},
+			},
+			status: "OOMKilled", total: 1,
+		},
+		{
+			name: "terminated without reason",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodFailed,
+					ContainerStatuses: []corev1.ContainerStatus{terminated("app", "", 2)},
+				},
+			},
+			status: "ExitCode:2", total: 1,
+		},
+		{
+			name: "completed",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("job")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodSucceeded,
+					ContainerStatuses: []corev1.ContainerStatus{terminated("job", "Completed", 0)},
+				},
+			},
+			status: "Completed", total: 1,
+		},
+		{
+			name: "completed next to running and ready",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app", "setup")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionTrue)},
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0), terminated("setup", "Completed", 0)},
+				},
+			},
+			status: "Running", ready: 1, total: 2,
+		},
+		{
+			name: "completed next to running but not ready",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app", "setup")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionFalse)},
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0), terminated("setup", "Completed", 0)},
+				},
+			},
+			status: "NotReady", ready: 1, total: 2,
+		},
+		{
+			name: "init container running",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("migrate", "seed"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:                 corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{terminated("migrate", "Completed", 0), running("seed", false, 0)},
+					ContainerStatuses:     []corev1.ContainerStatus{waiting("app", "PodInitializing", 0)},
+				},
+			},
+			status: "Init:1/2", total: 1,
+		},
+		{
+			name: "init container crash loop",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("migrate"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:                 corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{waiting("migrate", "CrashLoopBackOff", 4)},
+					ContainerStatuses:     []corev1.ContainerStatus{waiting("app", "PodInitializing", 0)},
+				},
+			},
+			status: "Init:CrashLoopBackOff", total: 1, restarts: 4,
+		},
+		{
+			name: "init container failed",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("migrate"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:                 corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{terminated("migrate", "", 1)},
+				},
+			},
+			status: "Init:ExitCode:1", total: 1,
+		},
+		{
+			name: "native sidecar counts as a container",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "mesh", RestartPolicy: &always}},
+					Containers:     containers("app"),
+				},
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodRunning,
+					Conditions: []corev1.PodCondition{condition(corev1.PodInitialized, corev1.ConditionTrue), condition(corev1.PodReady, corev1.ConditionTrue)},
+					InitContainerStatuses: []corev1.ContainerStatus{func() corev1.ContainerStatus {
+						cs := running("mesh", true, 1)
+						cs.Started = &started
+						return cs
+					}()},
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0)},
+				},
+			},
+			status: "Running", ready: 2, total: 2, restarts: 1,
+		},
+		{
+			name: "terminating",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0)},
+				},
+			},
+			status: "Terminating", ready: 1, total: 1,
+		},
+		{
+			name: "deleted on unreachable node",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Reason:            nodeUnreachablePodReason,
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true, 0)},
+				},
+			},
+			status: "Unknown", ready: 1, total: 1,
+		},
+		{
+			name: "deleted after succeeding",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Spec:       corev1.PodSpec{Containers: containers("job")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodSucceeded,
+					ContainerStatuses: []corev1.ContainerStatus{terminated("job", "Completed", 0)},
+				},
+			},
+			status: "Completed", total: 1,
+		},
+		{
+			name: "scheduling gated",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					Conditions: []corev1.PodCondition{{
+						Type:   corev1.PodScheduled,
+						Status: corev1.ConditionFalse,
+						Reason: corev1.PodReasonSchedulingGated,
+					}},
+				},
+			},
+			status: corev1.PodReasonSchedulingGated, total: 1,
+		},
+		{
+			name: "pod reason",
+			pod: corev1.Pod{
+				Spec:   corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"},
+			},
+			status: "Evicted", total: 1,
+		},
+		{
+			name: "unknown phase without statuses",
+			pod: corev1.Pod{
+				Spec:   corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{Phase: corev1.PodUnknown},
+			},
+			status: "Unknown", total: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ready, total, restarts := podStatus(&tt.pod)
+			if status != tt.status || ready != tt.ready || total != tt.total || restarts != tt.restarts {
+				t.Errorf("podStatus() = %q %d/%d restarts %d, want %q %d/%d restarts %d",
+					status, ready, total, restarts, tt.status, tt.ready, tt.total, tt.restarts)
+			}
+		})
+	}
+}
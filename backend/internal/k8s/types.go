@@ -1,7 +1,6 @@
 package k8s
 
 import (
-	"strings"
 	"time"
 )
 
@@ -19,26 +18,80 @@ type Node struct {
 
 // Pod represents a simplified Kubernetes pod for the frontend
 type Pod struct {
-	ID         string      `json:"id"`
-	Name       string      `json:"name"`
-	Namespace  string      `json:"namespace"`
-	Status     string      `json:"status"`
-	NodeName   string      `json:"nodeName"`
-	Containers []Container `json:"containers"`
-	CreatedAt  time.Time   `json:"createdAt"`
-	Position   Position    `json:"position"`
-	CPU        float64     `json:"cpu"`    // total CPU usage in millicores
-	Memory     float64     `json:"memory"` // total memory usage in MB
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	Status            string            `json:"status"` // kubectl-style status, e.g. "CrashLoopBackOff"
+	Phase             string            `json:"phase"`
+	Reason            string            `json:"reason,omitempty"`
+	Message           string            `json:"message,omitempty"`
+	Ready             bool              `json:"ready"`
+	ReadyContainers   int               `json:"readyContainers"`
+	TotalContainers   int               `json:"totalContainers"`
+	Restarts          int32             `json:"restarts"`
+	Terminating       bool              `json:"terminating"`
+	NodeName          string            `json:"nodeName"`
+	Labels            map[string]string `json:"labels"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	Owner             *OwnerReference   `json:"owner,omitempty"` // controlling owner, if any
+	OwnerReferences   []OwnerReference  `json:"ownerReferences,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	PodIPs            []string          `json:"podIPs,omitempty"`
+	HostIP            string            `json:"hostIP,omitempty"`
+	QOSClass          string            `json:"qosClass,omitempty"` // "Guaranteed", "Burstable" or "BestEffort"
+	Priority          *int32            `json:"priority,omitempty"`
+	PriorityClassName string            `json:"priorityClassName,omitempty"`
+	Containers        []Container       `json:"containers"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	Position          Position          `json:"position"`
+	CPU               float64           `json:"cpu"`    // total CPU usage in millicores
+	Memory            float64           `json:"memory"` // total memory usage in MB
 }
 
 // Container represents a container within a pod
 type Container struct {
-	Name     string  `json:"name"`
-	Status   string  `json:"status"`
-	Restarts int32   `json:"restarts"`
-	Type     string  `json:"type"`   // "main", "sidecar", or "init"
-	CPU      float64 `json:"cpu"`    // millicores
-	Memory   float64 `json:"memory"` // MB
+	Name      string          `json:"name"`
+	Image     string          `json:"image"`
+	Status    string          `json:"status"` // "Running", "Waiting", "Terminated" or "Unknown"
+	Reason    string          `json:"reason,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	ExitCode  *int32          `json:"exitCode,omitempty"`
+	Ready     bool            `json:"ready"`
+	Restarts  int32           `json:"restarts"`
+	LastState *ContainerState `json:"lastState,omitempty"`
+	Type      string          `json:"type"` // "main", "sidecar", "init", or "ephemeral"
+	// TypeRule explains the classification, e.g. "rule:istio-proxy" or "annotation:observatory.io/sidecars"
+	TypeRule string `json:"typeRule,omitempty"`
+	// NativeSidecar marks init containers declared with restartPolicy: Always
+	NativeSidecar bool       `json:"nativeSidecar,omitempty"`
+	Requests      *Resources `json:"requests,omitempty"`
+	Limits        *Resources `json:"limits,omitempty"`
+	CPU           float64    `json:"cpu"`    // millicores
+	Memory        float64    `json:"memory"` // MB
+}
+
+// OwnerReference identifies the object that owns a pod
+type OwnerReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Controller bool   `json:"controller"`
+}
+
+// Resources holds container resource requests or limits
+type Resources struct {
+	CPU    float64 `json:"cpu,omitempty"`    // millicores
+	Memory float64 `json:"memory,omitempty"` // MB
+}
+
+// ContainerState describes a single container state, current or previous
+type ContainerState struct {
+	State      string    `json:"state"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	ExitCode   *int32    `json:"exitCode,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
 }
 
 // ResourceUsage represents resource consumption
@@ -53,33 +106,3 @@ type Position struct {
 	Y float64 `json:"y"`
 	Z float64 `json:"z"`
 }
-
-// determineContainerType identifies whether a container is main, sidecar, or init
-func determineContainerType(containerName string, isInitContainer bool, index int) string {
-	if isInitContainer {
-		return "init"
-	}
-
-	// Common sidecar patterns
-	sidecarPatterns := []string{
-		"istio-proxy", "envoy", "linkerd-proxy",
-		"cloudsql-proxy", "vault-agent",
-		"fluentd", "filebeat", "logstash",
-		"prometheus-exporter", "jaeger-agent",
-	}
-
-	lowerName := strings.ToLower(containerName)
-	for _, pattern := range sidecarPatterns {
-		if strings.Contains(lowerName, pattern) {
-			return "sidecar"
-		}
-	}
-
-	// First container is typically main
-	if index == 0 {
-		return "main"
-	}
-
-	// Default to sidecar for additional containers
-	return "sidecar"
-}
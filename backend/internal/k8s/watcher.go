@@ -1,170 +1,275 @@
 package k8s
 
 import (
+	"fmt"
 	"log"
-	"math"
+	"maps"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
 )
 
 // EventType represents the type of Kubernetes event
 type EventType string
 
 const (
-	EventPodAdded    EventType = "pod_added"
-	EventPodModified EventType = "pod_modified"
-	EventPodDeleted  EventType = "pod_deleted"
-	EventNodeAdded   EventType = "node_added"
-	EventNodeModified EventType = "node_modified"
-	EventNodeDeleted EventType = "node_deleted"
+	EventPodAdded      EventType = "pod_added"
+	EventPodModified   EventType = "pod_modified"
+	EventPodDeleted    EventType = "pod_deleted"
+	EventNodeAdded     EventType = "node_added"
+	EventNodeModified  EventType = "node_modified"
+	EventNodeDeleted   EventType = "node_deleted"
+	EventLayoutChanged EventType = "layout_changed"
 )
 
 // WatchEvent represents a Kubernetes watch event
 type WatchEvent struct {
-	Type EventType   `json:"type"`
-	Pod  *Pod        `json:"pod,omitempty"`
-	Node *Node       `json:"node,omitempty"`
+	Type EventType `json:"type"`
+	Pod  *Pod      `json:"pod,omitempty"`
+	Node *Node     `json:"node,omitempty"`
+
+	// Layout lists positions of other nodes and pods that moved as a side effect
+	Layout *LayoutChange `json:"layout,omitempty"`
+
+	// Changes is the batch carried by a pods_changed event
+	Changes *PodsChanged `json:"changes,omitempty"`
+
+	// ResourceVersion of the pod or node, used by clients to skip events
+	// already reflected in the snapshot they received on connect
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
-// WatchPods watches for pod changes and sends events to the channel
+// WatchPods watches for pod changes and sends events to the channel.
+// Pods are tracked by a shared informer, which re-lists and re-watches on
+// its own when the connection to the API server drops.
+//
+// Pods in the initial listing are placed all at once, in sorted order, once
+// the cache has synced, so the same cluster always gets the same layout no
+// matter the order the informer delivers them in.
 func (c *Client) WatchPods(events chan<- WatchEvent) error {
-	watcher, err := c.Clientset.CoreV1().Pods("").Watch(c.ctx, metav1.ListOptions{})
+	informer := c.informers.Core().V1().Pods().Informer()
+	tracker, err := c.trackWatch("pods", informer)
 	if err != nil {
 		return err
 	}
 
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			tracker.seen()
+			if pod, ok := obj.(*corev1.Pod); ok {
+				if isInInitialList {
+					c.handleListedPod(events, pod)
+				} else {
+					c.handlePodEvent(events, EventPodAdded, pod)
+				}
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			tracker.seen()
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.handlePodEvent(events, EventPodModified, pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			tracker.seen()
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.handlePodEvent(events, EventPodDeleted, pod)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.informers.Start(c.ctx.Done())
+	if !cache.WaitForCacheSync(c.ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for pod cache to sync")
+	}
+	if err := c.placeListedPods(events); err != nil {
+		return err
+	}
+
 	log.Println("Started watching pods...")
+	return nil
+}
 
-	go func() {
-		defer watcher.Stop()
+// placeListedPods places every cached pod in one reconcile and sends the
+// resulting moves. Pods the handlers already placed keep their slots.
+func (c *Client) placeListedPods(events chan<- WatchEvent) error {
+	c.podMu.Lock()
+	defer c.podMu.Unlock()
 
-		for event := range watcher.ResultChan() {
-			pod, ok := event.Object.(*corev1.Pod)
-			if !ok {
-				continue
-			}
+	// The cache is updated before handlers run, so it holds every pod the
+	// handlers have seen and possibly some they haven't yet
+	pods, err := c.informers.Core().V1().Pods().Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list cached pods: %w", err)
+	}
+	listed := make([]LayoutPod, 0, len(pods))
+	for _, pod := range pods {
+		listed = append(listed, layoutPod(pod))
+	}
+	c.sendLayoutChange(events, c.layout.Reconcile(nil, listed))
+	return nil
+}
 
-			var eventType EventType
-			switch event.Type {
-			case watch.Added:
-				eventType = EventPodAdded
-			case watch.Modified:
-				eventType = EventPodModified
-			case watch.Deleted:
-				eventType = EventPodDeleted
-			default:
-				continue
-			}
+// handleListedPod sends a pod from the initial listing. Unless the initial
+// reconcile already placed it, it is at the origin until that reconcile moves it.
+func (c *Client) handleListedPod(events chan<- WatchEvent, pod *corev1.Pod) {
+	c.podMu.Lock()
+	defer c.podMu.Unlock()
 
-			// Convert to our Pod type
-			simplePod := c.convertPod(pod)
+	simplePod := c.convertPod(pod)
+	events <- WatchEvent{
+		Type:            EventPodAdded,
+		Pod:             &simplePod,
+		ResourceVersion: pod.ResourceVersion,
+	}
+}
 
-			events <- WatchEvent{
-				Type: eventType,
-				Pod:  &simplePod,
-			}
+// handlePodEvent updates the layout for a pod event and sends it on
+func (c *Client) handlePodEvent(events chan<- WatchEvent, eventType EventType, pod *corev1.Pod) {
+	c.podMu.Lock()
+	defer c.podMu.Unlock()
 
-			log.Printf("Pod event: %s - %s/%s", eventType, pod.Namespace, pod.Name)
-		}
-	}()
+	// Update the layout, converting deleted pods while they still have a position.
+	// Other pods keep their slots, so only the pod itself moves.
+	var simplePod Pod
+	if eventType == EventPodDeleted {
+		simplePod = c.convertPod(pod)
+		c.layout.RemovePod(string(pod.UID))
+	} else {
+		c.layout.PlacePod(layoutPod(pod))
+		simplePod = c.convertPod(pod)
+	}
 
-	return nil
+	events <- WatchEvent{
+		Type:            eventType,
+		Pod:             &simplePod,
+		ResourceVersion: pod.ResourceVersion,
+	}
+
+	log.Printf("Pod event: %s - %s/%s", eventType, pod.Namespace, pod.Name)
 }
 
 // WatchNodes watches for node changes and sends events to the channel
 func (c *Client) WatchNodes(events chan<- WatchEvent) error {
-	watcher, err := c.Clientset.CoreV1().Nodes().Watch(c.ctx, metav1.ListOptions{})
+	informer := c.informers.Core().V1().Nodes().Informer()
+	tracker, err := c.trackWatch("nodes", informer)
 	if err != nil {
 		return err
 	}
 
-	log.Println("Started watching nodes...")
-
-	go func() {
-		defer watcher.Stop()
-
-		for event := range watcher.ResultChan() {
-			node, ok := event.Object.(*corev1.Node)
-			if !ok {
-				continue
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			tracker.seen()
+			if node, ok := obj.(*corev1.Node); ok {
+				c.handleNodeEvent(events, EventNodeAdded, node)
 			}
-
-			var eventType EventType
-			switch event.Type {
-			case watch.Added:
-				eventType = EventNodeAdded
-			case watch.Modified:
-				eventType = EventNodeModified
-			case watch.Deleted:
-				eventType = EventNodeDeleted
-			default:
-				continue
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			tracker.seen()
+			if node, ok := obj.(*corev1.Node); ok {
+				c.handleNodeEvent(events, EventNodeModified, node)
 			}
-
-			// Convert to our Node type
-			simpleNode := c.convertNode(node, 0, 0)
-
-			events <- WatchEvent{
-				Type: eventType,
-				Node: &simpleNode,
+		},
+		DeleteFunc: func(obj interface{}) {
+			tracker.seen()
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
 			}
+			if node, ok := obj.(*corev1.Node); ok {
+				c.handleNodeEvent(events, EventNodeDeleted, node)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
 
-			log.Printf("Node event: %s - %s", eventType, node.Name)
-		}
-	}()
+	c.informers.Start(c.ctx.Done())
+	if !cache.WaitForCacheSync(c.ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for node cache to sync")
+	}
 
+	log.Println("Started watching nodes...")
 	return nil
 }
 
+// handleNodeEvent updates the layout for a node event and sends it on
+func (c *Client) handleNodeEvent(events chan<- WatchEvent, eventType EventType, node *corev1.Node) {
+	// Update the layout; other nodes may shift to make room
+	var change LayoutChange
+	if eventType == EventNodeDeleted {
+		change = c.layout.RemoveNode(node.Name)
+	} else {
+		change = c.layout.AddNode(LayoutNode{Name: node.Name, Zone: node.Labels[ZoneLabel]})
+	}
+
+	// Convert to our Node type
+	simpleNode := c.convertNode(node)
+
+	events <- WatchEvent{
+		Type:            eventType,
+		Node:            &simpleNode,
+		ResourceVersion: node.ResourceVersion,
+	}
+	c.sendLayoutChange(events, change)
+
+	log.Printf("Node event: %s - %s", eventType, node.Name)
+}
+
 // Helper function to convert Kubernetes pod to our Pod type
 func (c *Client) convertPod(kubePod *corev1.Pod) Pod {
-	containers := make([]Container, 0, len(kubePod.Status.ContainerStatuses))
-	for i, cs := range kubePod.Status.ContainerStatuses {
-		status := "Unknown"
-		if cs.State.Running != nil {
-			status = "Running"
-		} else if cs.State.Waiting != nil {
-			status = "Waiting"
-		} else if cs.State.Terminated != nil {
-			status = "Terminated"
-		}
+	containers := convertContainers(kubePod, c.classifier.Load())
+	status, ready, total, restarts := podStatus(kubePod)
+	owners, controller := convertOwnerReferences(kubePod.OwnerReferences)
 
-		containers = append(containers, Container{
-			Name:     cs.Name,
-			Status:   status,
-			Restarts: cs.RestartCount,
-			Type:     determineContainerType(cs.Name, false, i),
-			CPU:      0, // Will be updated by metrics_update events
-			Memory:   0, // Will be updated by metrics_update events
-		})
+	podIPs := make([]string, 0, len(kubePod.Status.PodIPs))
+	for _, ip := range kubePod.Status.PodIPs {
+		podIPs = append(podIPs, ip.IP)
 	}
 
-	// Simple position calculation (will be improved later)
-	angle := 0.0
-	orbitRadius := 3.0
+	position, _ := c.layout.PodPosition(string(kubePod.UID))
 
 	return Pod{
-		ID:         string(kubePod.UID),
-		Name:       kubePod.Name,
-		Namespace:  kubePod.Namespace,
-		Status:     string(kubePod.Status.Phase),
-		NodeName:   kubePod.Spec.NodeName,
-		Containers: containers,
-		CreatedAt:  kubePod.CreationTimestamp.Time,
-		Position: Position{
-			X: orbitRadius * math.Cos(angle),
-			Y: 0,
-			Z: orbitRadius * math.Sin(angle),
-		},
-		CPU:    0, // Will be updated by metrics_update events
-		Memory: 0, // Will be updated by metrics_update events
+		ID:                string(kubePod.UID),
+		Name:              kubePod.Name,
+		Namespace:         kubePod.Namespace,
+		Status:            status,
+		Phase:             string(kubePod.Status.Phase),
+		Reason:            kubePod.Status.Reason,
+		Message:           kubePod.Status.Message,
+		Ready:             podReady(kubePod),
+		ReadyContainers:   ready,
+		TotalContainers:   total,
+		Restarts:          restarts,
+		Terminating:       kubePod.DeletionTimestamp != nil,
+		NodeName:          kubePod.Spec.NodeName,
+		Labels:            maps.Clone(kubePod.Labels), // the informer cache owns the original
+		Annotations:       trimAnnotations(kubePod.Annotations, int(c.annotationLimit.Load())),
+		Owner:             controller,
+		OwnerReferences:   owners,
+		PodIP:             kubePod.Status.PodIP,
+		PodIPs:            podIPs,
+		HostIP:            kubePod.Status.HostIP,
+		QOSClass:          string(kubePod.Status.QOSClass),
+		Priority:          kubePod.Spec.Priority,
+		PriorityClassName: kubePod.Spec.PriorityClassName,
+		Containers:        containers,
+		CreatedAt:         kubePod.CreationTimestamp.Time,
+		Position:          position,
+		CPU:               0, // Will be updated by metrics_update events
+		Memory:            0, // Will be updated by metrics_update events
 	}
 }
 
 // Helper function to convert Kubernetes node to our Node type
-func (c *Client) convertNode(kubeNode *corev1.Node, index, total int) Node {
+func (c *Client) convertNode(kubeNode *corev1.Node) Node {
 	// Determine node status
 	status := "NotReady"
 	for _, condition := range kubeNode.Status.Conditions {
@@ -178,13 +283,6 @@ func (c *Client) convertNode(kubeNode *corev1.Node, index, total int) Node {
 	cpu := kubeNode.Status.Capacity.Cpu().AsApproximateFloat64()
 	memory := kubeNode.Status.Capacity.Memory().AsApproximateFloat64() / (1024 * 1024 * 1024)
 
-	// Calculate position
-	angle := 0.0
-	if total > 0 {
-		angle = float64(index) * 2.0 * math.Pi / float64(total)
-	}
-	radius := 10.0
-
 	return Node{
 		ID:     string(kubeNode.UID),
 		Name:   kubeNode.Name,
@@ -197,12 +295,21 @@ func (c *Client) convertNode(kubeNode *corev1.Node, index, total int) Node {
 			Used:  0,
 			Total: memory,
 		},
-		Pods:   []string{},
-		Labels: kubeNode.Labels,
-		Position: Position{
-			X: radius * math.Cos(angle),
-			Y: 0,
-			Z: radius * math.Sin(angle),
-		},
+		Pods:     []string{},
+		Labels:   maps.Clone(kubeNode.Labels),
+		Position: c.layout.NodePosition(kubeNode.Name),
+	}
+}
+
+// sendLayoutChange emits a layout_changed event when a node event moved other
+// nodes or the pods orbiting them
+func (c *Client) sendLayoutChange(events chan<- WatchEvent, change LayoutChange) {
+	if change.Empty() {
+		return
+	}
+
+	events <- WatchEvent{
+		Type:   EventLayoutChanged,
+		Layout: &change,
 	}
 }
@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newFakeClient creates a client whose informers read from a fake clientset
+// holding objects
+func newFakeClient(t *testing.T, strategy LayoutStrategy, objects ...runtime.Object) (*Client, *fake.Clientset) {
+	t.Helper()
+	clientset := fake.NewClientset(objects...)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		ctx:       ctx,
+		layout:    newTestLayout(t, strategy),
+		informers: informers.NewSharedInformerFactory(clientset, 0),
+	}
+	c.SetClassifier(DefaultContainerClassifier())
+	t.Cleanup(func() {
+		cancel()
+		c.Shutdown()
+	})
+	return c, clientset
+}
+
+// testObjects returns the nodes and pods of testCluster as API objects
+func testObjects() []runtime.Object {
+	nodes, pods := testCluster()
+	var objects []runtime.Object
+	for _, node := range nodes {
+		objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   node.Name,
+			Labels: map[string]string{ZoneLabel: node.Zone},
+		}})
+	}
+	for _, pod := range pods {
+		objects = append(objects, testPod(pod))
+	}
+	return objects
+}
+
+func testPod(pod LayoutPod) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace, UID: types.UID(pod.ID)},
+		Spec:       corev1.PodSpec{NodeName: pod.NodeName},
+	}
+}
+
+// startWatchers starts both watchers and waits for the initial listing to be
+// sent, returning the channel for later events
+func startWatchers(t *testing.T, c *Client) chan WatchEvent {
+	t.Helper()
+	events := make(chan WatchEvent, 256)
+	if err := c.WatchNodes(events); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WatchPods(events); err != nil {
+		t.Fatal(err)
+	}
+
+	pods, _ := c.informers.Core().V1().Pods().Lister().List(labels.Everything())
+	for added := 0; added < len(pods); {
+		select {
+		case event := <-events:
+			if event.Type == EventPodAdded {
+				added++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d of %d listed pods", added, len(pods))
+		}
+	}
+	for len(events) > 0 {
+		<-events
+	}
+	return events
+}
+
+func TestWatchPodsLayoutIsDeterministic(t *testing.T) {
+	for _, strategy := range layoutStrategies {
+		t.Run(string(strategy), func(t *testing.T) {
+			nodes, pods := testCluster()
+
+			// The expected layout: every pod placed in one reconcile
+			want := newTestLayout(t, strategy)
+			for _, node := range nodes {
+				want.AddNode(node)
+			}
+			want.Reconcile(nil, pods)
+
+			// The API server lists pods in any order; try it both ways
+			for _, reverse := range []bool{false, true} {
+				c, clientset := newFakeClient(t, strategy, testObjects()...)
+				clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					obj, err := clientset.Tracker().List(corev1.SchemeGroupVersion.WithResource("pods"), corev1.SchemeGroupVersion.WithKind("Pod"), "")
+					if err != nil {
+						return true, nil, err
+					}
+					list := obj.(*corev1.PodList)
+					slices.SortFunc(list.Items, func(a, b corev1.Pod) int { return strings.Compare(string(a.UID), string(b.UID)) })
+					if reverse {
+						slices.Reverse(list.Items)
+					}
+					return true, list, nil
+				})
+				events := startWatchers(t, c)
+
+				for _, pod := range pods {
+					got, ok := c.layout.PodPosition(pod.ID)
+					if expected, _ := want.PodPosition(pod.ID); !ok || got != expected {
+						t.Errorf("pod %s at %v, want %v", pod.ID, got, expected)
+					}
+				}
+
+				// Placing the listing again moves nothing
+				if err := c.placeListedPods(events); err != nil {
+					t.Fatal(err)
+				}
+				if len(events) != 0 {
+					t.Errorf("second placement sent %v", <-events)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchPodsPlacesNewPods(t *testing.T) {
+	c, clientset := newFakeClient(t, LayoutRing, testObjects()...)
+	events := startWatchers(t, c)
+
+	pod := testPod(LayoutPod{ID: "uid-new", Namespace: "default", Name: "new", NodeName: "node-a"})
+	if _, err := clientset.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		position, ok := c.layout.PodPosition("uid-new")
+		if event.Type != EventPodAdded || !ok || event.Pod.Position != position || position == (Position{}) {
+			t.Errorf("got %s at %v, want pod_added at its slot %v", event.Type, event.Pod.Position, position)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for the new pod")
+	}
+}
+
+func TestSnapshotLeavesLayoutAlone(t *testing.T) {
+	objects := testObjects()
+	c, _ := newFakeClient(t, LayoutRing, objects...)
+
+	// Fill the cache without the watchers, which would place the pods
+	synced := []cache.InformerSynced{
+		c.informers.Core().V1().Nodes().Informer().HasSynced,
+		c.informers.Core().V1().Pods().Informer().HasSynced,
+	}
+	c.informers.Start(c.ctx.Done())
+	if !cache.WaitForCacheSync(c.ctx.Done(), synced...) {
+		t.Fatal("cache did not sync")
+	}
+
+	snapshot, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Pods) != 30 {
+		t.Fatalf("snapshot has %d pods, want 30", len(snapshot.Pods))
+	}
+	for _, pod := range snapshot.Pods {
+		if _, ok := c.layout.PodPosition(pod.ID); ok || pod.Position != (Position{}) {
+			t.Errorf("snapshot placed pod %s at %v", pod.ID, pod.Position)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Supervisor owns the root context of the backend and the long-running
+// goroutines started under it, so that shutdown can wait for all of them
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int // task name -> goroutines still running
+}
+
+// New creates a supervisor whose context is cancelled along with parent
+func New(parent context.Context) *Supervisor {
+	ctx, cancel := context.WithCancel(parent)
+	return &Supervisor{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+	}
+}
+
+// Context returns the root context, cancelled when shutdown begins
+func (s *Supervisor) Context() context.Context {
+	return s.ctx
+}
+
+// Go runs task in a new goroutine. The task must return once the context is
+// cancelled or, for stages of a pipeline, once its input is closed.
+func (s *Supervisor) Go(name string, task func(ctx context.Context)) {
+	s.mu.Lock()
+	s.running[name]++
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			if s.running[name]--; s.running[name] == 0 {
+				delete(s.running, name)
+			}
+			s.mu.Unlock()
+			s.wg.Done()
+		}()
+		task(s.ctx)
+	}()
+}
+
+// Wait cancels the root context and waits for every task to return until ctx
+// is done. The error names the tasks that were still running.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		names := make([]string, 0, len(s.running))
+		for name := range s.running {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("still running: %s: %w", strings.Join(names, ", "), ctx.Err())
+	}
+}
@@ -0,0 +1,202 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blocker is a component that runs until its context is cancelled
+func blocker(ctx context.Context) {
+	<-ctx.Done()
+}
+
+// hang is a component that ignores cancellation until release is closed
+func hang(release chan struct{}) func(context.Context) {
+	return func(context.Context) {
+		<-release
+	}
+}
+
+func TestWaitStopsEveryTask(t *testing.T) {
+	s := New(context.Background())
+	var stopped atomic.Int32
+	for i := 0; i < 3; i++ {
+		s.Go("watcher", func(ctx context.Context) {
+			blocker(ctx)
+			stopped.Add(1)
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+	if stopped.Load() != 3 {
+		t.Errorf("%d of 3 tasks stopped", stopped.Load())
+	}
+	if s.Context().Err() == nil {
+		t.Error("root context not cancelled by Wait")
+	}
+}
+
+func TestParentCancelsRootContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	s := New(parent)
+	cancel()
+	select {
+	case <-s.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("root context not cancelled with its parent")
+	}
+}
+
+func TestFailedTaskIsNotRestarted(t *testing.T) {
+	s := New(context.Background())
+	var runs atomic.Int32
+	failed := make(chan struct{})
+	s.Go("fetcher", func(context.Context) {
+		runs.Add(1)
+		close(failed)
+	})
+	s.Go("watcher", blocker)
+
+	<-failed
+	time.Sleep(20 * time.Millisecond)
+	if s.Context().Err() != nil {
+		t.Error("a task returning early cancelled the root context")
+	}
+
+	// The finished task no longer counts as running at shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+	if runs.Load() != 1 {
+		t.Errorf("task ran %d times, want once", runs.Load())
+	}
+}
+
+func TestPipelineStopsInOrder(t *testing.T) {
+	s := New(context.Background())
+	var mu sync.Mutex
+	var order []string
+	stopped := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+
+	// Like the event pipeline: only the source watches the context, each
+	// later stage stops when its input is closed
+	events := make(chan int)
+	batches := make(chan int)
+	s.Go("broadcaster", func(context.Context) {
+		for range batches {
+		}
+		stopped("broadcaster")
+	})
+	s.Go("pipeline", func(context.Context) {
+		defer close(batches)
+		for event := range events {
+			// A slow stage still drains before the next one stops
+			time.Sleep(time.Millisecond)
+			batches <- event
+		}
+		stopped("pipeline")
+	})
+	s.Go("watchers", func(ctx context.Context) {
+		defer close(events)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				stopped("watchers")
+				return
+			case events <- i:
+			}
+		}
+	})
+
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+	if want := []string{"watchers", "pipeline", "broadcaster"}; !slices.Equal(order, want) {
+		t.Errorf("stopped in order %v, want %v", order, want)
+	}
+}
+
+func TestWaitNamesHungTasksAtDeadline(t *testing.T) {
+	s := New(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	s.Go("websocket hub", blocker)
+	s.Go("metrics fetcher", hang(release))
+	s.Go("kubernetes watchers", hang(release))
+	s.Go("kubernetes watchers", hang(release))
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Wait(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Wait took %s with a 50ms deadline", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() = %v, want the deadline exceeded", err)
+	}
+	if !strings.Contains(err.Error(), "still running: kubernetes watchers, metrics fetcher:") {
+		t.Errorf("error %q, want the hung tasks named once each in order", err)
+	}
+	if strings.Contains(err.Error(), "websocket hub") {
+		t.Errorf("error %q names a task that stopped", err)
+	}
+}
+
+func TestWaitSharesDeadlineWithEarlierShutdown(t *testing.T) {
+	s := New(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	s.Go("metrics fetcher", hang(release))
+
+	// Like main, the HTTP server's shutdown uses up part of the deadline and
+	// the supervisor only gets what is left of it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	time.Sleep(80 * time.Millisecond)
+
+	if err := s.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("shutdown took %s with a 100ms deadline", elapsed)
+	}
+
+	// An expired deadline still cancels the tasks without waiting
+	s = New(context.Background())
+	stopped := make(chan struct{})
+	s.Go("watcher", func(ctx context.Context) {
+		blocker(ctx)
+		close(stopped)
+	})
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Wait(expired); !errors.Is(err, context.Canceled) && err != nil {
+		t.Errorf("Wait() = %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task not cancelled by Wait with an expired deadline")
+	}
+}
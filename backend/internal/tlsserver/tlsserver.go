@@ -0,0 +1,236 @@
+package tlsserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+)
+
+// Manager serves the certificate and client CAs for HTTPS, picking up
+// rotated files without a restart
+type Manager struct {
+	cfg config.TLS
+
+	cert     atomic.Pointer[tls.Certificate]
+	clientCA atomic.Pointer[x509.CertPool]
+
+	// allowed identities, nil when any verified client may connect
+	allowed map[string]bool
+}
+
+// New loads the configured certificate, or generates a self-signed one
+func New(cfg config.TLS) (*Manager, error) {
+	m := &Manager{cfg: cfg}
+
+	if cfg.SelfSigned {
+		cert, err := selfSignedCertificate(cfg.SelfSignedHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+		}
+		m.cert.Store(cert)
+		sum := sha256.Sum256(cert.Certificate[0])
+		log.Printf("Serving HTTPS with a self-signed certificate (SHA-256 fingerprint %s)", hex.EncodeToString(sum[:]))
+	} else if err := m.loadCertificate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.ClientCAFile != "" {
+		if err := m.loadClientCA(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.AllowedClients) > 0 {
+		m.allowed = make(map[string]bool, len(cfg.AllowedClients))
+		for _, identity := range cfg.AllowedClients {
+			m.allowed[identity] = true
+		}
+	}
+
+	return m, nil
+}
+
+// loadCertificate reads the certificate and key files
+func (m *Manager) loadCertificate() error {
+	cert, err := tls.LoadX509KeyPair(m.cfg.CertFile, m.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	m.cert.Store(&cert)
+	return nil
+}
+
+// loadClientCA reads the CAs trusted to sign client certificates
+func (m *Manager) loadClientCA() error {
+	data, err := os.ReadFile(m.cfg.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in client CA file %s", m.cfg.ClientCAFile)
+	}
+	m.clientCA.Store(pool)
+	return nil
+}
+
+// Config returns the TLS configuration for the HTTP server. Each handshake
+// uses the latest certificate and client CAs.
+func (m *Manager) Config() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if m.cfg.ClientCAFile == "" {
+		base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return m.cert.Load(), nil
+		}
+		return base
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	if m.cfg.ClientAuth == "optional" {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.Certificates = []tls.Certificate{*m.cert.Load()}
+		cfg.ClientCAs = m.clientCA.Load()
+		cfg.ClientAuth = clientAuth
+		return cfg, nil
+	}
+	return base
+}
+
+// Watch reloads the certificate, key and client CA files when they change,
+// checking every interval until stop is closed. A file that fails to load,
+// e.g. a certificate written before its key, leaves the previous one in use
+// until the next change.
+func (m *Manager) Watch(interval time.Duration, stop <-chan struct{}) {
+	if m.cfg.SelfSigned && m.cfg.ClientCAFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	modTimes := m.modTimes()
+	for {
+		select {
+		case <-ticker.C:
+			latest := m.modTimes()
+			changed := func(files ...string) bool {
+				for _, file := range files {
+					if file != "" && !latest[file].Equal(modTimes[file]) {
+						return true
+					}
+				}
+				return false
+			}
+			certChanged, caChanged := changed(m.cfg.CertFile, m.cfg.KeyFile), changed(m.cfg.ClientCAFile)
+			modTimes = latest
+
+			if certChanged {
+				if err := m.loadCertificate(); err != nil {
+					log.Printf("Keeping previous TLS certificate: %v", err)
+				} else {
+					log.Printf("Reloaded TLS certificate from %s", m.cfg.CertFile)
+				}
+			}
+			if caChanged {
+				if err := m.loadClientCA(); err != nil {
+					log.Printf("Keeping previous client CAs: %v", err)
+				} else {
+					log.Printf("Reloaded client CAs from %s", m.cfg.ClientCAFile)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// modTimes returns the modification time of each watched file
+func (m *Manager) modTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{m.cfg.CertFile, m.cfg.KeyFile, m.cfg.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		} else {
+			modTimes[file] = time.Time{}
+		}
+	}
+	return modTimes
+}
+
+// identityKey is the request context key of the client identity
+type identityKey struct{}
+
+// Identity returns the user named by the request's client certificate, if it presented one
+func Identity(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// Identify maps verified client certificates to user identities, rejecting
+// clients not in server.tls.allowedClients. Requests without a certificate
+// only get this far when client certificates are optional, and are rejected
+// too when allowedClients is set.
+func (m *Manager) Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			if m.allowed != nil {
+				log.Printf("Rejected request without a client certificate from %s", r.RemoteAddr)
+				http.Error(w, "Client certificate required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity := m.identity(r.TLS.VerifiedChains[0][0])
+		if identity == "" || (m.allowed != nil && !m.allowed[identity]) {
+			log.Printf("Rejected client certificate %q from %s", identity, r.RemoteAddr)
+			http.Error(w, "Client certificate not allowed", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	})
+}
+
+// identity extracts the configured identity field from a client certificate
+func (m *Manager) identity(cert *x509.Certificate) string {
+	switch m.cfg.ClientIdentity {
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case "uri":
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
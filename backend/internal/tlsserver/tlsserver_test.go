@@ -0,0 +1,100 @@
+package tlsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+)
+
+// writeCA writes a CA certificate to a temporary file and returns its path
+func writeCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIdentify(t *testing.T) {
+	ca := writeCA(t)
+	tests := []struct {
+		name     string
+		allowed  []string
+		client   string // common name of the client certificate, empty for none
+		want     int
+		identity string
+	}{
+		{name: "no certificate", want: http.StatusOK},
+		{name: "no certificate with allowed clients", allowed: []string{"ops"}, want: http.StatusUnauthorized},
+		{name: "any verified client", client: "dev", want: http.StatusOK, identity: "dev"},
+		{name: "allowed client", allowed: []string{"ops"}, client: "ops", want: http.StatusOK, identity: "ops"},
+		{name: "other client", allowed: []string{"ops"}, client: "dev", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, err := New(config.TLS{
+				SelfSigned:     true,
+				ClientCAFile:   ca,
+				ClientAuth:     "optional",
+				ClientIdentity: "commonName",
+				AllowedClients: tt.allowed,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var identity string
+			var served bool
+			handler := manager.Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+				identity, _ = Identity(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "https://localhost:8000/api/v1/pods", nil)
+			r.TLS = &tls.ConnectionState{}
+			if tt.client != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.client}}
+				r.TLS.PeerCertificates = []*x509.Certificate{cert}
+				r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want || served != (tt.want == http.StatusOK) || identity != tt.identity {
+				t.Errorf("status %d, served %v as %q; want %d as %q", w.Code, served, identity, tt.want, tt.identity)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// dist holds the production build of the frontend, copied here by `make embed`.
+// Without it the binary still builds and serves a page explaining how to add it.
+//
+//go:embed all:dist
+var dist embed.FS
+
+// asset is an embedded file ready to be served
+type asset struct {
+	content []byte
+	etag    string
+}
+
+// Handler serves the embedded frontend mounted at basePath (e.g. "" or
+// "/observatory"). Unknown paths without a file extension get index.html so
+// the single-page app can handle them.
+type Handler struct {
+	assets map[string]asset
+	index  asset
+	built  bool
+}
+
+// NewHandler loads the embedded frontend for serving under basePath
+func NewHandler(basePath string) (*Handler, error) {
+	root, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(root, basePath)
+}
+
+// newHandler loads the frontend build in root
+func newHandler(root fs.FS, basePath string) (*Handler, error) {
+	h := &Handler{assets: make(map[string]asset)}
+	err := fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return err
+		}
+		content, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		h.assets["/"+name] = newAsset(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index, ok := h.assets["/index.html"]
+	if !ok {
+		h.index = newAsset([]byte(notBuiltPage))
+		return h, nil
+	}
+
+	// The frontend is built with relative asset URLs; the base element makes
+	// them and the API paths resolve under basePath from any page
+	base := []byte(`<head><base href="` + html.EscapeString(basePath+"/") + `">`)
+	h.index = newAsset(bytes.Replace(index.content, []byte("<head>"), base, 1))
+	h.built = true
+	delete(h.assets, "/index.html")
+	return h, nil
+}
+
+func newAsset(content []byte) asset {
+	sum := sha256.Sum256(content)
+	return asset{content: content, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+}
+
+// Built reports whether a frontend build was embedded
+func (h *Handler) Built() bool {
+	return h.built
+}
+
+// ServeHTTP serves a static file or the app's index page
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	a, ok := h.assets[name]
+	switch {
+	case ok && strings.HasPrefix(name, "/assets/"):
+		// Vite puts a content hash in these file names
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	case ok:
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	case path.Ext(name) == "" && !strings.HasPrefix(name, "/api/"):
+		// Revalidate the index page so a new build is picked up on reload
+		a = h.index
+		name = "/index.html"
+		w.Header().Set("Cache-Control", "no-cache")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", a.etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.content))
+}
+
+const notBuiltPage = `<!doctype html>
+<html lang="en">
+  <head><meta charset="UTF-8" /><title>Observatory</title></head>
+  <body>
+    <h1>Observatory backend</h1>
+    <p>This binary was built without the frontend. Run <code>make</code> at the top of the repository
+    to build the frontend and embed it, or run the Vite dev server from <code>frontend/</code>.</p>
+  </body>
+</html>
+`
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testIndex = `<!doctype html><html><head><title>Observatory</title></head><body></body></html>`
+
+// newTestHandler serves a small frontend build under basePath
+func newTestHandler(t *testing.T, basePath string) *Handler {
+	t.Helper()
+	h, err := newHandler(fstest.MapFS{
+		"index.html":           {Data: []byte(testIndex)},
+		"favicon.svg":          {Data: []byte("<svg></svg>")},
+		"assets/index-abc.js":  {Data: []byte("console.log(1)")},
+		"assets/index-abc.css": {Data: []byte("body{}")},
+		".gitkeep":             {},
+	}, basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Built() {
+		t.Fatal("handler with an index.html not reported built")
+	}
+	return h
+}
+
+func serve(h *Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerRoutes(t *testing.T) {
+	h := newTestHandler(t, "")
+	tests := []struct {
+		name, method, path string
+		want               int
+		body, cache        string
+	}{
+		{"root", http.MethodGet, "/", http.StatusOK, "<title>Observatory", "no-cache"},
+		{"app route", http.MethodGet, "/clusters/prod", http.StatusOK, "<title>Observatory", "no-cache"},
+		{"hashed asset", http.MethodGet, "/assets/index-abc.js", http.StatusOK, "console.log(1)", "public, max-age=31536000, immutable"},
+		{"top-level file", http.MethodGet, "/favicon.svg", http.StatusOK, "<svg></svg>", "public, max-age=3600"},
+		{"head", http.MethodHead, "/assets/index-abc.css", http.StatusOK, "", "public, max-age=31536000, immutable"},
+		{"api path", http.MethodGet, "/api/v1/unknown", http.StatusNotFound, "", ""},
+		{"missing asset", http.MethodGet, "/assets/index-old.js", http.StatusNotFound, "", ""},
+		{"missing file", http.MethodGet, "/robots.txt", http.StatusNotFound, "", ""},
+		{"hidden file", http.MethodGet, "/.gitkeep", http.StatusNotFound, "", ""},
+		{"post", http.MethodPost, "/", http.StatusMethodNotAllowed, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.path, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.body != "" && !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body %q, want it to contain %q", rec.Body.String(), tt.body)
+			}
+			if tt.method == http.MethodHead && rec.Body.Len() != 0 {
+				t.Errorf("HEAD returned a %d byte body", rec.Body.Len())
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.cache {
+				t.Errorf("Cache-Control %q, want %q", got, tt.cache)
+			}
+		})
+	}
+}
+
+func TestHandlerInjectsBaseHref(t *testing.T) {
+	tests := []struct {
+		basePath, want string
+	}{
+		{"", `<head><base href="/"><title>`},
+		{"/observatory", `<head><base href="/observatory/"><title>`},
+		{`/a"b`, `<head><base href="/a&#34;b/"><title>`},
+	}
+	for _, tt := range tests {
+		h := newTestHandler(t, tt.basePath)
+		if body := serve(h, http.MethodGet, "/pods", nil).Body.String(); !strings.Contains(body, tt.want) {
+			t.Errorf("base path %q: index %q, want it to contain %q", tt.basePath, body, tt.want)
+		}
+	}
+}
+
+func TestHandlerConditionalRequests(t *testing.T) {
+	h := newTestHandler(t, "/observatory")
+	for _, path := range []string{"/", "/assets/index-abc.js"} {
+		rec := serve(h, http.MethodGet, path, nil)
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: status %d with ETag %q, want 200 with an ETag", path, rec.Code, etag)
+		}
+
+		rec = serve(h, http.MethodGet, path, http.Header{"If-None-Match": {etag}})
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s: status %d with a %d byte body for a matching ETag, want 304", path, rec.Code, rec.Body.Len())
+		}
+
+		rec = serve(h, http.MethodGet, path, http.Header{"If-None-Match": {`"stale"`}})
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d for a stale ETag, want 200", path, rec.Code)
+		}
+	}
+
+	// Every app route serves the same index, so they share its ETag
+	if a, b := serve(h, http.MethodGet, "/", nil).Header().Get("ETag"), serve(h, http.MethodGet, "/nodes", nil).Header().Get("ETag"); a != b {
+		t.Errorf("index ETags %s and %s differ between routes", a, b)
+	}
+}
+
+func TestHandlerWithoutBuild(t *testing.T) {
+	h, err := newHandler(fstest.MapFS{".gitkeep": {}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Built() {
+		t.Error("handler without an index.html reported built")
+	}
+	if rec := serve(h, http.MethodGet, "/", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "built without the frontend") {
+		t.Errorf("status %d with body %q, want the not-built page", rec.Code, rec.Body.String())
+	}
+}
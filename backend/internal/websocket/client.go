@@ -1,10 +1,12 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/craigderington/lantern/internal/k8s"
 	"github.com/gorilla/websocket"
 )
 
@@ -18,17 +20,23 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 512
+	// Maximum message size allowed from peer, enough for a subscription to many namespaces
+	maxMessageSize = 4096
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins in development
-		return true
-	},
+// newUpgrader creates the upgrader for WebSocket connections from origins accepted by allowOrigin
+func newUpgrader(allowOrigin func(origin, host string) bool) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		// Preferred first; clients offering neither get JSON
+		Subprotocols: []string{SubprotocolMsgpack, SubprotocolJSON},
+		// Negotiate permessage-deflate with clients that offer it
+		EnableCompression: true,
+		CheckOrigin: func(r *http.Request) bool {
+			return allowOrigin(r.Header.Get("Origin"), r.Host)
+		},
+	}
 }
 
 // Client is a middleman between the websocket connection and the hub
@@ -38,14 +46,24 @@ type Client struct {
 	// The websocket connection
 	conn *websocket.Conn
 
-	// Buffered channel of outbound messages
-	send chan []byte
+	// Bounded queue of outbound messages
+	out *outbox
+
+	// Wire encoding negotiated for this connection
+	codec *codec
+
+	// Level of detail the client asked for
+	view *view
+
+	// Epoch and last sequence number seen before reconnecting, if resuming
+	resumeEpoch string
+	resumeSeq   uint64
 }
 
 // readPump pumps messages from the websocket connection to the hub
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregisterClient(c)
 		c.conn.Close()
 	}()
 
@@ -57,13 +75,75 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		frameType, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		// Browsers may send JSON text frames even on a binary connection
+		unmarshal := json.Unmarshal
+		if frameType == websocket.BinaryMessage {
+			unmarshal = c.codec.unmarshal
+		}
+
+		var msg ClientMessage
+		if err := unmarshal(data, &msg); err != nil {
+			log.Printf("Ignoring malformed client message: %v", err)
+			continue
+		}
+		c.handleMessage(msg)
+	}
+}
+
+// handleMessage applies a message sent by the browser
+func (c *Client) handleMessage(msg ClientMessage) {
+	switch msg.Type {
+	case "set_view":
+		mode, groupBy := msg.View, msg.GroupBy
+		if groupBy == "" {
+			groupBy = k8s.GroupByNamespace
+		}
+		if (mode != ViewPods && mode != ViewGalaxy) || !k8s.ValidGroupBy(groupBy) {
+			log.Printf("Ignoring invalid view %q grouped by %q", mode, groupBy)
+			return
+		}
+		if mode == ViewGalaxy && c.hub.aggregator == nil {
+			log.Printf("Ignoring galaxy view request: aggregation is not enabled")
+			return
+		}
+
+		c.view.set(mode, groupBy)
+		if mode == ViewGalaxy {
+			if err := c.hub.SendToClient(c, "clusters_update", c.hub.aggregator.Clusters(groupBy)); err != nil {
+				log.Printf("Error sending clusters: %v", err)
+			}
+		}
+
+	case "subscribe":
+		sub, err := newSubscription(msg.Namespaces, msg.LabelSelector, msg.Events, msg.Metrics)
+		if err != nil {
+			log.Printf("Ignoring subscription: %v", err)
+			return
+		}
+
+		// Replace the client's state with what it is now subscribed to
+		c.view.subscribe(sub)
+		c.hub.Resync(c)
+
+	case "expand", "collapse":
+		if c.hub.aggregator == nil || msg.Group == "" {
+			return
+		}
+
+		groupBy := c.view.expand(msg.Group, msg.Type == "expand")
+		if msg.Type == "expand" {
+			if err := c.hub.SendToClient(c, "group_pods", c.hub.aggregator.GroupPods(groupBy, msg.Group)); err != nil {
+				log.Printf("Error sending pods for group %s: %v", msg.Group, err)
+			}
+		}
 	}
 }
 
@@ -73,32 +153,26 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.out.ready:
+			items, ok := c.out.take()
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				// The hub closed the channel
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// The hub closed the outbox, either for this client or because it is shutting down
+				closeMessage := []byte{}
+				select {
+				case <-c.hub.done:
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				default:
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued messages to the current websocket message
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			if err := c.write(items); err != nil {
 				return
 			}
 
@@ -110,3 +184,32 @@ func (c *Client) writePump() {
 		}
 	}
 }
+
+// write sends queued messages. JSON messages are joined with newlines into a
+// single text frame; binary messages can't be delimited and get a frame each.
+func (c *Client) write(items []outboxItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	if c.codec.frameType == websocket.BinaryMessage {
+		for _, item := range items {
+			if err := c.conn.WriteMessage(websocket.BinaryMessage, item.encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		if i > 0 {
+			w.Write([]byte{'\n'})
+		}
+		w.Write(item.encoded)
+	}
+	return w.Close()
+}
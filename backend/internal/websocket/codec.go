@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// SubprotocolJSON selects JSON text frames (the default)
+	SubprotocolJSON = "observatory.v1.json"
+	// SubprotocolMsgpack selects MessagePack binary frames
+	SubprotocolMsgpack = "observatory.v1.msgpack"
+)
+
+// codec is a wire encoding for events sent to clients
+type codec struct {
+	name string
+	// websocket.TextMessage or websocket.BinaryMessage
+	frameType int
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+var jsonCodec = &codec{
+	name:      "json",
+	frameType: websocket.TextMessage,
+	marshal:   json.Marshal,
+	unmarshal: json.Unmarshal,
+}
+
+// msgpackCodec encodes the objects JSON clients receive, so clients decode
+// both into identical objects: the same field names and omitted fields, and
+// timestamps as RFC 3339 strings rather than msgpack's timestamp extension
+var msgpackCodec = &codec{
+	name:      "msgpack",
+	frameType: websocket.BinaryMessage,
+	marshal:   marshalMsgpack,
+	unmarshal: unmarshalMsgpack,
+}
+
+// codecs maps subprotocols and ?encoding= values to codecs
+var codecs = map[string]*codec{
+	SubprotocolJSON:    jsonCodec,
+	SubprotocolMsgpack: msgpackCodec,
+	"json":             jsonCodec,
+	"msgpack":          msgpackCodec,
+}
+
+// marshalMsgpack transcodes the JSON encoding of v. Encoding the Go value
+// directly would differ from JSON wherever encoding/json has its own rules:
+// omitzero, MarshalJSON methods and time.Time.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(jsonNumbers(generic)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonNumbers replaces the json.Numbers in a decoded JSON value with integers
+// where they are whole and floats otherwise
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = jsonNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return n
+		}
+		n, _ := v.Float64()
+		return n
+	}
+	return v
+}
+
+func unmarshalMsgpack(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
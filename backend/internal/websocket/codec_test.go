@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/k8s"
+)
+
+func TestMsgpackMatchesJSON(t *testing.T) {
+	restarts := int32(3)
+	event := Event{
+		Version: ProtocolVersion,
+		Type:    "backend_status",
+		Seq:     42,
+		Data: k8s.BackendStatus{
+			State: k8s.StateDegraded,
+			Since: time.Date(2025, 1, 15, 10, 35, 25, 123000000, time.UTC),
+			// Zero times are omitted with omitzero, which msgpack has no equivalent of
+			Watches: []k8s.WatchStatus{{Resource: "pods", Synced: true, Started: time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)}},
+		},
+	}
+	metrics := Event{
+		Version: ProtocolVersion,
+		Type:    "metrics_update",
+		Data: k8s.MetricsUpdate{
+			Type: "metrics_update",
+			Pods: []k8s.PodMetricsData{{
+				Name:        "web",
+				TotalCPU:    250.5,
+				TotalMemory: 128,
+				Restarts:    &restarts,
+				Filesystem:  &k8s.FilesystemUsage{UsedBytes: 1 << 40},
+			}},
+		},
+	}
+
+	for _, v := range []Event{event, metrics} {
+		encoded, err := jsonCodec.marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromJSON interface{}
+		if err := json.Unmarshal(encoded, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err = msgpackCodec.marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromMsgpack interface{}
+		if err := msgpackCodec.unmarshal(encoded, &fromMsgpack); err != nil {
+			t.Fatal(err)
+		}
+
+		// JSON decodes every number as a float64
+		if !reflect.DeepEqual(fromJSON, floats(fromMsgpack)) {
+			t.Errorf("%s differs:\njson:    %v\nmsgpack: %v", v.Type, fromJSON, fromMsgpack)
+		}
+	}
+}
+
+// floats converts the numbers in a decoded msgpack value to float64
+func floats(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = floats(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = floats(item)
+		}
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32:
+		return reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Interface()
+	}
+	return v
+}
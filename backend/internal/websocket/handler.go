@@ -1,27 +1,119 @@
 package websocket
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
 )
 
-// ServeWs handles websocket requests from clients
+// ServeWs handles websocket requests from clients.
+// Reconnecting clients pass ?epoch=X&lastSeq=N to resume where they left off.
+// The initial subscription can be given as ?namespaces=a,b&labelSelector=app=web&events=pods_changed&metrics=false.
+// The encoding is negotiated through the Sec-WebSocket-Protocol header, or
+// with ?encoding=json|msgpack for clients that can't set it; ?compression=false
+// turns off permessage-deflate for the connection.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	sub, err := subscriptionFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	enc := jsonCodec
+	if encoding := r.URL.Query().Get("encoding"); encoding != "" {
+		var ok bool
+		if enc, ok = codecs[encoding]; !ok {
+			http.Error(w, fmt.Sprintf("unsupported encoding %q", encoding), http.StatusBadRequest)
+			return
+		}
+	}
+
+	compression := true
+	if value := r.URL.Query().Get("compression"); value != "" {
+		if compression, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid compression %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
+	conn.EnableWriteCompression(compression)
+
+	// A negotiated subprotocol takes precedence over the query parameter
+	if protocol := conn.Subprotocol(); protocol != "" {
+		enc = codecs[protocol]
+	}
 
 	client := &Client{
-		hub:  hub,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:   hub,
+		conn:  conn,
+		out:   newOutbox(hub.clientQueueSize),
+		codec: enc,
+		view:  newView(sub),
 	}
 
-	client.hub.register <- client
+	if lastSeq := r.URL.Query().Get("lastSeq"); lastSeq != "" {
+		seq, err := strconv.ParseUint(lastSeq, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring invalid lastSeq %q: %v", lastSeq, err)
+		} else {
+			client.resumeEpoch = r.URL.Query().Get("epoch")
+			client.resumeSeq = seq
+		}
+	}
+
+	if !hub.registerClient(client) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		conn.Close()
+		return
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in new goroutines
 	go client.writePump()
 	go client.readPump()
 }
+
+// ServeStats reports the hub's delivery counters
+func ServeStats(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hub.Stats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// subscriptionFromQuery builds a client's initial subscription from the connection URL
+func subscriptionFromQuery(query url.Values) (*subscription, error) {
+	var metrics *bool
+	if value := query.Get("metrics"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics %q: %w", value, err)
+		}
+		metrics = &enabled
+	}
+
+	return newSubscription(splitList(query.Get("namespaces")), query.Get("labelSelector"), splitList(query.Get("events")), metrics)
+}
+
+// splitList splits a comma-separated query parameter
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
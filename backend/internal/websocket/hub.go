@@ -1,9 +1,17 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+	"github.com/craigderington/lantern/internal/k8s"
+	"github.com/gorilla/websocket"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to them
@@ -11,8 +19,25 @@ type Hub struct {
 	// Registered clients
 	clients map[*Client]bool
 
-	// Inbound messages from clients
-	broadcast chan []byte
+	// Outbound messages for all clients, waiting for Run. Guarded by pendingMu
+	// so that BroadcastEvent never blocks the event forwarders. Like a client's
+	// queue it is bounded, holding up to pendingLimit messages; on overflow it
+	// is emptied and every client resynced.
+	pendingMu        sync.Mutex
+	pending          []message
+	pendingLimit     int
+	pendingOverflow  bool
+	pendingCoalesced uint64
+	pendingDropped   uint64
+
+	// Signalled when messages are added to pending
+	wake chan struct{}
+
+	// Outbound messages for a single client
+	direct chan directMessage
+
+	// Clients whose subscription changed and need a fresh snapshot
+	resync chan *Client
 
 	// Register requests from clients
 	register chan *Client
@@ -20,27 +45,164 @@ type Hub struct {
 	// Unregister requests from clients
 	unregister chan *Client
 
+	// Health checks waiting for the main loop to answer
+	probe chan chan struct{}
+
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
+
+	// Source of aggregated clusters for galaxy-mode clients
+	aggregator *k8s.Aggregator
+
+	// Builds the state sent to clients as soon as they connect
+	snapshot func() (interface{}, error)
+
+	// Snapshots are built outside the main loop so that reading the cluster
+	// state never holds up broadcasts. Clients waiting for one share the build
+	// in progress and are skipped by broadcasts until it arrives.
+	snapshots chan builtSnapshot
+	awaiting  map[*Client]bool
+	building  bool
+
+	// Identifies this hub instance; sequence numbers restart with a new epoch
+	epoch string
+
+	// Sequence number of the last broadcast message
+	seq uint64
+
+	// Recent broadcast messages for clients resuming after a reconnect
+	replay *replayBuffer
+
+	// Number of messages queued for a client before it is considered too slow
+	clientQueueSize int
+
+	// Upgrades WebSocket connections from the origins allowed by server
+	upgrader websocket.Upgrader
+	server   atomic.Pointer[config.Server]
+
+	// Delivery counters across all clients
+	stats HubStats
+
+	// Closed when Run returns, so clients stop waiting on the hub
+	done chan struct{}
+
+	// WebSocket write pumps still running, which send the close frames on shutdown
+	pumps sync.WaitGroup
+}
+
+// HubStats counts the messages handled by the hub
+type HubStats struct {
+	Clients    int    `json:"clients"`
+	Broadcasts uint64 `json:"broadcasts"`
+	Coalesced  uint64 `json:"coalesced"` // superseded before being sent
+	Dropped    uint64 `json:"dropped"`   // discarded when a client or the hub fell too far behind
+	Resyncs    uint64 `json:"resyncs"`   // snapshots sent to clients after messages were dropped
+}
+
+// message is a sequenced broadcast event along with its encodings, shared
+// between all clients using the same codec
+type message struct {
+	seq       uint64
+	eventType string
+	data      interface{}
+	raw       json.RawMessage
+	encoded   map[*codec][]byte
+}
+
+// encode returns the message encoded with a codec, encoding it only once per
+// codec. The caller must hold h.mu.
+func (m message) encode(c *codec) ([]byte, error) {
+	if encoded, ok := m.encoded[c]; ok {
+		return encoded, nil
+	}
+
+	encoded, err := c.marshal(Event{Version: ProtocolVersion, Type: m.eventType, Seq: m.seq, Data: payload(c, m.data, m.raw)})
+	if err != nil {
+		return nil, err
+	}
+	m.encoded[c] = encoded
+	return encoded, nil
+}
+
+// payload returns the data to encode with a codec: JSON clients reuse the
+// JSON encoded when the event was broadcast
+func payload(c *codec, data interface{}, raw json.RawMessage) interface{} {
+	if c == jsonCodec && raw != nil {
+		return raw
+	}
+	return data
+}
+
+// builtSnapshot is a snapshot built for the clients awaiting one. seq is the
+// sequence number when the build started; later broadcasts may not be in it.
+type builtSnapshot struct {
+	seq  uint64
+	data interface{}
+	err  error
+}
+
+// directMessage is an event addressed to one client
+type directMessage struct {
+	client    *Client
+	eventType string
+	data      interface{}
+	raw       json.RawMessage
 }
 
 // NewHub creates a new Hub
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+func NewHub(cfg *config.Config) *Hub {
+	h := &Hub{
+		wake:            make(chan struct{}, 1),
+		pendingLimit:    cfg.Stream.BufferSize,
+		direct:          make(chan directMessage, cfg.Stream.BufferSize),
+		resync:          make(chan *Client, 16),
+		register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		probe:           make(chan chan struct{}),
+		clients:         make(map[*Client]bool),
+		snapshots:       make(chan builtSnapshot),
+		awaiting:        make(map[*Client]bool),
+		epoch:           fmt.Sprintf("%x", time.Now().UnixNano()),
+		replay:          newReplayBuffer(cfg.Stream.ReplayBufferSize),
+		clientQueueSize: cfg.Stream.ClientQueueSize,
+		done:            make(chan struct{}),
 	}
+	h.upgrader = newUpgrader(func(origin, host string) bool {
+		return h.server.Load().AllowsOrigin(origin, host)
+	})
+	h.server.Store(&cfg.Server)
+	return h
 }
 
-// Run starts the hub's main loop
-func (h *Hub) Run() {
+// Reconfigure prepares the hub for a reloaded configuration. Allowed origins
+// apply to new connections; connected clients stay connected.
+func (h *Hub) Reconfigure(cfg *config.Config) (func(), error) {
+	server := cfg.Server
+	return func() {
+		h.server.Store(&server)
+	}, nil
+}
+
+// Run starts the hub's main loop. When ctx is cancelled it disconnects every
+// client and returns once the WebSocket clients have been sent a close frame.
+func (h *Hub) Run(ctx context.Context) {
 	for {
 		select {
+		case <-ctx.Done():
+			h.shutdown()
+			return
+
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
+			if client.conn != nil {
+				h.pumps.Add(1)
+			}
+			// Registration and broadcasts are handled by this loop, so every
+			// broadcast processed after this point follows the snapshot or replay
+			if !h.resume(client) {
+				h.requestSnapshot(client)
+			}
 			h.mu.Unlock()
 			log.Printf("Client connected. Total clients: %d", len(h.clients))
 
@@ -48,44 +210,458 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
-				log.Printf("Client disconnected. Total clients: %d", len(h.clients))
+				delete(h.awaiting, client)
+				client.out.close()
+				stats := client.out.stats()
+				log.Printf("Client disconnected (sent %d, coalesced %d, dropped %d, resyncs %d). Total clients: %d",
+					stats.Queued, stats.Coalesced, stats.Dropped, stats.Resyncs, len(h.clients))
 			}
 			h.mu.Unlock()
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+		case <-h.wake:
+			h.pendingMu.Lock()
+			pending, overflow := h.pending, h.pendingOverflow
+			h.pending, h.pendingOverflow = nil, false
+			h.pendingMu.Unlock()
+
+			h.mu.Lock()
+			if overflow {
+				h.resyncAll()
+			}
+			for _, msg := range pending {
+				h.broadcastMessage(msg)
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
+
+		case msg := <-h.direct:
+			h.mu.Lock()
+			if _, ok := h.clients[msg.client]; ok {
+				h.deliverDirect(msg)
+			}
+			h.mu.Unlock()
+
+		case client := <-h.resync:
+			h.mu.Lock()
+			if _, ok := h.clients[client]; ok {
+				h.requestSnapshot(client)
+			}
+			h.mu.Unlock()
+
+		case built := <-h.snapshots:
+			h.mu.Lock()
+			h.finishSnapshot(built)
+			h.mu.Unlock()
+
+		case reply := <-h.probe:
+			close(reply)
 		}
 	}
 }
 
-// BroadcastEvent sends an event to all connected clients
-func (h *Hub) BroadcastEvent(eventType string, data interface{}) error {
-	event := Event{
-		Type: eventType,
-		Data: data,
+// Ping checks that the main loop is running and not stuck, waiting until ctx is done
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.probe <- reply:
+	case <-h.done:
+		return fmt.Errorf("hub stopped")
+	case <-ctx.Done():
+		return fmt.Errorf("hub loop not responding: %w", ctx.Err())
+	}
+	<-reply
+	return nil
+}
+
+// shutdown closes every client's queue, which makes WebSocket clients send a
+// going-away close frame and SSE streams end, and waits for the write pumps
+func (h *Hub) shutdown() {
+	close(h.done)
+
+	h.mu.Lock()
+	for client := range h.clients {
+		delete(h.clients, client)
+		client.out.close()
+	}
+	h.mu.Unlock()
+
+	h.pumps.Wait()
+	log.Println("WebSocket hub stopped")
+}
+
+// registerClient hands a new client to the hub, reporting false if the hub has stopped
+func (h *Hub) registerClient(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// unregisterClient removes a client from the hub unless it has already stopped
+func (h *Hub) unregisterClient(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
 	}
+}
+
+// broadcastMessage sequences a message, records it for replay and delivers
+// it to every client. The caller must hold h.mu.
+func (h *Hub) broadcastMessage(msg message) {
+	h.seq++
+	msg.seq = h.seq
+	msg.encoded = make(map[*codec][]byte, len(codecs))
+	if _, err := msg.encode(jsonCodec); err != nil {
+		log.Printf("Error encoding %s: %v", msg.eventType, err)
+		return
+	}
+	h.replay.add(msg)
+	h.stats.Broadcasts++
+
+	for client := range h.clients {
+		// Clients awaiting a snapshot get what they missed once it arrives
+		if h.awaiting[client] {
+			continue
+		}
+		h.deliverScoped(client, msg)
+	}
+}
+
+// deliver queues a message for a client. A client that falls too far behind
+// loses its queued messages and gets a fresh snapshot instead, so a briefly
+// slow browser catches up rather than being disconnected.
+// The caller must hold h.mu.
+func (h *Hub) deliver(client *Client, item outboxItem) pushResult {
+	result, dropped := client.out.push(item)
+	switch result {
+	case pushCoalesced:
+		h.stats.Coalesced++
+	case pushOverflow:
+		h.stats.Dropped += uint64(dropped)
+		h.stats.Resyncs++
+		log.Printf("Client fell %d messages behind, resyncing", dropped)
+		if !h.requestSnapshot(client) {
+			// Without a snapshot the client can't recover, so hang up and let it reconnect
+			h.disconnect(client)
+		}
+	}
+	return result
+}
+
+// resyncAll sends every client a fresh snapshot after broadcasts were
+// dropped. The dropped messages take up one sequence number and the replay
+// buffer is emptied, so neither a snapshot built nor a resume from before the
+// drop can skip over it. The caller must hold h.mu.
+func (h *Hub) resyncAll() {
+	h.seq++
+	h.replay.reset()
+	for client := range h.clients {
+		h.stats.Resyncs++
+		if !h.requestSnapshot(client) {
+			h.disconnect(client)
+		}
+	}
+}
+
+// disconnect drops a client, closing its queue so the writer hangs up.
+// The caller must hold h.mu.
+func (h *Hub) disconnect(client *Client) {
+	delete(h.clients, client)
+	delete(h.awaiting, client)
+	client.out.close()
+}
 
-	message, err := json.Marshal(event)
+// deliverScoped delivers a broadcast message narrowed to the client's view.
+// The caller must hold h.mu.
+func (h *Hub) deliverScoped(client *Client, msg message) pushResult {
+	narrowed, ok := client.view.scope(msg.eventType, msg.data)
+	if !ok {
+		return pushQueued
+	}
+
+	var encoded []byte
+	var err error
+	if narrowed != nil {
+		encoded, err = client.codec.marshal(Event{Version: ProtocolVersion, Type: msg.eventType, Seq: msg.seq, Data: narrowed})
+	} else {
+		encoded, err = msg.encode(client.codec)
+	}
+	if err != nil {
+		log.Printf("Error encoding %s for client: %v", msg.eventType, err)
+		return pushQueued
+	}
+	return h.deliver(client, outboxItem{
+		key:       coalesceKey(msg.eventType, msg.data),
+		eventType: msg.eventType,
+		seq:       msg.seq,
+		encoded:   encoded,
+	})
+}
+
+// deliverDirect delivers a message addressed to one client, narrowed to its
+// view. The caller must hold h.mu.
+func (h *Hub) deliverDirect(msg directMessage) {
+	narrowed, ok := msg.client.view.scope(msg.eventType, msg.data)
+	if !ok {
+		return
+	}
+
+	data := payload(msg.client.codec, msg.data, msg.raw)
+	if narrowed != nil {
+		data = narrowed
+	}
+	encoded, err := msg.client.codec.marshal(Event{Version: ProtocolVersion, Type: msg.eventType, Data: data})
+	if err != nil {
+		log.Printf("Error encoding %s for client: %v", msg.eventType, err)
+		return
+	}
+	h.deliver(msg.client, outboxItem{
+		key:       coalesceKey(msg.eventType, msg.data),
+		eventType: msg.eventType,
+		encoded:   encoded,
+	})
+}
+
+// resume replays the messages a reconnecting client missed. It returns false
+// when the client is new, comes from another epoch or missed too much, in
+// which case it needs a snapshot instead. A replay that overflows the client's
+// queue stops there, the overflow having requested a snapshot already.
+// The caller must hold h.mu.
+func (h *Hub) resume(client *Client) bool {
+	if client.resumeEpoch != h.epoch || client.resumeSeq == 0 {
+		return false
+	}
+
+	missed, ok := h.replay.since(client.resumeSeq, h.seq)
+	if !ok {
+		log.Printf("Client resume from seq %d not possible, sending snapshot", client.resumeSeq)
+		return false
+	}
+
+	for _, msg := range missed {
+		// An overflow empties the queue and asks for a snapshot, which replaces the rest of the replay
+		if h.deliverScoped(client, msg) == pushOverflow {
+			log.Printf("Client resume from seq %d overflowed its queue, sending snapshot", client.resumeSeq)
+			return true
+		}
+	}
+
+	encoded, err := client.codec.marshal(Event{
+		Version: ProtocolVersion,
+		Type:    "resumed",
+		Seq:     h.seq,
+		Epoch:   h.epoch,
+		Data:    Resumed{FromSeq: client.resumeSeq, ToSeq: h.seq, Replayed: len(missed)},
+	})
+	if err != nil {
+		log.Printf("Error encoding resumed: %v", err)
+		return false
+	}
+	h.deliver(client, outboxItem{eventType: "resumed", seq: h.seq, encoded: encoded})
+
+	log.Printf("Client resumed from seq %d, replayed %d messages", client.resumeSeq, len(missed))
+	return true
+}
+
+// requestSnapshot queues a client for the next snapshot, starting a build
+// unless one is in progress. It reports false when the hub has no snapshot
+// to send. The caller must hold h.mu.
+func (h *Hub) requestSnapshot(client *Client) bool {
+	if h.snapshot == nil {
+		return false
+	}
+
+	h.awaiting[client] = true
+	if !h.building {
+		h.building = true
+		go h.buildSnapshot(h.seq)
+	}
+	return true
+}
+
+// buildSnapshot reads the cluster state and hands it to the main loop
+func (h *Hub) buildSnapshot(seq uint64) {
+	data, err := h.snapshot()
+	select {
+	case h.snapshots <- builtSnapshot{seq: seq, data: data, err: err}:
+	case <-h.done:
+	}
+}
+
+// finishSnapshot sends a built snapshot to every client awaiting it.
+// The caller must hold h.mu.
+func (h *Hub) finishSnapshot(built builtSnapshot) {
+	waiting := h.awaiting
+	h.awaiting = make(map[*Client]bool)
+	h.building = false
+
+	for client := range waiting {
+		if _, ok := h.clients[client]; !ok {
+			continue
+		}
+		if built.err != nil {
+			log.Printf("Error building snapshot: %v", built.err)
+			h.disconnect(client)
+			continue
+		}
+		h.sendSnapshot(client, built)
+	}
+}
+
+// sendSnapshot sends a snapshot to a client followed by the broadcasts made
+// while it was built. The caller must hold h.mu.
+func (h *Hub) sendSnapshot(client *Client, built builtSnapshot) {
+	missed, ok := h.replay.since(built.seq, h.seq)
+	if !ok {
+		// More was broadcast during the build than the replay buffer holds
+		h.requestSnapshot(client)
+		return
+	}
+
+	snapshot := built.data
+	if narrowed, ok := client.view.scope("snapshot", snapshot); narrowed != nil && ok {
+		snapshot = narrowed
+	}
+
+	// Tag the snapshot with the sequence it is current up to so the client can resume from it
+	encoded, err := client.codec.marshal(Event{Version: ProtocolVersion, Type: "snapshot", Seq: built.seq, Epoch: h.epoch, Data: snapshot})
+	if err != nil {
+		log.Printf("Error encoding snapshot: %v", err)
+		h.disconnect(client)
+		return
+	}
+	if h.deliver(client, outboxItem{eventType: "snapshot", seq: built.seq, encoded: encoded}) == pushOverflow {
+		return
+	}
+
+	for _, msg := range missed {
+		if h.deliverScoped(client, msg) == pushOverflow {
+			return
+		}
+	}
+}
+
+// SetSnapshotFunc sets the function building the snapshot sent to each client
+// on connect. It is called outside the hub's main loop, one build at a time.
+func (h *Hub) SetSnapshotFunc(snapshot func() (interface{}, error)) {
+	h.snapshot = snapshot
+}
+
+// SetAggregator enables galaxy mode, serving aggregated clusters from the aggregator
+func (h *Hub) SetAggregator(aggregator *k8s.Aggregator) {
+	h.aggregator = aggregator
+}
+
+// SendToClient sends an event to a single client
+func (h *Hub) SendToClient(client *Client, eventType string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case h.direct <- directMessage{client: client, eventType: eventType, data: data, raw: raw}:
+	case <-h.done:
+	}
+	return nil
+}
+
+// Resync sends a client a fresh snapshot, e.g. after it changed its subscription
+func (h *Hub) Resync(client *Client) {
+	select {
+	case h.resync <- client:
+	case <-h.done:
+	}
+}
+
+// BroadcastEvent sends an event to all connected clients. It never blocks:
+// events that supersede a still-pending one of the same kind replace it, and
+// if the hub falls too far behind the pending events are dropped and every
+// client gets a fresh snapshot.
+func (h *Hub) BroadcastEvent(eventType string, data interface{}) error {
+	raw, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	h.broadcast <- message
+	msg := message{eventType: eventType, data: data, raw: raw}
+	h.pendingMu.Lock()
+	if key := coalesceKey(eventType, data); key != "" {
+		for i := range h.pending {
+			if coalesceKey(h.pending[i].eventType, h.pending[i].data) == key {
+				h.pending = append(h.pending[:i], h.pending[i+1:]...)
+				h.pendingCoalesced++
+				break
+			}
+		}
+	}
+	if len(h.pending) >= h.pendingLimit {
+		dropped := len(h.pending) + 1
+		h.pendingDropped += uint64(dropped)
+		h.pending = nil
+		h.pendingOverflow = true
+		h.pendingMu.Unlock()
+		log.Printf("Hub fell %d broadcasts behind, resyncing all clients", dropped)
+	} else {
+		h.pending = append(h.pending, msg)
+		h.pendingMu.Unlock()
+	}
+
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
 	return nil
 }
 
+// Stats returns the hub's delivery counters
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := h.stats
+	stats.Clients = len(h.clients)
+
+	h.pendingMu.Lock()
+	stats.Coalesced += h.pendingCoalesced
+	stats.Dropped += h.pendingDropped
+	h.pendingMu.Unlock()
+	return stats
+}
+
+// coalesceKey identifies messages that replace older ones of the same kind,
+// e.g. only the latest metrics_update matters. Empty for messages that must
+// all be delivered.
+func coalesceKey(eventType string, data interface{}) string {
+	switch d := data.(type) {
+	case k8s.MetricsUpdate, k8s.BackendStatus:
+		return eventType
+	case k8s.ClustersUpdate:
+		return eventType + ":" + d.GroupBy
+	}
+	return ""
+}
+
+// ProtocolVersion is the version of the event protocol, sent with every event.
+// It changes when events change incompatibly; adding fields does not.
+const ProtocolVersion = 1
+
 // Event represents a WebSocket event
 type Event struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	// Seq orders broadcast events; direct messages carry the sequence they follow
+	Seq uint64 `json:"seq,omitempty"`
+	// Epoch is set on snapshot and resumed messages and must be sent back when resuming
+	Epoch string      `json:"epoch,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// Resumed is sent instead of a snapshot once the events a reconnecting
+// client missed have been replayed
+type Resumed struct {
+	FromSeq  uint64 `json:"fromSeq"`
+	ToSeq    uint64 `json:"toSeq"`
+	Replayed int    `json:"replayed"`
 }
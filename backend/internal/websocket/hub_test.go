@@ -0,0 +1,359 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/craigderington/lantern/internal/config"
+	"github.com/craigderington/lantern/internal/k8s"
+)
+
+// testClient is a hub client whose received events can be inspected
+type testClient struct {
+	*Client
+
+	mu     sync.Mutex
+	events []Event
+}
+
+func newTestHub(t *testing.T, queueSize, replaySize int, snapshot func() (interface{}, error)) *Hub {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Stream.ClientQueueSize = queueSize
+	cfg.Stream.ReplayBufferSize = replaySize
+
+	hub := NewHub(cfg)
+	hub.SetSnapshotFunc(snapshot)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return hub
+}
+
+func emptySnapshot() (interface{}, error) {
+	return k8s.Snapshot{}, nil
+}
+
+// connect registers a client. Clients that drain read their queue like a
+// write pump would; the others never read it.
+func connect(t *testing.T, hub *Hub, drain bool) *testClient {
+	t.Helper()
+	sub, err := newSubscription(nil, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &testClient{Client: &Client{
+		hub:   hub,
+		out:   newOutbox(hub.clientQueueSize),
+		codec: jsonCodec,
+		view:  newView(sub),
+	}}
+	if drain {
+		go func() {
+			for range client.out.ready {
+				items, ok := client.out.take()
+				if !ok {
+					return
+				}
+				client.record(t, items)
+			}
+		}()
+	}
+	if !hub.registerClient(client.Client) {
+		t.Fatal("hub stopped")
+	}
+	return client
+}
+
+func (c *testClient) record(t *testing.T, items []outboxItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, item := range items {
+		var event Event
+		if err := json.Unmarshal(item.encoded, &event); err != nil {
+			t.Errorf("undecodable %s: %v", item.eventType, err)
+			continue
+		}
+		c.events = append(c.events, event)
+	}
+}
+
+// received returns the events a draining client has read so far
+func (c *testClient) received() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.events...)
+}
+
+// queued returns the types of the events waiting in a client's queue
+func (c *testClient) queued() []string {
+	c.out.mu.Lock()
+	defer c.out.mu.Unlock()
+	types := make([]string, 0, len(c.out.items))
+	for _, item := range c.out.items {
+		types = append(types, item.eventType)
+	}
+	return types
+}
+
+// waitFor polls until cond holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// lastSeq returns the sequence number of the last event received
+func lastSeq(events []Event) uint64 {
+	if len(events) == 0 {
+		return 0
+	}
+	return events[len(events)-1].Seq
+}
+
+func nodeEvent() k8s.WatchEvent {
+	return k8s.WatchEvent{Type: k8s.EventNodeModified, Node: &k8s.Node{Name: "node-a"}}
+}
+
+// checkSequence verifies a client got a snapshot followed by every later broadcast in order
+func checkSequence(t *testing.T, events []Event) {
+	t.Helper()
+	if len(events) == 0 || events[0].Type == "" {
+		t.Fatal("no events received")
+	}
+	if events[0].Type != "snapshot" {
+		t.Fatalf("first event is %s, want snapshot", events[0].Type)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq != events[i-1].Seq+1 {
+			t.Fatalf("event %d has seq %d after %d", i, events[i].Seq, events[i-1].Seq)
+		}
+	}
+}
+
+func TestHubSlowClientDoesNotBlockOthers(t *testing.T) {
+	hub := newTestHub(t, 16, 16, emptySnapshot)
+	fast := []*testClient{connect(t, hub, true), connect(t, hub, true)}
+	slow := connect(t, hub, false)
+
+	const broadcasts = 200
+	for i := 1; i <= broadcasts; i++ {
+		if err := hub.BroadcastEvent("node_modified", nodeEvent()); err != nil {
+			t.Fatal(err)
+		}
+		for _, client := range fast {
+			waitFor(t, "fast client to receive the broadcast", func() bool {
+				return lastSeq(client.received()) == uint64(i)
+			})
+		}
+	}
+
+	for _, client := range fast {
+		events := client.received()
+		checkSequence(t, events)
+		if got := len(events); got != broadcasts+1 {
+			t.Errorf("fast client got %d events, want %d", got, broadcasts+1)
+		}
+		if stats := client.out.stats(); stats.Dropped != 0 || stats.Resyncs != 0 {
+			t.Errorf("fast client stats %+v, want nothing dropped", stats)
+		}
+	}
+
+	// The slow client was resynced with a snapshot instead of blocking the hub
+	waitFor(t, "slow client resync", func() bool {
+		queued := slow.queued()
+		return len(queued) > 0 && queued[0] == "snapshot"
+	})
+	clientStats := slow.out.stats()
+	if clientStats.Resyncs == 0 || clientStats.Dropped == 0 {
+		t.Errorf("slow client stats %+v, want drops and resyncs", clientStats)
+	}
+	if stats := hub.Stats(); stats.Resyncs != clientStats.Resyncs || stats.Dropped != clientStats.Dropped {
+		t.Errorf("hub stats %+v, want the slow client's %+v", stats, clientStats)
+	}
+}
+
+func TestHubSnapshotBuildDoesNotBlockBroadcasts(t *testing.T) {
+	var mu sync.Mutex
+	var release chan struct{}
+	hub := newTestHub(t, 64, 64, func() (interface{}, error) {
+		mu.Lock()
+		wait := release
+		mu.Unlock()
+		if wait != nil {
+			<-wait
+		}
+		return k8s.Snapshot{}, nil
+	})
+	fast := connect(t, hub, true)
+	waitFor(t, "first snapshot", func() bool { return len(fast.received()) == 1 })
+
+	// The next snapshot blocks until released
+	mu.Lock()
+	release = make(chan struct{})
+	mu.Unlock()
+	late := connect(t, hub, true)
+
+	for i := 0; i < 5; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+	}
+	waitFor(t, "broadcasts during the snapshot build", func() bool { return lastSeq(fast.received()) == 5 })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := hub.Ping(ctx); err != nil {
+		t.Fatalf("hub loop stalled by the snapshot build: %v", err)
+	}
+	if got := late.received(); len(got) != 0 {
+		t.Fatalf("client awaiting a snapshot got %d events first", len(got))
+	}
+
+	// Once built, the snapshot is followed by everything broadcast in the meantime
+	close(release)
+	waitFor(t, "late client to catch up", func() bool { return lastSeq(late.received()) == 5 })
+	events := late.received()
+	checkSequence(t, events)
+	if events[0].Seq != 0 || len(events) != 6 {
+		t.Errorf("late client got snapshot at seq %d and %d events, want seq 0 and 6 events", events[0].Seq, len(events))
+	}
+}
+
+func TestHubResumeOverflowStopsReplay(t *testing.T) {
+	// The queue is smaller than what the client missed, so the replay overflows
+	hub := newTestHub(t, 4, 16, emptySnapshot)
+	first := connect(t, hub, true)
+	for i := 0; i < 10; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+	}
+	waitFor(t, "broadcasts", func() bool { return lastSeq(first.received()) == 10 })
+
+	sub, err := newSubscription(nil, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resuming := &testClient{Client: &Client{
+		hub:         hub,
+		out:         newOutbox(hub.clientQueueSize),
+		codec:       jsonCodec,
+		view:        newView(sub),
+		resumeEpoch: hub.epoch,
+		resumeSeq:   1,
+	}}
+	if !hub.registerClient(resuming.Client) {
+		t.Fatal("hub stopped")
+	}
+
+	// Nothing from the abandoned replay may follow the snapshot
+	waitFor(t, "snapshot after the overflow", func() bool {
+		queued := resuming.queued()
+		return len(queued) > 0 && queued[0] == "snapshot"
+	})
+	if queued := resuming.queued(); len(queued) != 1 {
+		t.Errorf("queued %v after the overflow, want only the snapshot", queued)
+	}
+	if stats := resuming.out.stats(); stats.Resyncs != 1 {
+		t.Errorf("resuming client stats %+v, want one resync", stats)
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	hub := newTestHub(t, 16, 16, emptySnapshot)
+	first := connect(t, hub, true)
+	for i := 0; i < 5; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+	}
+	waitFor(t, "broadcasts", func() bool { return lastSeq(first.received()) == 5 })
+
+	sub, err := newSubscription(nil, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resuming := &testClient{Client: &Client{
+		hub:         hub,
+		out:         newOutbox(hub.clientQueueSize),
+		codec:       jsonCodec,
+		view:        newView(sub),
+		resumeEpoch: hub.epoch,
+		resumeSeq:   3,
+	}}
+	if !hub.registerClient(resuming.Client) {
+		t.Fatal("hub stopped")
+	}
+
+	waitFor(t, "replay", func() bool { return len(resuming.queued()) == 3 })
+	if queued := resuming.queued(); queued[0] != "node_modified" || queued[1] != "node_modified" || queued[2] != "resumed" {
+		t.Errorf("queued %v, want two replayed events and resumed", queued)
+	}
+}
+
+func TestHubPendingOverflowResyncsClients(t *testing.T) {
+	hub := newTestHub(t, 64, 64, emptySnapshot)
+	hub.pendingLimit = 8
+	client := connect(t, hub, true)
+	for i := 0; i < 3; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+	}
+	waitFor(t, "broadcasts", func() bool { return lastSeq(client.received()) == 3 })
+
+	// Stall the main loop so broadcasts pile up
+	hub.mu.Lock()
+	for i := 0; i < 20; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+	}
+	hub.pendingMu.Lock()
+	pending, dropped := len(hub.pending), hub.pendingDropped
+	hub.pendingMu.Unlock()
+	hub.mu.Unlock()
+	if pending > hub.pendingLimit || dropped == 0 {
+		t.Fatalf("%d broadcasts pending and %d dropped, want at most %d pending", pending, dropped, hub.pendingLimit)
+	}
+
+	// The client gets a fresh snapshot, then every broadcast after it
+	waitFor(t, "resync", func() bool {
+		events := client.received()
+		for i, event := range events {
+			if i > 0 && event.Type == "snapshot" {
+				return lastSeq(events) == hub.Stats().Broadcasts+1
+			}
+		}
+		return false
+	})
+	events := client.received()
+	for i := range events {
+		if i > 0 && events[i].Type == "snapshot" {
+			events = events[i:]
+			break
+		}
+	}
+	checkSequence(t, events)
+	if events[0].Seq <= 3 {
+		t.Errorf("resync snapshot at seq %d, want past the dropped broadcasts", events[0].Seq)
+	}
+
+	stats := hub.Stats()
+	if stats.Dropped != dropped || stats.Resyncs != 1 {
+		t.Errorf("hub stats %+v, want %d dropped and one resync", stats, dropped)
+	}
+
+	// Resuming from before the drop needs a snapshot too
+	hub.mu.Lock()
+	_, ok := hub.replay.since(3, hub.seq)
+	hub.mu.Unlock()
+	if ok {
+		t.Error("replay spans the dropped broadcasts")
+	}
+}
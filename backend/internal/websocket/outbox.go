@@ -0,0 +1,128 @@
+package websocket
+
+import "sync"
+
+// pushResult describes what happened to a message queued for a client
+type pushResult int
+
+const (
+	pushQueued pushResult = iota
+	// pushCoalesced means the message replaced an older queued message it supersedes
+	pushCoalesced
+	// pushOverflow means the queue was full and has been emptied
+	pushOverflow
+)
+
+// ClientStats counts what happened to the messages sent to one client
+type ClientStats struct {
+	Queued    uint64 `json:"queued"`
+	Coalesced uint64 `json:"coalesced"`
+	Dropped   uint64 `json:"dropped"`
+	Resyncs   uint64 `json:"resyncs"`
+}
+
+// outboxItem is an encoded message waiting to be written
+type outboxItem struct {
+	key       string // coalescing key, empty if the message is never superseded
+	eventType string
+	seq       uint64 // zero for messages outside the broadcast sequence
+	encoded   []byte
+}
+
+// outbox is a client's bounded queue of outbound messages. Writing to a slow
+// browser never blocks the hub: superseded messages are coalesced, and when
+// the queue still overflows it is emptied so the hub can resync the client.
+type outbox struct {
+	mu     sync.Mutex
+	items  []outboxItem
+	limit  int
+	closed bool
+	counts ClientStats
+
+	// Signalled when messages are queued or the outbox is closed
+	ready chan struct{}
+}
+
+func newOutbox(limit int) *outbox {
+	return &outbox{
+		limit: limit,
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push queues a message. A message with a coalescing key replaces any queued
+// message with the same key, keeping sequence order by moving it to the back.
+// On overflow the queue is emptied and the number of discarded messages returned.
+func (o *outbox) push(item outboxItem) (result pushResult, dropped int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return pushQueued, 0
+	}
+
+	result = pushQueued
+	if item.key != "" {
+		for i := range o.items {
+			if o.items[i].key == item.key {
+				o.items = append(o.items[:i], o.items[i+1:]...)
+				o.counts.Coalesced++
+				result = pushCoalesced
+				break
+			}
+		}
+	}
+
+	if len(o.items) >= o.limit {
+		dropped = len(o.items) + 1
+		o.counts.Dropped += uint64(dropped)
+		o.counts.Resyncs++
+		o.items = nil
+		return pushOverflow, dropped
+	}
+
+	o.items = append(o.items, item)
+	o.counts.Queued++
+	o.signal()
+	return result, 0
+}
+
+// take removes and returns every queued message. ok is false once the outbox is closed.
+func (o *outbox) take() (items []outboxItem, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return nil, false
+	}
+
+	items = o.items
+	o.items = nil
+	return items, true
+}
+
+// close discards queued messages and wakes the writer so it can hang up
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	o.items = nil
+	o.signal()
+}
+
+// stats returns the client's delivery counters
+func (o *outbox) stats() ClientStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.counts
+}
+
+// signal wakes the writer without blocking. The caller must hold o.mu.
+func (o *outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import "testing"
+
+func queuedSeqs(o *outbox) []uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	seqs := make([]uint64, 0, len(o.items))
+	for _, item := range o.items {
+		seqs = append(seqs, item.seq)
+	}
+	return seqs
+}
+
+func TestOutboxCoalescesByKey(t *testing.T) {
+	o := newOutbox(10)
+	pushes := []struct {
+		item outboxItem
+		want pushResult
+	}{
+		{outboxItem{seq: 1, key: "metrics_update"}, pushQueued},
+		{outboxItem{seq: 2}, pushQueued},
+		{outboxItem{seq: 3, key: "clusters_update:namespace"}, pushQueued},
+		{outboxItem{seq: 4, key: "metrics_update"}, pushCoalesced},
+		{outboxItem{seq: 5}, pushQueued},
+		{outboxItem{seq: 6, key: "clusters_update:workload"}, pushQueued},
+	}
+	for _, push := range pushes {
+		if result, dropped := o.push(push.item); result != push.want || dropped != 0 {
+			t.Errorf("push(seq %d) = %v, %d; want %v, 0", push.item.seq, result, dropped, push.want)
+		}
+	}
+
+	// The newer metrics moved to the back, keeping the queue in sequence order
+	want := []uint64{2, 3, 4, 5, 6}
+	got := queuedSeqs(o)
+	if len(got) != len(want) {
+		t.Fatalf("queued %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("queued %v, want %v", got, want)
+		}
+	}
+
+	if stats := o.stats(); stats.Queued != 6 || stats.Coalesced != 1 {
+		t.Errorf("stats %+v, want 6 queued and 1 coalesced", stats)
+	}
+}
+
+func TestOutboxOverflowEmptiesQueue(t *testing.T) {
+	o := newOutbox(3)
+	for seq := uint64(1); seq <= 3; seq++ {
+		o.push(outboxItem{seq: seq})
+	}
+
+	result, dropped := o.push(outboxItem{seq: 4})
+	if result != pushOverflow || dropped != 4 {
+		t.Fatalf("push on a full queue = %v, %d; want overflow, 4", result, dropped)
+	}
+	if got := queuedSeqs(o); len(got) != 0 {
+		t.Errorf("queued %v after overflow, want nothing", got)
+	}
+	if stats := o.stats(); stats.Dropped != 4 || stats.Resyncs != 1 || stats.Queued != 3 {
+		t.Errorf("stats %+v, want 3 queued, 4 dropped and 1 resync", stats)
+	}
+
+	// The queue is usable again, e.g. for the resync snapshot
+	if result, _ := o.push(outboxItem{eventType: "snapshot", seq: 4}); result != pushQueued {
+		t.Errorf("push after overflow = %v, want queued", result)
+	}
+}
+
+func TestOutboxCoalescingAvoidsOverflow(t *testing.T) {
+	o := newOutbox(2)
+	o.push(outboxItem{seq: 1})
+	o.push(outboxItem{seq: 2, key: "metrics_update"})
+
+	// Replacing a queued message frees its place before the limit is checked
+	if result, _ := o.push(outboxItem{seq: 3, key: "metrics_update"}); result != pushCoalesced {
+		t.Errorf("push = %v, want coalesced", result)
+	}
+	if got := queuedSeqs(o); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("queued %v, want [1 3]", got)
+	}
+}
+
+func TestOutboxClose(t *testing.T) {
+	o := newOutbox(2)
+	o.push(outboxItem{seq: 1})
+	o.close()
+
+	if _, ok := o.take(); ok {
+		t.Error("take on a closed outbox reported ok")
+	}
+	if result, dropped := o.push(outboxItem{seq: 2}); result != pushQueued || dropped != 0 {
+		t.Errorf("push on a closed outbox = %v, %d; want it ignored", result, dropped)
+	}
+	if stats := o.stats(); stats.Queued != 1 {
+		t.Errorf("stats %+v, want only the first message queued", stats)
+	}
+}
@@ -0,0 +1,57 @@
+package websocket
+
+// replayBuffer keeps the most recent broadcast messages so reconnecting
+// clients can catch up on what they missed
+type replayBuffer struct {
+	messages []message
+	start    int // index of the oldest message
+	count    int
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{messages: make([]message, size)}
+}
+
+// add appends a message, evicting the oldest once the buffer is full
+func (b *replayBuffer) add(msg message) {
+	if len(b.messages) == 0 {
+		return
+	}
+
+	if b.count < len(b.messages) {
+		b.messages[(b.start+b.count)%len(b.messages)] = msg
+		b.count++
+		return
+	}
+
+	b.messages[b.start] = msg
+	b.start = (b.start + 1) % len(b.messages)
+}
+
+// since returns the messages sequenced after seq. It returns false when some
+// of them have already been evicted and the client needs a fresh snapshot.
+func (b *replayBuffer) since(seq, latest uint64) ([]message, bool) {
+	if seq > latest {
+		return nil, false
+	}
+	if seq == latest {
+		return nil, true
+	}
+	if b.count == 0 || b.messages[b.start].seq > seq+1 {
+		return nil, false
+	}
+
+	missed := make([]message, 0, latest-seq)
+	for i := 0; i < b.count; i++ {
+		msg := b.messages[(b.start+i)%len(b.messages)]
+		if msg.seq > seq {
+			missed = append(missed, msg)
+		}
+	}
+	return missed, true
+}
+
+// reset empties the buffer, so resuming from before now needs a snapshot
+func (b *replayBuffer) reset() {
+	b.start, b.count = 0, 0
+}
@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeSSE streams the same events as the websocket as Server-Sent Events,
+// for clients behind proxies that break websocket upgrades. Each event's data
+// is the JSON envelope a websocket client would receive. Filtering uses the
+// same query parameters as the websocket; since SSE clients can't send
+// messages, changing the subscription means reconnecting.
+//
+// Sequenced events carry an id of the form "<epoch>:<seq>". Browsers send the
+// last one back in the Last-Event-ID header when they reconnect, and scripts
+// can pass it as ?lastEventId=, to resume like a websocket client would.
+func ServeSSE(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sub, err := subscriptionFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := &Client{
+		hub:   hub,
+		out:   newOutbox(hub.clientQueueSize),
+		codec: jsonCodec,
+		view:  newView(sub),
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	if epoch, seq, ok := strings.Cut(lastEventID, ":"); ok {
+		if n, err := strconv.ParseUint(seq, 10, 64); err == nil {
+			client.resumeEpoch = epoch
+			client.resumeSeq = n
+		} else {
+			log.Printf("Ignoring invalid Last-Event-ID %q: %v", lastEventID, err)
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask buffering proxies such as nginx to pass events through immediately
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("SSE streaming not supported: %v", err)
+		return
+	}
+
+	if !hub.registerClient(client) {
+		return
+	}
+	defer hub.unregisterClient(client)
+
+	// Comments keep idle connections from being closed by proxies
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-client.out.ready:
+			items, ok := client.out.take()
+			if !ok {
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			for _, item := range items {
+				if err := writeSSE(w, hub.epoch, item); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeSSE writes one event in the text/event-stream format
+func writeSSE(w http.ResponseWriter, epoch string, item outboxItem) error {
+	var b strings.Builder
+	if item.seq > 0 {
+		b.WriteString("id: " + epoch + ":" + strconv.FormatUint(item.seq, 10) + "\n")
+	}
+	b.WriteString("event: " + item.eventType + "\n")
+	b.WriteString("data: ")
+	b.Write(item.encoded)
+	b.WriteString("\n\n")
+
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
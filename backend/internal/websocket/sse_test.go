@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is one event read from a stream
+type sseEvent struct {
+	id, event string
+	data      struct {
+		Type  string          `json:"type"`
+		Seq   uint64          `json:"seq"`
+		Epoch string          `json:"epoch"`
+		Data  json.RawMessage `json:"data"`
+	}
+}
+
+// sseStream is an open connection to the SSE endpoint
+type sseStream struct {
+	resp   *http.Response
+	reader *bufio.Reader
+	cancel context.CancelFunc
+}
+
+func newSSEServer(t *testing.T, hub *Hub) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeSSE(hub, w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openSSE connects to the endpoint, sending lastEventID unless it is empty
+func openSSE(t *testing.T, server *httptest.Server, query, lastEventID string) *sseStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/events"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &sseStream{resp: resp, reader: bufio.NewReader(resp.Body), cancel: cancel}
+	t.Cleanup(stream.close)
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response %d with Content-Type %q, want a 200 event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return stream
+}
+
+func (s *sseStream) close() {
+	s.cancel()
+	s.resp.Body.Close()
+}
+
+// next reads the next event, skipping comments
+func (s *sseStream) next(t *testing.T) sseEvent {
+	t.Helper()
+	done := make(chan struct{})
+	timer := time.AfterFunc(5*time.Second, func() {
+		select {
+		case <-done:
+		default:
+			s.close()
+		}
+	})
+	defer func() {
+		close(done)
+		timer.Stop()
+	}()
+
+	var event sseEvent
+	var data string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.event == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(data), &event.data); err != nil {
+				t.Fatalf("undecodable %s data %q: %v", event.event, data, err)
+			}
+			return event
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestSSEStartsWithSnapshot(t *testing.T) {
+	hub := newTestHub(t, 16, 16, emptySnapshot)
+	for i := 0; i < 2; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+	}
+	waitFor(t, "broadcasts", func() bool { return hub.Stats().Broadcasts == 2 })
+
+	stream := openSSE(t, newSSEServer(t, hub), "", "")
+	if got := stream.resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control %q, want no-cache", got)
+	}
+
+	event := stream.next(t)
+	if event.event != "snapshot" || event.data.Type != "snapshot" {
+		t.Fatalf("first event %s, want snapshot", event.event)
+	}
+	if event.id != hub.epoch+":2" || event.data.Seq != 2 || event.data.Epoch != hub.epoch {
+		t.Errorf("snapshot id %q with seq %d and epoch %q, want %s:2", event.id, event.data.Seq, event.data.Epoch, hub.epoch)
+	}
+}
+
+func TestSSEFramesDeltas(t *testing.T) {
+	hub := newTestHub(t, 16, 16, emptySnapshot)
+	stream := openSSE(t, newSSEServer(t, hub), "", "")
+	if event := stream.next(t); event.event != "snapshot" || event.id != "" {
+		t.Fatalf("first event %s with id %q, want a snapshot at seq 0 without an id", event.event, event.id)
+	}
+
+	for i := 1; i <= 3; i++ {
+		hub.BroadcastEvent("node_modified", nodeEvent())
+		event := stream.next(t)
+		if event.event != "node_modified" || event.data.Type != "node_modified" {
+			t.Fatalf("event %s, want node_modified", event.event)
+		}
+		if want := fmt.Sprintf("%s:%d", hub.epoch, i); event.id != want || event.data.Seq != uint64(i) {
+			t.Errorf("event id %q with seq %d, want %s", event.id, event.data.Seq, want)
+		}
+		var data struct {
+			Node struct{ Name string } `json:"node"`
+		}
+		if err := json.Unmarshal(event.data.Data, &data); err != nil || data.Node.Name != "node-a" {
+			t.Errorf("event data %s, want node-a", event.data.Data)
+		}
+	}
+}
+
+func TestSSEResumesFromLastEventID(t *testing.T) {
+	hub := newTestHub(t, 16, 16, emptySnapshot)
+	server := newSSEServer(t, hub)
+	stream := openSSE(t, server, "", "")
+	stream.next(t)
+	hub.BroadcastEvent("node_modified", nodeEvent())
+	last := stream.next(t)
+	stream.close()
+
+	// Events broadcast while disconnected are replayed on reconnect
+	hub.BroadcastEvent("node_modified", nodeEvent())
+	hub.BroadcastEvent("node_modified", nodeEvent())
+	waitFor(t, "broadcasts", func() bool { return hub.Stats().Broadcasts == 3 })
+
+	for name, resume := range map[string]func() *sseStream{
+		"header": func() *sseStream { return openSSE(t, server, "", last.id) },
+		"query":  func() *sseStream { return openSSE(t, server, "?lastEventId="+last.id, "") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			stream := resume()
+			for _, want := range []string{":2", ":3"} {
+				if event := stream.next(t); event.event != "node_modified" || event.id != hub.epoch+want {
+					t.Errorf("replayed %s with id %q, want node_modified %s%s", event.event, event.id, hub.epoch, want)
+				}
+			}
+			event := stream.next(t)
+			var resumed Resumed
+			if err := json.Unmarshal(event.data.Data, &resumed); err != nil || event.event != "resumed" {
+				t.Fatalf("got %s %s, want resumed", event.event, event.data.Data)
+			}
+			if resumed != (Resumed{FromSeq: 1, ToSeq: 3, Replayed: 2}) {
+				t.Errorf("resumed %+v, want from 1 to 3 with 2 replayed", resumed)
+			}
+		})
+	}
+
+	// An ID from another run of the backend gets a snapshot
+	stream = openSSE(t, server, "", "stale:1")
+	if event := stream.next(t); event.event != "snapshot" || event.id != hub.epoch+":3" {
+		t.Errorf("got %s with id %q for a stale ID, want a snapshot at %s:3", event.event, event.id, hub.epoch)
+	}
+}
+
+func TestSSERejectsBadRequests(t *testing.T) {
+	hub := newTestHub(t, 16, 16, emptySnapshot)
+	server := newSSEServer(t, hub)
+
+	resp, err := http.Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want 405", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "?labelSelector=app%20in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid label selector answered %d, want 400", resp.StatusCode)
+	}
+}
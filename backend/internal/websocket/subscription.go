@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/craigderington/lantern/internal/k8s"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// controlEvents are always delivered, whatever event types a client subscribed to
+var controlEvents = map[string]bool{
+	"snapshot":   true,
+	"resumed":    true,
+	"group_pods": true,
+}
+
+// subscription is the part of the cluster a client wants to hear about.
+// Empty namespace and event lists match everything.
+type subscription struct {
+	namespaces map[string]bool
+	selector   labels.Selector
+	events     map[string]bool
+	metrics    bool
+}
+
+// newSubscription validates and compiles a subscription request
+func newSubscription(namespaces []string, labelSelector string, events []string, metrics *bool) (*subscription, error) {
+	sub := &subscription{
+		namespaces: make(map[string]bool),
+		selector:   labels.Everything(),
+		events:     make(map[string]bool),
+		metrics:    metrics == nil || *metrics,
+	}
+
+	for _, namespace := range namespaces {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			sub.namespaces[namespace] = true
+		}
+	}
+
+	for _, event := range events {
+		if event = strings.TrimSpace(event); event != "" {
+			sub.events[event] = true
+		}
+	}
+
+	if labelSelector != "" {
+		selector, err := labels.Parse(labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+		}
+		sub.selector = selector
+	}
+
+	return sub, nil
+}
+
+// matchEvent reports whether the client subscribed to an event type
+func (s *subscription) matchEvent(eventType string) bool {
+	return len(s.events) == 0 || s.events[eventType] || controlEvents[eventType]
+}
+
+// matchNamespace reports whether the client subscribed to a namespace
+func (s *subscription) matchNamespace(namespace string) bool {
+	return len(s.namespaces) == 0 || s.namespaces[namespace]
+}
+
+// matchPod reports whether a pod is in a subscribed namespace and matches the label selector
+func (s *subscription) matchPod(pod *k8s.Pod) bool {
+	return s.matchNamespace(pod.Namespace) && s.selector.Matches(labels.Set(pod.Labels))
+}
+
+// matchMetrics reports whether the metrics of a pod should be sent
+func (s *subscription) matchMetrics(metrics *k8s.PodMetricsData) bool {
+	return s.matchNamespace(metrics.Namespace) && s.selector.Matches(labels.Set(metrics.Labels))
+}
+
+// filterPods returns the pods matching the subscription
+func (s *subscription) filterPods(pods []k8s.Pod) []k8s.Pod {
+	matched := make([]k8s.Pod, 0, len(pods))
+	for i := range pods {
+		if s.matchPod(&pods[i]) {
+			matched = append(matched, pods[i])
+		}
+	}
+	return matched
+}
+
+// filterMetrics narrows a metrics update to the matching pods
+func (s *subscription) filterMetrics(update k8s.MetricsUpdate) k8s.MetricsUpdate {
+	pods := make([]k8s.PodMetricsData, 0, len(update.Pods))
+	for i := range update.Pods {
+		if s.matchMetrics(&update.Pods[i]) {
+			pods = append(pods, update.Pods[i])
+		}
+	}
+	update.Pods = pods
+	return update
+}
+
+// narrowed reports whether the subscription filters out any pods at all
+func (s *subscription) narrowed() bool {
+	return len(s.namespaces) > 0 || !s.selector.Empty()
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/craigderington/lantern/internal/k8s"
+)
+
+func TestNewSubscription(t *testing.T) {
+	off := false
+	sub, err := newSubscription([]string{" prod ", "", "staging"}, "app=web,tier!=cache", []string{"pods_changed", " "}, &off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.namespaces) != 2 || !sub.namespaces["prod"] || !sub.namespaces["staging"] {
+		t.Errorf("namespaces %v, want prod and staging", sub.namespaces)
+	}
+	if len(sub.events) != 1 || !sub.events["pods_changed"] {
+		t.Errorf("events %v, want pods_changed", sub.events)
+	}
+	if sub.metrics || !sub.narrowed() {
+		t.Errorf("metrics %v, narrowed %v; want no metrics and narrowed", sub.metrics, sub.narrowed())
+	}
+
+	everything, err := newSubscription(nil, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !everything.metrics || everything.narrowed() {
+		t.Errorf("empty subscription: metrics %v, narrowed %v; want metrics and not narrowed", everything.metrics, everything.narrowed())
+	}
+
+	if _, err := newSubscription(nil, "app in (web", nil, nil); err == nil {
+		t.Error("invalid label selector accepted")
+	}
+}
+
+func TestSubscriptionMatch(t *testing.T) {
+	sub, err := newSubscription([]string{"prod"}, "app=web", []string{"pods_changed"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := map[string]bool{
+		"pods_changed":   true,
+		"node_added":     false,
+		"metrics_update": false,
+		// Control events are always delivered
+		"snapshot":   true,
+		"resumed":    true,
+		"group_pods": true,
+	}
+	for eventType, want := range events {
+		if got := sub.matchEvent(eventType); got != want {
+			t.Errorf("matchEvent(%s) = %v, want %v", eventType, got, want)
+		}
+	}
+
+	pods := []struct {
+		pod  k8s.Pod
+		want bool
+	}{
+		{k8s.Pod{Namespace: "prod", Labels: map[string]string{"app": "web"}}, true},
+		{k8s.Pod{Namespace: "prod", Labels: map[string]string{"app": "api"}}, false},
+		{k8s.Pod{Namespace: "prod"}, false},
+		{k8s.Pod{Namespace: "dev", Labels: map[string]string{"app": "web"}}, false},
+	}
+	for _, tt := range pods {
+		if got := sub.matchPod(&tt.pod); got != tt.want {
+			t.Errorf("matchPod(%s %v) = %v, want %v", tt.pod.Namespace, tt.pod.Labels, got, tt.want)
+		}
+	}
+
+	update := sub.filterMetrics(k8s.MetricsUpdate{Pods: []k8s.PodMetricsData{
+		{Name: "web", Namespace: "prod", Labels: map[string]string{"app": "web"}},
+		{Name: "api", Namespace: "prod", Labels: map[string]string{"app": "api"}},
+		{Name: "web", Namespace: "dev", Labels: map[string]string{"app": "web"}},
+	}})
+	if len(update.Pods) != 1 || update.Pods[0].Namespace != "prod" || update.Pods[0].Name != "web" {
+		t.Errorf("filterMetrics kept %+v, want prod/web only", update.Pods)
+	}
+}
@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/craigderington/lantern/internal/k8s"
+)
+
+const (
+	// ViewPods streams every pod event individually (the default)
+	ViewPods = "pods"
+	// ViewGalaxy streams aggregated clusters and only the pods of expanded clusters
+	ViewGalaxy = "galaxy"
+)
+
+// ClientMessage is a message sent by the browser
+type ClientMessage struct {
+	Type    string `json:"type"` // "ping", "set_view", "expand", "collapse" or "subscribe"
+	View    string `json:"view,omitempty"`
+	GroupBy string `json:"groupBy,omitempty"`
+	Group   string `json:"group,omitempty"`
+
+	// Subscription filters, used by "subscribe". Empty lists match everything.
+	Namespaces    []string `json:"namespaces,omitempty"`
+	LabelSelector string   `json:"labelSelector,omitempty"`
+	Events        []string `json:"events,omitempty"`
+	Metrics       *bool    `json:"metrics,omitempty"` // defaults to true
+}
+
+// view is the level of detail a client asked for
+type view struct {
+	mu       sync.RWMutex
+	mode     string
+	groupBy  string
+	expanded map[string]bool
+	sub      *subscription
+}
+
+func newView(sub *subscription) *view {
+	return &view{
+		mode:     ViewPods,
+		groupBy:  k8s.GroupByNamespace,
+		expanded: make(map[string]bool),
+		sub:      sub,
+	}
+}
+
+// subscribe replaces the client's subscription
+func (v *view) subscribe(sub *subscription) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.sub = sub
+}
+
+// set switches between the pods and galaxy views, collapsing all clusters
+func (v *view) set(mode, groupBy string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.mode = mode
+	v.groupBy = groupBy
+	v.expanded = make(map[string]bool)
+}
+
+// expand marks a cluster as expanded (or collapsed) and returns the current grouping
+func (v *view) expand(group string, expanded bool) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if expanded {
+		v.expanded[group] = true
+	} else {
+		delete(v.expanded, group)
+	}
+	return v.groupBy
+}
+
+// scope decides whether a broadcast payload is visible to the client, given
+// its view and subscription. When only part of the payload is visible the
+// narrowed payload is returned, otherwise narrowed is nil and the original
+// payload should be sent.
+func (v *view) scope(eventType string, data interface{}) (narrowed interface{}, ok bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if !v.sub.matchEvent(eventType) {
+		return nil, false
+	}
+
+	galaxy := v.mode == ViewGalaxy
+
+	switch d := data.(type) {
+	case k8s.Snapshot:
+		if !v.sub.narrowed() && (v.sub.metrics || d.Metrics == nil) {
+			return nil, true
+		}
+		d.Pods = v.sub.filterPods(d.Pods)
+		if d.Metrics != nil {
+			if v.sub.metrics {
+				metrics := v.sub.filterMetrics(*d.Metrics)
+				d.Metrics = &metrics
+			} else {
+				d.Metrics = nil
+			}
+		}
+		return d, true
+
+	case k8s.ClustersUpdate:
+		if !galaxy || d.GroupBy != v.groupBy {
+			return nil, false
+		}
+		if len(v.sub.namespaces) == 0 {
+			return nil, true
+		}
+		clusters := make([]k8s.PodCluster, 0, len(d.Clusters))
+		for _, cluster := range d.Clusters {
+			if v.sub.matchNamespace(cluster.Namespace) {
+				clusters = append(clusters, cluster)
+			}
+		}
+		d.Clusters = clusters
+		return d, true
+
+	case k8s.GroupPods:
+		if !v.sub.narrowed() {
+			return nil, true
+		}
+		d.Pods = v.sub.filterPods(d.Pods)
+		return d, true
+
+	case k8s.WatchEvent:
+		if d.Changes != nil {
+			return v.scopeChanges(d)
+		}
+		if d.Pod == nil {
+			return nil, true
+		}
+		return nil, v.visible(d.Pod)
+
+	case k8s.MetricsUpdate:
+		if !v.sub.metrics {
+			return nil, false
+		}
+		if !galaxy && !v.sub.narrowed() {
+			return nil, true
+		}
+		pods := make([]k8s.PodMetricsData, 0)
+		for i := range d.Pods {
+			if !v.sub.matchMetrics(&d.Pods[i]) {
+				continue
+			}
+			if galaxy && !v.expanded[k8s.MetricsGroupKey(&d.Pods[i], v.groupBy)] {
+				continue
+			}
+			pods = append(pods, d.Pods[i])
+		}
+		// Node metrics aren't namespaced, so every client gets them
+		if len(pods) == 0 && len(d.Nodes) == 0 {
+			return nil, false
+		}
+		d.Pods = pods
+		return d, true
+	}
+
+	return nil, true
+}
+
+// visible reports whether a pod matches the subscription and, in galaxy mode,
+// belongs to an expanded cluster. The caller must hold v.mu.
+func (v *view) visible(pod *k8s.Pod) bool {
+	if !v.sub.matchPod(pod) {
+		return false
+	}
+	return v.mode != ViewGalaxy || v.expanded[k8s.GroupKey(pod, v.groupBy)]
+}
+
+// scopeChanges narrows a pods_changed batch to the visible pods. A modified
+// pod that starts or stops matching the client's filters is sent as added or
+// deleted, since the client never had it or must drop it.
+// The caller must hold v.mu.
+func (v *view) scopeChanges(event k8s.WatchEvent) (narrowed interface{}, ok bool) {
+	changes := k8s.PodsChanged{Layout: event.Changes.Layout}
+	whole := true
+	for _, pod := range event.Changes.Added {
+		if v.visible(&pod) {
+			changes.Added = append(changes.Added, pod)
+		} else {
+			whole = false
+		}
+	}
+	for _, change := range event.Changes.Modified {
+		now := v.visible(&change.Pod)
+		before := now
+		if change.Previous != nil {
+			before = v.visible(change.Previous)
+		}
+		switch {
+		case before && now:
+			changes.Modified = append(changes.Modified, change)
+			continue
+		case now:
+			changes.Added = append(changes.Added, change.Pod)
+		case before:
+			changes.Deleted = append(changes.Deleted, change.Pod)
+		}
+		whole = false
+	}
+	for _, pod := range event.Changes.Deleted {
+		if v.visible(&pod) {
+			changes.Deleted = append(changes.Deleted, pod)
+		} else {
+			whole = false
+		}
+	}
+
+	if whole {
+		return nil, true
+	}
+	if len(changes.Added) == 0 && len(changes.Modified) == 0 && len(changes.Deleted) == 0 && changes.Layout == nil {
+		return nil, false
+	}
+	event.Changes = &changes
+	return event, true
+}
@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/craigderington/lantern/internal/k8s"
+)
+
+// newTestView creates a view with the given namespace and label filters
+func newTestView(t *testing.T, namespaces []string, labelSelector string) *view {
+	t.Helper()
+	sub, err := newSubscription(namespaces, labelSelector, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newView(sub)
+}
+
+func labeledPod(id, namespace, app string) k8s.Pod {
+	return k8s.Pod{ID: id, Name: id, Namespace: namespace, Labels: map[string]string{"app": app}}
+}
+
+// scopedChanges scopes a pods_changed event, returning the changes the client gets
+func scopedChanges(t *testing.T, v *view, changes k8s.PodsChanged) (*k8s.PodsChanged, bool) {
+	t.Helper()
+	event := k8s.WatchEvent{Type: k8s.EventPodsChanged, Changes: &changes}
+	narrowed, ok := v.scope(string(k8s.EventPodsChanged), event)
+	if !ok {
+		return nil, false
+	}
+	if narrowed == nil {
+		return &changes, true
+	}
+	return narrowed.(k8s.WatchEvent).Changes, true
+}
+
+func ids(pods []k8s.Pod) []string {
+	var ids []string
+	for _, pod := range pods {
+		ids = append(ids, pod.ID)
+	}
+	return ids
+}
+
+func TestScopeChangesFiltersPods(t *testing.T) {
+	v := newTestView(t, nil, "app=web")
+	web, api := labeledPod("web", "prod", "web"), labeledPod("api", "prod", "api")
+
+	// Everything visible: the batch is sent as is
+	changes := k8s.PodsChanged{Added: []k8s.Pod{web}}
+	event := k8s.WatchEvent{Type: k8s.EventPodsChanged, Changes: &changes}
+	if narrowed, ok := v.scope(string(k8s.EventPodsChanged), event); !ok || narrowed != nil {
+		t.Errorf("fully visible batch narrowed to %v, %v", narrowed, ok)
+	}
+
+	got, ok := scopedChanges(t, v, k8s.PodsChanged{Added: []k8s.Pod{web, api}, Deleted: []k8s.Pod{api}})
+	if !ok || len(got.Added) != 1 || got.Added[0].ID != "web" || len(got.Deleted) != 0 {
+		t.Errorf("got %+v, want only web added", got)
+	}
+
+	// Nothing visible and no layout moves: nothing is sent
+	if got, ok := scopedChanges(t, v, k8s.PodsChanged{Deleted: []k8s.Pod{api}}); ok {
+		t.Errorf("invisible batch sent as %+v", got)
+	}
+
+	// Layout moves are still sent
+	layout := &k8s.LayoutChange{Nodes: map[string]k8s.Position{"node-a": {X: 1}}}
+	if got, ok := scopedChanges(t, v, k8s.PodsChanged{Deleted: []k8s.Pod{api}, Layout: layout}); !ok || got.Layout != layout || len(got.Deleted) != 0 {
+		t.Errorf("got %+v, %v; want only the layout", got, ok)
+	}
+}
+
+func TestScopeChangesPodLeavesFilter(t *testing.T) {
+	v := newTestView(t, nil, "app=web")
+	before, after := labeledPod("uid-1", "prod", "web"), labeledPod("uid-1", "prod", "api")
+
+	got, ok := scopedChanges(t, v, k8s.PodsChanged{
+		Modified: []k8s.PodChange{{Pod: after, Changed: []string{"labels"}, Previous: &before}},
+	})
+	if !ok || len(got.Modified) != 0 || len(got.Added) != 0 {
+		t.Fatalf("got %+v, %v; want the pod deleted", got, ok)
+	}
+	if deleted := ids(got.Deleted); len(deleted) != 1 || deleted[0] != "uid-1" {
+		t.Errorf("deleted %v, want uid-1", deleted)
+	}
+}
+
+func TestScopeChangesPodEntersFilter(t *testing.T) {
+	v := newTestView(t, nil, "app=web")
+	before, after := labeledPod("uid-1", "prod", "api"), labeledPod("uid-1", "prod", "web")
+
+	got, ok := scopedChanges(t, v, k8s.PodsChanged{
+		Modified: []k8s.PodChange{{Pod: after, Changed: []string{"labels"}, Previous: &before}},
+	})
+	if !ok || len(got.Modified) != 0 || len(got.Deleted) != 0 {
+		t.Fatalf("got %+v, %v; want the pod added", got, ok)
+	}
+	if len(got.Added) != 1 || got.Added[0].ID != "uid-1" || got.Added[0].Labels["app"] != "web" {
+		t.Errorf("added %+v, want uid-1 in its new state", got.Added)
+	}
+}
+
+func TestScopeChangesModifiedWithinFilter(t *testing.T) {
+	v := newTestView(t, []string{"prod"}, "")
+	before := labeledPod("uid-1", "prod", "web")
+	after := before
+	after.Status = "Running"
+	hidden := labeledPod("uid-2", "dev", "web")
+
+	got, ok := scopedChanges(t, v, k8s.PodsChanged{Modified: []k8s.PodChange{
+		{Pod: after, Changed: []string{"status"}, Previous: &before},
+		{Pod: hidden, Changed: []string{"status"}, Previous: &hidden},
+	}})
+	if !ok || len(got.Modified) != 1 || got.Modified[0].Pod.ID != "uid-1" || len(got.Added)+len(got.Deleted) != 0 {
+		t.Errorf("got %+v, %v; want uid-1 modified", got, ok)
+	}
+}
+
+func TestScopeChangesGalaxyExpansion(t *testing.T) {
+	v := newTestView(t, nil, "")
+	v.set(ViewGalaxy, k8s.GroupByNamespace)
+	v.expand("prod", true)
+
+	// A pod moving out of an expanded cluster is deleted, and into one added
+	moved, stayed := labeledPod("uid-1", "dev", "web"), labeledPod("uid-1", "prod", "web")
+	got, ok := scopedChanges(t, v, k8s.PodsChanged{
+		Modified: []k8s.PodChange{{Pod: moved, Changed: []string{"namespace"}, Previous: &stayed}},
+	})
+	if !ok || len(got.Deleted) != 1 {
+		t.Errorf("got %+v, %v; want the pod deleted", got, ok)
+	}
+
+	got, ok = scopedChanges(t, v, k8s.PodsChanged{
+		Modified: []k8s.PodChange{{Pod: stayed, Changed: []string{"namespace"}, Previous: &moved}},
+	})
+	if !ok || len(got.Added) != 1 {
+		t.Errorf("got %+v, %v; want the pod added", got, ok)
+	}
+}
+
+func TestScopeSnapshotAndMetrics(t *testing.T) {
+	v := newTestView(t, []string{"prod"}, "")
+	snapshot := k8s.Snapshot{
+		Pods:    []k8s.Pod{labeledPod("web", "prod", "web"), labeledPod("api", "dev", "api")},
+		Metrics: &k8s.MetricsUpdate{Pods: []k8s.PodMetricsData{{Name: "web", Namespace: "prod"}, {Name: "api", Namespace: "dev"}}},
+	}
+	narrowed, ok := v.scope("snapshot", snapshot)
+	got, _ := narrowed.(k8s.Snapshot)
+	if !ok || len(got.Pods) != 1 || got.Pods[0].ID != "web" || len(got.Metrics.Pods) != 1 || got.Metrics.Pods[0].Name != "web" {
+		t.Errorf("snapshot narrowed to %+v, %v; want prod only", narrowed, ok)
+	}
+
+	// Node metrics are sent even when no pod metrics match
+	update := k8s.MetricsUpdate{Pods: []k8s.PodMetricsData{{Name: "api", Namespace: "dev"}}, Nodes: []k8s.NodeMetrics{{Name: "node-a"}}}
+	narrowed, ok = v.scope("metrics_update", update)
+	if metrics, _ := narrowed.(k8s.MetricsUpdate); !ok || len(metrics.Pods) != 0 || len(metrics.Nodes) != 1 {
+		t.Errorf("metrics narrowed to %+v, %v; want only node metrics", narrowed, ok)
+	}
+
+	// Galaxy clients only get clusters for their grouping
+	v.set(ViewGalaxy, k8s.GroupByWorkload)
+	if _, ok := v.scope("clusters_update", k8s.ClustersUpdate{GroupBy: k8s.GroupByNamespace}); ok {
+		t.Error("clusters of another grouping sent")
+	}
+	clusters := k8s.ClustersUpdate{GroupBy: k8s.GroupByWorkload, Clusters: []k8s.PodCluster{{Namespace: "prod"}, {Namespace: "dev"}}}
+	narrowed, ok = v.scope("clusters_update", clusters)
+	if got, _ := narrowed.(k8s.ClustersUpdate); !ok || len(got.Clusters) != 1 || got.Clusters[0].Namespace != "prod" {
+		t.Errorf("clusters narrowed to %+v, %v; want prod only", narrowed, ok)
+	}
+}
@@ -0,0 +1,175 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiPrefix is the versioned REST API path this package targets
+const apiPrefix = "/api/v1"
+
+// Client talks to an observatory backend
+type Client struct {
+	baseURL *url.URL
+
+	// HTTPClient is used for REST requests; replace it to configure TLS or timeouts
+	HTTPClient *http.Client
+}
+
+// APIError is returned when the backend answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("observatory: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// NewClient creates a client for the backend at baseURL, e.g. "http://localhost:8000"
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("observatory: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("observatory: base URL must be http or https, got %q", baseURL)
+	}
+
+	return &Client{
+		baseURL:    u,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Nodes lists all nodes
+func (c *Client) Nodes(ctx context.Context) ([]Node, error) {
+	var nodes []Node
+	return nodes, c.getJSON(ctx, "/nodes", nil, &nodes)
+}
+
+// Pods lists all pods
+func (c *Client) Pods(ctx context.Context) ([]Pod, error) {
+	var pods []Pod
+	return pods, c.getJSON(ctx, "/pods", nil, &pods)
+}
+
+// DescribePod returns the kubectl describe style description of a pod
+func (c *Client) DescribePod(ctx context.Context, namespace, name string) (string, error) {
+	return c.getText(ctx, "/pods/describe", url.Values{"namespace": {namespace}, "name": {name}})
+}
+
+// DescribeNode returns the kubectl describe style description of a node
+func (c *Client) DescribeNode(ctx context.Context, name string) (string, error) {
+	return c.getText(ctx, "/nodes/describe", url.Values{"name": {name}})
+}
+
+// PodLogs returns the last log lines of a pod. An empty container selects the default one.
+func (c *Client) PodLogs(ctx context.Context, namespace, name, container string) (string, error) {
+	query := url.Values{"namespace": {namespace}, "name": {name}}
+	if container != "" {
+		query.Set("container", container)
+	}
+	return c.getText(ctx, "/pods/logs", query)
+}
+
+// PodMetrics returns the current CPU and memory usage of a pod
+func (c *Client) PodMetrics(ctx context.Context, namespace, name string) (*PodMetrics, error) {
+	var metrics PodMetrics
+	if err := c.getJSON(ctx, "/pods/metrics", url.Values{"namespace": {namespace}, "name": {name}}, &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+// NodeMetrics returns the current CPU and memory usage of a node
+func (c *Client) NodeMetrics(ctx context.Context, name string) (*NodeMetrics, error) {
+	var metrics NodeMetrics
+	if err := c.getJSON(ctx, "/nodes/metrics", url.Values{"name": {name}}, &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+// Clusters returns pods aggregated by "namespace" or "workload"
+func (c *Client) Clusters(ctx context.Context, groupBy string) (ClustersUpdate, error) {
+	var clusters ClustersUpdate
+	return clusters, c.getJSON(ctx, "/clusters", url.Values{"groupBy": {groupBy}}, &clusters)
+}
+
+// ClusterPods returns the pods of one cluster
+func (c *Client) ClusterPods(ctx context.Context, groupBy, group string) (GroupPods, error) {
+	var pods GroupPods
+	return pods, c.getJSON(ctx, "/clusters/pods", url.Values{"groupBy": {groupBy}, "group": {group}}, &pods)
+}
+
+// Status returns the backend's connection state to the cluster
+func (c *Client) Status(ctx context.Context) (BackendStatus, error) {
+	var status BackendStatus
+	return status, c.getJSON(ctx, "/status", nil, &status)
+}
+
+// StreamStats returns the backend's event delivery counters
+func (c *Client) StreamStats(ctx context.Context) (HubStats, error) {
+	var stats HubStats
+	return stats, c.getJSON(ctx, "/ws/stats", nil, &stats)
+}
+
+// getJSON fetches an endpoint and decodes its JSON response into v
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	body, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("observatory: failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// getText fetches an endpoint returning plain text
+func (c *Client) getText(ctx context.Context, path string, query url.Values) (string, error) {
+	body, err := c.get(ctx, path, query)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	text, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("observatory: failed to read %s: %w", path, err)
+	}
+	return string(text), nil
+}
+
+// get performs a GET request, turning error statuses into *APIError
+func (c *Client) get(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	u := *c.baseURL
+	u.Path += apiPrefix + path
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("observatory: GET %s: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp.Body, nil
+}
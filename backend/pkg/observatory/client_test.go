@@ -0,0 +1,367 @@
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewClient(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestNewClientRejectsInvalidURLs(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8000", "ftp://localhost", "http://[::1"} {
+		if _, err := NewClient(baseURL); err == nil {
+			t.Errorf("NewClient(%q) succeeded", baseURL)
+		}
+	}
+}
+
+func TestClientREST(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	mux := http.NewServeMux()
+	serve := func(path, contentType, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				t.Errorf("%s %s, want GET", r.Method, r.URL)
+			}
+			mu.Lock()
+			requests = append(requests, r.URL.String())
+			mu.Unlock()
+			w.Header().Set("Content-Type", contentType)
+			fmt.Fprint(w, body)
+		})
+	}
+	serve("/api/v1/nodes", "application/json", `[{"id":"uid-node","name":"node-a","status":"Ready","position":{"x":1,"y":0,"z":2}}]`)
+	serve("/api/v1/pods", "application/json", `[{"id":"uid-web","name":"web","namespace":"default","status":"Running","containers":[{"name":"app","type":"main"}]}]`)
+	serve("/api/v1/pods/describe", "text/plain", "Name:         web\n")
+	serve("/api/v1/nodes/describe", "text/plain", "Name:               node-a\n")
+	serve("/api/v1/pods/logs", "text/plain", "listening on :8080\n")
+	serve("/api/v1/pods/metrics", "application/json", `{"name":"web","namespace":"default","cpuUsage":120,"memoryUsage":64,"timestamp":"2026-01-02T03:04:05Z"}`)
+	serve("/api/v1/nodes/metrics", "application/json", `{"name":"node-a","cpuUsage":800,"memoryUsage":4096,"timestamp":"2026-01-02T03:04:05Z"}`)
+	serve("/api/v1/clusters", "application/json", `{"groupBy":"workload","clusters":[{"key":"default/Deployment/web","count":3}],"timestamp":"2026-01-02T03:04:05Z"}`)
+	serve("/api/v1/clusters/pods", "application/json", `{"groupBy":"namespace","group":"default","pods":[{"id":"uid-web"}]}`)
+	serve("/api/v1/status", "application/json", `{"state":"degraded","apiReachable":true,"watches":[{"resource":"pods","synced":false}],"metrics":{"source":"metrics-server"}}`)
+	serve("/api/v1/ws/stats", "application/json", `{"clients":2,"broadcasts":40,"dropped":3}`)
+
+	client := newTestClient(t, mux)
+	ctx := context.Background()
+
+	nodes, err := client.Nodes(ctx)
+	if err != nil || len(nodes) != 1 || nodes[0].Name != "node-a" || nodes[0].Position.Z != 2 {
+		t.Errorf("Nodes() = %+v, %v", nodes, err)
+	}
+	pods, err := client.Pods(ctx)
+	if err != nil || len(pods) != 1 || pods[0].Containers[0].Type != "main" {
+		t.Errorf("Pods() = %+v, %v", pods, err)
+	}
+	if text, err := client.DescribePod(ctx, "default", "web"); err != nil || text != "Name:         web\n" {
+		t.Errorf("DescribePod() = %q, %v", text, err)
+	}
+	if text, err := client.DescribeNode(ctx, "node-a"); err != nil || !strings.Contains(text, "node-a") {
+		t.Errorf("DescribeNode() = %q, %v", text, err)
+	}
+	if text, err := client.PodLogs(ctx, "default", "web", ""); err != nil || text != "listening on :8080\n" {
+		t.Errorf("PodLogs() = %q, %v", text, err)
+	}
+	if text, err := client.PodLogs(ctx, "default", "web", "app"); err != nil || text == "" {
+		t.Errorf("PodLogs() with a container = %q, %v", text, err)
+	}
+	if metrics, err := client.PodMetrics(ctx, "default", "web"); err != nil || metrics.CPUUsage != 120 {
+		t.Errorf("PodMetrics() = %+v, %v", metrics, err)
+	}
+	if metrics, err := client.NodeMetrics(ctx, "node-a"); err != nil || metrics.MemoryUsage != 4096 {
+		t.Errorf("NodeMetrics() = %+v, %v", metrics, err)
+	}
+	clusters, err := client.Clusters(ctx, "workload")
+	if err != nil || len(clusters.Clusters) != 1 || clusters.Clusters[0].Count != 3 || clusters.Timestamp.IsZero() {
+		t.Errorf("Clusters() = %+v, %v", clusters, err)
+	}
+	if group, err := client.ClusterPods(ctx, "namespace", "default"); err != nil || len(group.Pods) != 1 {
+		t.Errorf("ClusterPods() = %+v, %v", group, err)
+	}
+	if status, err := client.Status(ctx); err != nil || status.State != StateDegraded || len(status.Watches) != 1 {
+		t.Errorf("Status() = %+v, %v", status, err)
+	}
+	if stats, err := client.StreamStats(ctx); err != nil || stats.Clients != 2 || stats.Dropped != 3 {
+		t.Errorf("StreamStats() = %+v, %v", stats, err)
+	}
+
+	want := []string{
+		"/api/v1/nodes",
+		"/api/v1/pods",
+		"/api/v1/pods/describe?name=web&namespace=default",
+		"/api/v1/nodes/describe?name=node-a",
+		"/api/v1/pods/logs?name=web&namespace=default",
+		"/api/v1/pods/logs?container=app&name=web&namespace=default",
+		"/api/v1/pods/metrics?name=web&namespace=default",
+		"/api/v1/nodes/metrics?name=node-a",
+		"/api/v1/clusters?groupBy=workload",
+		"/api/v1/clusters/pods?group=default&groupBy=namespace",
+		"/api/v1/status",
+		"/api/v1/ws/stats",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requested\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestClientErrorStatuses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/pods/metrics", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "No metrics for pod", http.StatusNotFound)
+	})
+	mux.HandleFunc("/api/v1/pods/describe", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "namespace and name query parameters required", http.StatusBadRequest)
+	})
+	mux.HandleFunc("/api/v1/nodes", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Failed to fetch nodes", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/api/v1/pods", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"not":"a list"}`)
+	})
+	client := newTestClient(t, mux)
+	ctx := context.Background()
+
+	checkStatus := func(name string, err error, status int, message string) {
+		t.Helper()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s error %v, want an *APIError", name, err)
+			return
+		}
+		if apiErr.StatusCode != status || apiErr.Message != message {
+			t.Errorf("%s error %d %q, want %d %q", name, apiErr.StatusCode, apiErr.Message, status, message)
+		}
+	}
+
+	metrics, err := client.PodMetrics(ctx, "default", "web")
+	if metrics != nil {
+		t.Errorf("PodMetrics() returned %+v with an error", metrics)
+	}
+	checkStatus("PodMetrics()", err, http.StatusNotFound, "No metrics for pod")
+	_, err = client.DescribePod(ctx, "", "")
+	checkStatus("DescribePod()", err, http.StatusBadRequest, "namespace and name query parameters required")
+	_, err = client.Nodes(ctx)
+	checkStatus("Nodes()", err, http.StatusInternalServerError, "Failed to fetch nodes")
+	_, err = client.Clusters(ctx, "namespace")
+	checkStatus("Clusters()", err, http.StatusNotFound, "404 page not found")
+
+	// A body that doesn't match the type is a decoding error, not an API error
+	var apiErr *APIError
+	if _, err := client.Pods(ctx); err == nil || errors.As(err, &apiErr) {
+		t.Errorf("Pods() with a malformed body returned %v, want a decoding error", err)
+	}
+}
+
+// streamServer is a fake event stream. Each connection is handed to the next
+// of its scripts along with the query it connected with.
+type streamServer struct {
+	t       *testing.T
+	scripts chan func(conn *websocket.Conn, query url.Values)
+
+	mu       sync.Mutex
+	queries  []url.Values
+	protocol []string
+}
+
+func newStreamServer(t *testing.T, scripts ...func(conn *websocket.Conn, query url.Values)) (*Client, *streamServer) {
+	s := &streamServer{t: t, scripts: make(chan func(*websocket.Conn, url.Values), len(scripts))}
+	for _, script := range scripts {
+		s.scripts <- script
+	}
+	upgrader := websocket.Upgrader{Subprotocols: []string{subprotocol}}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ws" {
+			http.NotFound(w, r)
+			return
+		}
+		var script func(*websocket.Conn, url.Values)
+		select {
+		case script = <-s.scripts:
+		default:
+			t.Errorf("unexpected connection %s", r.URL)
+			http.Error(w, "no more connections", http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		s.queries = append(s.queries, r.URL.Query())
+		s.protocol = append(s.protocol, conn.Subprotocol())
+		s.mu.Unlock()
+		script(conn, r.URL.Query())
+	}))
+	return client, s
+}
+
+// send writes events to a connection, several per frame when batched
+func send(t *testing.T, conn *websocket.Conn, batched bool, messages ...Message) {
+	t.Helper()
+	var lines []string
+	for _, msg := range messages {
+		if msg.Version == 0 {
+			msg.Version = ProtocolVersion
+		}
+		encoded, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(encoded))
+	}
+	if !batched {
+		for _, line := range lines {
+			conn.WriteMessage(websocket.TextMessage, []byte(line))
+		}
+		return
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(strings.Join(lines, "\n")))
+}
+
+func nodeMessage(seq uint64) Message {
+	return Message{Type: string(EventNodeModified), Seq: seq, Epoch: "epoch-1", Data: json.RawMessage(`{"type":"node_modified","node":{"name":"node-a"}}`)}
+}
+
+var errDone = errors.New("done")
+
+func TestStreamReconnectsAndResumes(t *testing.T) {
+	client, server := newStreamServer(t,
+		func(conn *websocket.Conn, query url.Values) {
+			send(t, conn, false, Message{Type: EventSnapshot, Epoch: "epoch-1", Data: json.RawMessage(`{"nodes":[],"pods":[]}`)})
+			send(t, conn, true, nodeMessage(1), nodeMessage(2))
+			// Dropped without a close frame
+		},
+		func(conn *websocket.Conn, query url.Values) {
+			send(t, conn, false, nodeMessage(3), Message{Type: EventResumed, Data: json.RawMessage(`{"fromSeq":3,"toSeq":3,"replayed":1}`)})
+			conn.ReadMessage()
+		},
+	)
+
+	var received []string
+	opts := StreamOptions{Namespaces: []string{"default", "web"}, Events: []string{"node_modified"}, MinReconnectDelay: time.Millisecond}
+	err := client.Stream(context.Background(), opts, func(msg Message) error {
+		received = append(received, fmt.Sprintf("%s:%d", msg.Type, msg.Seq))
+		if msg.Type == EventResumed {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Stream() = %v, want the handler's error", err)
+	}
+
+	want := "snapshot:0 node_modified:1 node_modified:2 node_modified:3 resumed:0"
+	if got := strings.Join(received, " "); got != want {
+		t.Errorf("received %s, want %s", got, want)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.queries) != 2 {
+		t.Fatalf("%d connections, want 2", len(server.queries))
+	}
+	for i, query := range server.queries {
+		if query.Get("namespaces") != "default,web" || query.Get("events") != "node_modified" {
+			t.Errorf("connection %d filters %v", i, query)
+		}
+		if server.protocol[i] != subprotocol {
+			t.Errorf("connection %d negotiated %q, want %s", i, server.protocol[i], subprotocol)
+		}
+	}
+	if first := server.queries[0]; first.Has("epoch") || first.Has("lastSeq") {
+		t.Errorf("first connection asked to resume: %v", first)
+	}
+	if resume := server.queries[1]; resume.Get("epoch") != "epoch-1" || resume.Get("lastSeq") != "2" {
+		t.Errorf("reconnect resumed from %v, want epoch-1 seq 2", resume)
+	}
+}
+
+func TestStreamSnapshotResetsPosition(t *testing.T) {
+	client, server := newStreamServer(t,
+		func(conn *websocket.Conn, query url.Values) {
+			send(t, conn, false, nodeMessage(7))
+		},
+		// A restarted backend can't resume and starts over with a snapshot
+		func(conn *websocket.Conn, query url.Values) {
+			send(t, conn, false, Message{Type: EventSnapshot, Epoch: "epoch-2", Data: json.RawMessage(`{}`)})
+		},
+		func(conn *websocket.Conn, query url.Values) {
+			send(t, conn, false, Message{Type: EventBackendStatus, Data: json.RawMessage(`{"state":"connected"}`)})
+			conn.ReadMessage()
+		},
+	)
+
+	err := client.Stream(context.Background(), StreamOptions{MinReconnectDelay: time.Millisecond}, func(msg Message) error {
+		if msg.Type == EventBackendStatus {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Stream() = %v, want the handler's error", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if resume := server.queries[2]; resume.Get("epoch") != "epoch-2" || resume.Get("lastSeq") != "0" {
+		t.Errorf("resumed from %v after the snapshot, want epoch-2 seq 0", resume)
+	}
+}
+
+func TestStreamStopsOnProtocolVersionMismatch(t *testing.T) {
+	client, _ := newStreamServer(t, func(conn *websocket.Conn, query url.Values) {
+		send(t, conn, false, Message{Version: ProtocolVersion + 1, Type: EventSnapshot, Data: json.RawMessage(`{}`)})
+		conn.ReadMessage()
+	})
+
+	err := client.Stream(context.Background(), StreamOptions{MinReconnectDelay: time.Millisecond}, func(msg Message) error {
+		t.Errorf("handler called with %s", msg.Type)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported protocol version") {
+		t.Errorf("Stream() = %v, want a protocol version error", err)
+	}
+}
+
+func TestStreamReturnsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client, _ := newStreamServer(t, func(conn *websocket.Conn, query url.Values) {
+		send(t, conn, false, Message{Type: EventSnapshot, Data: json.RawMessage(`{}`)})
+		conn.ReadMessage()
+	})
+
+	err := client.Stream(ctx, StreamOptions{}, func(msg Message) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream() = %v, want context.Canceled", err)
+	}
+}
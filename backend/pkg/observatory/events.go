@@ -0,0 +1,233 @@
+package observatory
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// EventType is the type of a watch event
+type EventType string
+
+// Event types
+const (
+	EventPodsChanged   EventType = "pods_changed"
+	EventPodAdded      EventType = "pod_added"
+	EventPodModified   EventType = "pod_modified"
+	EventPodDeleted    EventType = "pod_deleted"
+	EventNodeAdded     EventType = "node_added"
+	EventNodeModified  EventType = "node_modified"
+	EventNodeDeleted   EventType = "node_deleted"
+	EventLayoutChanged EventType = "layout_changed"
+
+	EventSnapshot      = "snapshot"
+	EventResumed       = "resumed"
+	EventMetricsUpdate = "metrics_update"
+	EventClusters      = "clusters_update"
+	EventGroupPods     = "group_pods"
+	EventBackendStatus = "backend_status"
+)
+
+// watchEventTypes are the events whose data is a WatchEvent
+var watchEventTypes = []string{
+	string(EventPodsChanged),
+	string(EventPodAdded),
+	string(EventPodModified),
+	string(EventPodDeleted),
+	string(EventNodeAdded),
+	string(EventNodeModified),
+	string(EventNodeDeleted),
+	string(EventLayoutChanged),
+}
+
+// WatchEvent is the data of pod, node and layout events
+type WatchEvent struct {
+	Type EventType `json:"type"`
+	Pod  *Pod      `json:"pod,omitempty"`
+	Node *Node     `json:"node,omitempty"`
+
+	// Layout lists positions of other nodes and pods that moved as a side effect
+	Layout *LayoutChange `json:"layout,omitempty"`
+
+	// Changes is the batch carried by a pods_changed event
+	Changes *PodsChanged `json:"changes,omitempty"`
+
+	// ResourceVersion of the pod or node. Events at or below the snapshot's
+	// ResourceVersions for their kind are already reflected in it.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// PodsChanged is every pod change seen during one batching window
+type PodsChanged struct {
+	Added    []Pod         `json:"added,omitempty"`
+	Modified []PodChange   `json:"modified,omitempty"`
+	Deleted  []Pod         `json:"deleted,omitempty"`
+	Layout   *LayoutChange `json:"layout,omitempty"`
+}
+
+// PodChange is a modified pod along with the fields that changed
+type PodChange struct {
+	Pod     Pod      `json:"pod"`
+	Changed []string `json:"changed"` // JSON field names, e.g. ["status", "ready"]
+}
+
+// LayoutChange lists new positions of nodes and pods, by node name and pod ID
+type LayoutChange struct {
+	Nodes map[string]Position `json:"nodes,omitempty"`
+	Pods  map[string]Position `json:"pods,omitempty"`
+}
+
+// MetricsUpdate is the usage of every pod and node from one metrics fetch
+type MetricsUpdate struct {
+	Type      string           `json:"type"`
+	Pods      []PodMetricsData `json:"pods"`
+	Nodes     []NodeMetrics    `json:"nodes,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// PodMetricsData is one pod's usage in a metrics update
+type PodMetricsData struct {
+	PodID            string                 `json:"podId"`
+	Name             string                 `json:"name"`
+	Namespace        string                 `json:"namespace"`
+	Workload         string                 `json:"workload,omitempty"` // e.g. "Deployment/web"
+	TotalCPU         float64                `json:"totalCpu"`
+	TotalMemory      float64                `json:"totalMemory"`
+	ContainerMetrics []ContainerMetricsData `json:"containers"`
+	Restarts         *int32                 `json:"restarts,omitempty"` // only from sources that report it, e.g. Prometheus
+	Network          *NetworkRates          `json:"network,omitempty"`
+	Filesystem       *FilesystemUsage       `json:"filesystem,omitempty"` // ephemeral storage
+	Volumes          []VolumeUsage          `json:"volumes,omitempty"`
+	Timestamp        time.Time              `json:"timestamp"`
+}
+
+// ContainerMetricsData is one container's usage
+type ContainerMetricsData struct {
+	Name   string  `json:"name"`
+	CPU    float64 `json:"cpu"`    // millicores
+	Memory float64 `json:"memory"` // MB
+}
+
+// Snapshot is the full cluster state sent when a client connects or falls too far behind
+type Snapshot struct {
+	ResourceVersions ResourceVersions `json:"resourceVersions"`
+	Nodes            []Node           `json:"nodes"`
+	Pods             []Pod            `json:"pods"`
+	Metrics          *MetricsUpdate   `json:"metrics,omitempty"`
+	Status           *BackendStatus   `json:"status,omitempty"`
+}
+
+// ResourceVersions is the newest resourceVersion of each kind of object in a snapshot
+type ResourceVersions struct {
+	Pods  string `json:"pods"`
+	Nodes string `json:"nodes"`
+}
+
+// Resumed follows the messages replayed after a reconnect
+type Resumed struct {
+	FromSeq  uint64 `json:"fromSeq"`
+	ToSeq    uint64 `json:"toSeq"`
+	Replayed int    `json:"replayed"`
+}
+
+// RawEvent is an event this package has no type for, e.g. one added by a
+// newer backend, with its data left encoded
+type RawEvent struct {
+	Type string
+	Data json.RawMessage
+}
+
+// Message is one event received from the stream, with its data left encoded
+// until it is decoded with Decode or one of the typed accessors
+type Message struct {
+	Version int             `json:"version"`
+	Type    string          `json:"type"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Epoch   string          `json:"epoch,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Decode returns the message's data as the type matching its event type, e.g.
+// WatchEvent for node_added or Snapshot for snapshot. Events of other types
+// come back as a RawEvent.
+func (m Message) Decode() (interface{}, error) {
+	switch {
+	case slices.Contains(watchEventTypes, m.Type):
+		return decodeAs[WatchEvent](m)
+	case m.Type == EventSnapshot:
+		return decodeAs[Snapshot](m)
+	case m.Type == EventResumed:
+		return decodeAs[Resumed](m)
+	case m.Type == EventMetricsUpdate:
+		return decodeAs[MetricsUpdate](m)
+	case m.Type == EventClusters:
+		return decodeAs[ClustersUpdate](m)
+	case m.Type == EventGroupPods:
+		return decodeAs[GroupPods](m)
+	case m.Type == EventBackendStatus:
+		return decodeAs[BackendStatus](m)
+	}
+	return RawEvent{Type: m.Type, Data: m.Data}, nil
+}
+
+// decodeAs unmarshals a message's data into a T
+func decodeAs[T any](m Message) (interface{}, error) {
+	var v T
+	if err := json.Unmarshal(m.Data, &v); err != nil {
+		return nil, fmt.Errorf("observatory: malformed %s event: %w", m.Type, err)
+	}
+	return v, nil
+}
+
+// WatchEvent decodes a pods_changed, pod, node or layout_changed event
+func (m Message) WatchEvent() (WatchEvent, error) {
+	var event WatchEvent
+	return event, m.decode(&event, watchEventTypes...)
+}
+
+// MetricsUpdate decodes a metrics_update event
+func (m Message) MetricsUpdate() (MetricsUpdate, error) {
+	var update MetricsUpdate
+	return update, m.decode(&update, EventMetricsUpdate)
+}
+
+// Snapshot decodes a snapshot event
+func (m Message) Snapshot() (Snapshot, error) {
+	var snapshot Snapshot
+	return snapshot, m.decode(&snapshot, EventSnapshot)
+}
+
+// Resumed decodes a resumed event
+func (m Message) Resumed() (Resumed, error) {
+	var resumed Resumed
+	return resumed, m.decode(&resumed, EventResumed)
+}
+
+// Clusters decodes a clusters_update event
+func (m Message) Clusters() (ClustersUpdate, error) {
+	var clusters ClustersUpdate
+	return clusters, m.decode(&clusters, EventClusters)
+}
+
+// GroupPods decodes a group_pods event
+func (m Message) GroupPods() (GroupPods, error) {
+	var pods GroupPods
+	return pods, m.decode(&pods, EventGroupPods)
+}
+
+// BackendStatus decodes a backend_status event
+func (m Message) BackendStatus() (BackendStatus, error) {
+	var status BackendStatus
+	return status, m.decode(&status, EventBackendStatus)
+}
+
+// decode unmarshals the data after checking the message is one of the expected types
+func (m Message) decode(v interface{}, types ...string) error {
+	for _, t := range types {
+		if m.Type == t {
+			return json.Unmarshal(m.Data, v)
+		}
+	}
+	return fmt.Errorf("observatory: cannot decode %s event as %T", m.Type, v)
+}
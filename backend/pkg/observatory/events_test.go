@@ -0,0 +1,81 @@
+package observatory
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageDecode(t *testing.T) {
+	tests := []struct {
+		msg   Message
+		check func(v interface{}) bool
+	}{
+		{
+			Message{Type: string(EventLayoutChanged), Data: json.RawMessage(`{"type":"layout_changed","layout":{"nodes":{"node-a":{"x":1,"y":0,"z":0}}}}`)},
+			func(v interface{}) bool {
+				event, ok := v.(WatchEvent)
+				return ok && event.Layout.Nodes["node-a"].X == 1
+			},
+		},
+		{
+			Message{Type: string(EventPodsChanged), Data: json.RawMessage(`{"type":"pods_changed","changes":{"deleted":[{"id":"uid-web"}]}}`)},
+			func(v interface{}) bool {
+				event, ok := v.(WatchEvent)
+				return ok && event.Changes.Deleted[0].ID == "uid-web"
+			},
+		},
+		{
+			Message{Type: EventBackendStatus, Data: json.RawMessage(`{"state":"reconnecting","apiReachable":false}`)},
+			func(v interface{}) bool {
+				status, ok := v.(BackendStatus)
+				return ok && status.State == StateReconnecting
+			},
+		},
+		{
+			Message{Type: EventSnapshot, Data: json.RawMessage(`{"resourceVersions":{"pods":"12","nodes":"9"}}`)},
+			func(v interface{}) bool {
+				snapshot, ok := v.(Snapshot)
+				return ok && snapshot.ResourceVersions.Pods == "12"
+			},
+		},
+		{
+			Message{Type: "cluster_renamed", Data: json.RawMessage(`{"name":"prod"}`)},
+			func(v interface{}) bool {
+				raw, ok := v.(RawEvent)
+				return ok && raw.Type == "cluster_renamed" && string(raw.Data) == `{"name":"prod"}`
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		v, err := tt.msg.Decode()
+		if err != nil {
+			t.Errorf("Decode(%s) failed: %v", tt.msg.Type, err)
+			continue
+		}
+		if !tt.check(v) {
+			t.Errorf("Decode(%s) = %#v", tt.msg.Type, v)
+		}
+	}
+
+	if _, err := (Message{Type: EventSnapshot, Data: json.RawMessage(`[]`)}).Decode(); err == nil {
+		t.Error("Decode of a malformed snapshot succeeded")
+	}
+}
+
+func TestMessageTypedAccessors(t *testing.T) {
+	layout := Message{Type: string(EventLayoutChanged), Data: json.RawMessage(`{"type":"layout_changed"}`)}
+	if event, err := layout.WatchEvent(); err != nil || event.Type != EventLayoutChanged {
+		t.Errorf("WatchEvent() on layout_changed = %+v, %v", event, err)
+	}
+
+	status := Message{Type: EventBackendStatus, Data: json.RawMessage(`{"state":"connected"}`)}
+	if got, err := status.BackendStatus(); err != nil || got.State != StateConnected {
+		t.Errorf("BackendStatus() = %+v, %v", got, err)
+	}
+
+	// Asking for the wrong type is an error
+	if _, err := status.Snapshot(); err == nil {
+		t.Error("Snapshot() on backend_status succeeded")
+	}
+}
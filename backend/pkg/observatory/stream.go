@@ -0,0 +1,186 @@
+package observatory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// StreamOptions narrows the events received, like a WebSocket subscribe message.
+// Empty fields match everything.
+type StreamOptions struct {
+	Namespaces    []string
+	LabelSelector string
+	Events        []string
+	// Metrics turns off metrics_update events when set to false
+	Metrics *bool
+
+	// Bounds of the exponential backoff between reconnects (default 1s and 30s)
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+
+	// Dialer used to connect (default websocket.DefaultDialer)
+	Dialer *websocket.Dialer
+}
+
+// fatalError stops Stream instead of reconnecting
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string { return e.err.Error() }
+func (e *fatalError) Unwrap() error { return e.err }
+
+// Stream connects to the live event stream and calls handle for every message
+// until ctx is done or handle returns an error, which Stream then returns.
+//
+// Dropped connections are re-established with exponential backoff. Reconnects
+// resume from the last message received: the backend replays what was missed
+// (followed by a resumed message) or, if it can't, sends a fresh snapshot.
+// Handlers should therefore treat a snapshot as replacing all state.
+func (c *Client) Stream(ctx context.Context, opts StreamOptions, handle func(Message) error) error {
+	minDelay, maxDelay := opts.MinReconnectDelay, opts.MaxReconnectDelay
+	if minDelay <= 0 {
+		minDelay = time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+
+	var position streamPosition
+	delay := minDelay
+	for {
+		connected, err := c.streamOnce(ctx, opts, &position, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var fatal *fatalError
+		if errors.As(err, &fatal) {
+			return fatal.err
+		}
+
+		if connected {
+			delay = minDelay
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// streamPosition is the point in the stream to resume from
+type streamPosition struct {
+	epoch string
+	seq   uint64
+}
+
+// advance records the position of a received message
+func (p *streamPosition) advance(msg Message) {
+	if msg.Epoch != "" {
+		p.epoch = msg.Epoch
+	}
+	// A snapshot may come from a restarted backend whose sequence started over
+	if msg.Type == EventSnapshot || msg.Seq > p.seq {
+		p.seq = msg.Seq
+	}
+}
+
+// streamOnce runs one connection until it fails. connected reports whether it got established.
+func (c *Client) streamOnce(ctx context.Context, opts StreamOptions, position *streamPosition, handle func(Message) error) (connected bool, err error) {
+	dialer := websocket.DefaultDialer
+	if opts.Dialer != nil {
+		dialer = opts.Dialer
+	}
+	withProtocol := *dialer
+	withProtocol.Subprotocols = []string{subprotocol}
+
+	conn, _, err := withProtocol.DialContext(ctx, c.streamURL(opts, *position), nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Unblock ReadMessage when the caller gives up
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+
+		// Messages queued together arrive in one frame, separated by newlines
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				return true, fmt.Errorf("observatory: malformed message: %w", err)
+			}
+			if msg.Version != ProtocolVersion {
+				return true, &fatalError{fmt.Errorf("observatory: unsupported protocol version %d, expected %d", msg.Version, ProtocolVersion)}
+			}
+
+			position.advance(msg)
+			if err := handle(msg); err != nil {
+				return true, &fatalError{err}
+			}
+		}
+	}
+}
+
+// streamURL builds the websocket URL, including the filters and resume position
+func (c *Client) streamURL(opts StreamOptions, position streamPosition) string {
+	u := *c.baseURL
+	u.Scheme = "ws"
+	if c.baseURL.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	u.Path += "/ws"
+
+	query := url.Values{}
+	if len(opts.Namespaces) > 0 {
+		query.Set("namespaces", strings.Join(opts.Namespaces, ","))
+	}
+	if opts.LabelSelector != "" {
+		query.Set("labelSelector", opts.LabelSelector)
+	}
+	if len(opts.Events) > 0 {
+		query.Set("events", strings.Join(opts.Events, ","))
+	}
+	if opts.Metrics != nil {
+		query.Set("metrics", strconv.FormatBool(*opts.Metrics))
+	}
+	if position.epoch != "" {
+		query.Set("epoch", position.epoch)
+		query.Set("lastSeq", strconv.FormatUint(position.seq, 10))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
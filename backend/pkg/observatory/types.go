@@ -0,0 +1,233 @@
+// Package observatory is a Go client for the observatory backend: typed
+// access to the REST API and a resuming client for the live event stream.
+package observatory
+
+import "time"
+
+// ProtocolVersion is the event protocol version this package understands
+const ProtocolVersion = 1
+
+// subprotocol selects the JSON encoding when connecting to the stream
+const subprotocol = "observatory.v1.json"
+
+// Node is a cluster node as served by the backend
+type Node struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Status   string            `json:"status"`
+	CPU      ResourceUsage     `json:"cpu"`
+	Memory   ResourceUsage     `json:"memory"`
+	Pods     []string          `json:"pods"`
+	Labels   map[string]string `json:"labels"`
+	Position Position          `json:"position"`
+}
+
+// Pod is a pod as served by the backend
+type Pod struct {
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	Status            string            `json:"status"` // kubectl-style status, e.g. "CrashLoopBackOff"
+	Phase             string            `json:"phase"`
+	Reason            string            `json:"reason,omitempty"`
+	Message           string            `json:"message,omitempty"`
+	Ready             bool              `json:"ready"`
+	ReadyContainers   int               `json:"readyContainers"`
+	TotalContainers   int               `json:"totalContainers"`
+	Restarts          int32             `json:"restarts"`
+	Terminating       bool              `json:"terminating"`
+	NodeName          string            `json:"nodeName"`
+	Labels            map[string]string `json:"labels"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	Owner             *OwnerReference   `json:"owner,omitempty"` // controlling owner, if any
+	OwnerReferences   []OwnerReference  `json:"ownerReferences,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	PodIPs            []string          `json:"podIPs,omitempty"`
+	HostIP            string            `json:"hostIP,omitempty"`
+	QOSClass          string            `json:"qosClass,omitempty"` // "Guaranteed", "Burstable" or "BestEffort"
+	Priority          *int32            `json:"priority,omitempty"`
+	PriorityClassName string            `json:"priorityClassName,omitempty"`
+	Containers        []Container       `json:"containers"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	Position          Position          `json:"position"`
+	CPU               float64           `json:"cpu"`    // total CPU usage in millicores
+	Memory            float64           `json:"memory"` // total memory usage in MB
+}
+
+// Container is a container within a pod
+type Container struct {
+	Name      string          `json:"name"`
+	Image     string          `json:"image"`
+	Status    string          `json:"status"` // "Running", "Waiting", "Terminated" or "Unknown"
+	Reason    string          `json:"reason,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	ExitCode  *int32          `json:"exitCode,omitempty"`
+	Ready     bool            `json:"ready"`
+	Restarts  int32           `json:"restarts"`
+	LastState *ContainerState `json:"lastState,omitempty"`
+	Type      string          `json:"type"` // "main", "sidecar", "init", or "ephemeral"
+	// TypeRule explains the classification, e.g. "rule:istio-proxy" or "annotation:observatory.io/sidecars"
+	TypeRule string `json:"typeRule,omitempty"`
+	// NativeSidecar marks init containers declared with restartPolicy: Always
+	NativeSidecar bool       `json:"nativeSidecar,omitempty"`
+	Requests      *Resources `json:"requests,omitempty"`
+	Limits        *Resources `json:"limits,omitempty"`
+	CPU           float64    `json:"cpu"`    // millicores
+	Memory        float64    `json:"memory"` // MB
+}
+
+// OwnerReference identifies the object that owns a pod
+type OwnerReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Controller bool   `json:"controller"`
+}
+
+// Resources holds container resource requests or limits
+type Resources struct {
+	CPU    float64 `json:"cpu,omitempty"`    // millicores
+	Memory float64 `json:"memory,omitempty"` // MB
+}
+
+// ContainerState describes a single container state, current or previous
+type ContainerState struct {
+	State      string    `json:"state"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	ExitCode   *int32    `json:"exitCode,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// ResourceUsage is the used and total amount of a node resource
+type ResourceUsage struct {
+	Used  float64 `json:"used"`
+	Total float64 `json:"total"`
+}
+
+// Position is a node or pod's place in the 3D view
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// PodMetrics is a pod's usage from the latest metrics fetch
+type PodMetrics struct {
+	Name        string           `json:"name"`
+	Namespace   string           `json:"namespace"`
+	CPUUsage    float64          `json:"cpuUsage"`    // in millicores
+	MemoryUsage float64          `json:"memoryUsage"` // in MB
+	Network     *NetworkRates    `json:"network,omitempty"`
+	Filesystem  *FilesystemUsage `json:"filesystem,omitempty"` // ephemeral storage
+	Volumes     []VolumeUsage    `json:"volumes,omitempty"`
+	Timestamp   string           `json:"timestamp"`
+}
+
+// NodeMetrics is a node's usage from the latest metrics fetch
+type NodeMetrics struct {
+	Name        string           `json:"name"`
+	CPUUsage    float64          `json:"cpuUsage"`    // in millicores
+	MemoryUsage float64          `json:"memoryUsage"` // in MB
+	Network     *NetworkRates    `json:"network,omitempty"`
+	Filesystem  *FilesystemUsage `json:"filesystem,omitempty"` // root filesystem
+	Timestamp   string           `json:"timestamp"`
+}
+
+// NetworkRates are bytes per second received and sent between two fetches
+type NetworkRates struct {
+	RxBytesPerSecond float64 `json:"rxBytesPerSecond"`
+	TxBytesPerSecond float64 `json:"txBytesPerSecond"`
+}
+
+// FilesystemUsage is the space used on a pod's ephemeral storage or a node's root filesystem
+type FilesystemUsage struct {
+	UsedBytes     uint64 `json:"usedBytes"`
+	CapacityBytes uint64 `json:"capacityBytes,omitempty"` // 0 when unknown
+}
+
+// VolumeUsage is the space used on one of a pod's volumes
+type VolumeUsage struct {
+	Name          string `json:"name"`
+	UsedBytes     uint64 `json:"usedBytes"`
+	CapacityBytes uint64 `json:"capacityBytes,omitempty"`
+}
+
+// PodCluster is an aggregated group of pods shown as a single object in galaxy mode
+type PodCluster struct {
+	Key       string         `json:"key"`
+	Namespace string         `json:"namespace"`
+	Workload  string         `json:"workload,omitempty"` // e.g. "Deployment/web"
+	Count     int            `json:"count"`
+	Statuses  map[string]int `json:"statuses"` // pod count per status
+	Nodes     map[string]int `json:"nodes"`    // pod count per node
+	Restarts  int32          `json:"restarts"`
+	CPU       float64        `json:"cpu"`    // summed millicores
+	Memory    float64        `json:"memory"` // summed MB
+	Position  Position       `json:"position"`
+}
+
+// ClustersUpdate is the aggregated view of all pods for one grouping
+type ClustersUpdate struct {
+	GroupBy   string       `json:"groupBy"`
+	Clusters  []PodCluster `json:"clusters"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// GroupPods lists the individual pods of one cluster
+type GroupPods struct {
+	GroupBy string `json:"groupBy"`
+	Group   string `json:"group"`
+	Pods    []Pod  `json:"pods"`
+}
+
+// Backend states reported in BackendStatus, from best to worst
+const (
+	StateConnected          = "connected"
+	StateMetricsUnavailable = "metrics_unavailable"
+	StateDegraded           = "degraded"
+	StateReconnecting       = "reconnecting"
+)
+
+// BackendStatus describes the backend's view of the cluster
+type BackendStatus struct {
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+	// Since is when the backend entered State
+	Since        time.Time     `json:"since"`
+	CheckedAt    time.Time     `json:"checkedAt"`
+	APIReachable bool          `json:"apiReachable"`
+	APIError     string        `json:"apiError,omitempty"`
+	Watches      []WatchStatus `json:"watches"`
+	Metrics      MetricsStatus `json:"metrics"`
+}
+
+// WatchStatus is the health of one of the backend's watches
+type WatchStatus struct {
+	Resource    string    `json:"resource"`
+	Synced      bool      `json:"synced"`
+	Started     time.Time `json:"started"`
+	LastEvent   time.Time `json:"lastEvent,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitzero"`
+	// FailingSince is the first of the errors since the watch last worked
+	FailingSince time.Time `json:"failingSince,omitzero"`
+}
+
+// MetricsStatus reports how recently metrics were fetched
+type MetricsStatus struct {
+	Source      string    `json:"source"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitzero"`
+}
+
+// HubStats are the backend's event delivery counters
+type HubStats struct {
+	Clients    int    `json:"clients"`
+	Broadcasts uint64 `json:"broadcasts"`
+	Coalesced  uint64 `json:"coalesced"` // superseded before being sent
+	Dropped    uint64 `json:"dropped"`   // discarded when a client fell too far behind
+	Resyncs    uint64 `json:"resyncs"`   // snapshots sent to clients that fell too far behind
+}
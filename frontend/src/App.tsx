@@ -2,13 +2,45 @@ import { useState, useEffect, useCallback, useMemo, useRef } from 'react';
 import Scene from './components/Scene';
 import ToastContainer, { Toast } from './components/ToastContainer';
 import DetailPanel from './components/DetailPanel';
-import { fetchNodes, fetchPods } from './services/api';
+import { fetchNodes, fetchPods, WS_URL } from './services/api';
 import { useWebSocket } from './hooks/useWebSocket';
-import { Node, Pod } from './types';
+import { BackendStatus, MetricsUpdate, Node, Pod, PodsChanged, Snapshot } from './types';
 import { FontAwesomeIcon } from '@fortawesome/react-fontawesome';
 import { faCircle, faServer, faCube, faCircleDot, faLayerGroup } from '@fortawesome/free-solid-svg-icons';
 import './App.css';
 
+// Header indicator for each backend state while the WebSocket is connected
+const backendStateLabels: Record<BackendStatus['state'], { label: string; className: string }> = {
+  connected: { label: 'Live', className: 'status-connected' },
+  metrics_unavailable: { label: 'Live (no metrics)', className: 'status-warning' },
+  degraded: { label: 'Degraded', className: 'status-warning' },
+  reconnecting: { label: 'Cluster unreachable', className: 'status-disconnected' },
+};
+
+// Apply a metrics update to the matching pods and their containers
+function applyMetrics(pods: Pod[], update: MetricsUpdate): Pod[] {
+  return pods.map((pod) => {
+    // Find matching metrics for this pod
+    const metrics = update.pods.find((m) => m.podId === pod.id);
+    if (!metrics) return pod;
+
+    // Update pod and container metrics
+    return {
+      ...pod,
+      cpu: metrics.totalCpu,
+      memory: metrics.totalMemory,
+      containers: pod.containers.map((container) => {
+        const containerMetrics = metrics.containers.find(
+          (cm) => cm.name === container.name
+        );
+        return containerMetrics
+          ? { ...container, cpu: containerMetrics.cpu, memory: containerMetrics.memory }
+          : container;
+      }),
+    };
+  });
+}
+
 export default function App() {
   const [nodes, setNodes] = useState<Node[]>([]);
   const [pods, setPods] = useState<Pod[]>([]);
@@ -19,9 +51,7 @@ export default function App() {
   const [hasConnectedOnce, setHasConnectedOnce] = useState(false);
   const [selectedResource, setSelectedResource] = useState<Pod | Node | null>(null);
   const [selectedResourceType, setSelectedResourceType] = useState<'pod' | 'node' | null>(null);
-
-  // Track raw pods before redistribution
-  const [rawPods, setRawPods] = useState<Pod[]>([]);
+  const [backendStatus, setBackendStatus] = useState<BackendStatus | null>(null);
 
   // Add toast notification
   const addToast = useCallback((message: string, type: Toast['type'] = 'info') => {
@@ -57,71 +87,50 @@ export default function App() {
     setSelectedResourceType(null);
   }, []);
 
-  // Helper function to redistribute pods evenly around their nodes
-  const redistributePodsHelper = useCallback((pods: Pod[], nodes: Node[]): Pod[] => {
-    // Create a map of node positions
-    const nodePositions = new Map(nodes.map(n => [n.name, n.position]));
-
-    // Group pods by node
-    const podsByNode = new Map<string, Pod[]>();
-    pods.forEach(pod => {
-      if (pod.nodeName) {
-        const nodePods = podsByNode.get(pod.nodeName) || [];
-        nodePods.push(pod);
-        podsByNode.set(pod.nodeName, nodePods);
-      }
-    });
-
-    // Recalculate positions for pods on each node
-    return pods.map(pod => {
-      if (!pod.nodeName) return pod; // Unscheduled pods stay at origin
-
-      const nodePos = nodePositions.get(pod.nodeName) || { x: 0, y: 0, z: 0 };
-      const nodePods = podsByNode.get(pod.nodeName) || [];
-      const podIndex = nodePods.findIndex(p => p.id === pod.id);
-      const totalPods = nodePods.length;
-
-      if (totalPods === 0) return pod;
-
-      const angle = (podIndex * 2.0 * Math.PI) / totalPods;
-      const orbitRadius = 3.0;
-
-      return {
-        ...pod,
-        position: {
-          x: nodePos.x + orbitRadius * Math.cos(angle),
-          y: nodePos.y,
-          z: nodePos.z + orbitRadius * Math.sin(angle),
-        },
-      };
-    });
-  }, []);
+  // resourceVersions of the last snapshot per watch; deltas at or below them are already applied
+  const snapshotVersionsRef = useRef({ pods: 0, nodes: 0 });
 
-  // Redistribute pods whenever rawPods or nodes change
-  useEffect(() => {
-    if (rawPods.length === 0) {
-      setPods([]);
-      return;
-    }
+  // Handle WebSocket messages
+  const handleWebSocketMessage = useCallback((event: { type: string; data: any }) => {
+    const { type, data } = event;
 
-    if (nodes.length === 0) {
-      setPods(rawPods); // Show pods even if nodes aren't loaded yet
+    // Skip deltas that were queued before the snapshot was taken. Pods and nodes are
+    // separate watches, so each is compared against its own resourceVersion.
+    const watch = type.startsWith('pod') ? 'pods' : type.startsWith('node') ? 'nodes' : null;
+    if (watch && data?.resourceVersion && Number(data.resourceVersion) <= snapshotVersionsRef.current[watch]) {
       return;
     }
 
-    const redistributed = redistributePodsHelper(rawPods, nodes);
-    setPods(redistributed);
-    // eslint-disable-next-line react-hooks/exhaustive-deps
-  }, [rawPods, nodes]);
+    switch (type) {
+      case 'snapshot': {
+        const versions = (data as Snapshot).resourceVersions;
+        snapshotVersionsRef.current = {
+          pods: Number(versions?.pods) || 0,
+          nodes: Number(versions?.nodes) || 0,
+        };
+        setNodes(data.nodes);
+        setPods(data.metrics ? applyMetrics(data.pods, data.metrics) : data.pods);
+        if (data.status) {
+          setBackendStatus(data.status);
+        }
+        setLoading(false);
+        break;
+      }
 
-  // Handle WebSocket messages
-  const handleWebSocketMessage = useCallback((event: { type: string; data: any }) => {
-    const { type, data } = event;
+      case 'backend_status': {
+        const status = data as BackendStatus;
+        setBackendStatus(status);
+        if (status.state === 'connected') {
+          addToast('Cluster connection restored', 'success');
+        } else {
+          addToast(status.message || `Backend ${status.state}`, status.state === 'reconnecting' ? 'error' : 'warning');
+        }
+        break;
+      }
 
-    switch (type) {
       case 'pod_added':
         if (data.pod) {
-          setRawPods((prev) => {
+          setPods((prev) => {
             // Check if pod already exists
             if (prev.find((p) => p.id === data.pod.id)) {
               return prev;
@@ -134,7 +143,7 @@ export default function App() {
 
       case 'pod_modified':
         if (data.pod) {
-          setRawPods((prev) =>
+          setPods((prev) =>
             prev.map((p) => (p.id === data.pod.id ? data.pod : p))
           );
         }
@@ -142,7 +151,7 @@ export default function App() {
 
       case 'pod_deleted':
         if (data.pod) {
-          setRawPods((prev) => {
+          setPods((prev) => {
             const pod = prev.find((p) => p.id === data.pod.id);
             if (pod) {
               addToast(`Pod deleted: ${pod.namespace}/${pod.name}`, 'warning');
@@ -152,6 +161,47 @@ export default function App() {
         }
         break;
 
+      case 'pods_changed': {
+        // A batch of pod changes collected over a short window on the server
+        const changes: PodsChanged = data.changes || {};
+        const added = changes.added || [];
+        const modified = changes.modified || [];
+        const deleted = changes.deleted || [];
+        const podMoves = changes.layout?.pods || {};
+        const nodeMoves = changes.layout?.nodes || {};
+
+        if (Object.keys(nodeMoves).length > 0) {
+          setNodes((prev) =>
+            prev.map((n) => (nodeMoves[n.name] ? { ...n, position: nodeMoves[n.name] } : n))
+          );
+        }
+
+        setPods((prev) => {
+          const modifiedById = new Map(modified.map((change) => [change.pod.id, change.pod]));
+          const deletedIds = new Set(deleted.map((pod) => pod.id));
+          const existingIds = new Set(prev.map((p) => p.id));
+
+          const next = prev
+            .filter((p) => !deletedIds.has(p.id))
+            .map((p) => modifiedById.get(p.id) || p)
+            .map((p) => (podMoves[p.id] ? { ...p, position: podMoves[p.id] } : p));
+          return [...next, ...added.filter((pod) => !existingIds.has(pod.id))];
+        });
+
+        // One toast per kind of change, rather than one per pod
+        if (added.length === 1) {
+          addToast(`Pod created: ${added[0].namespace}/${added[0].name}`, 'success');
+        } else if (added.length > 1) {
+          addToast(`${added.length} pods created`, 'success');
+        }
+        if (deleted.length === 1) {
+          addToast(`Pod deleted: ${deleted[0].namespace}/${deleted[0].name}`, 'warning');
+        } else if (deleted.length > 1) {
+          addToast(`${deleted.length} pods deleted`, 'warning');
+        }
+        break;
+      }
+
       case 'node_added':
         if (data.node) {
           setNodes((prev) => {
@@ -169,8 +219,7 @@ export default function App() {
           setNodes((prev) =>
             prev.map((n) => {
               if (n.id === data.node.id) {
-                // Preserve original position, only update other fields
-                return { ...data.node, position: n.position };
+                return data.node;
               }
               return n;
             })
@@ -190,30 +239,22 @@ export default function App() {
         }
         break;
 
+      case 'layout_changed':
+        // Positions are owned by the backend; apply moves caused by adds/deletes
+        if (data.layout) {
+          const { nodes: nodeMoves = {}, pods: podMoves = {} } = data.layout;
+          setNodes((prev) =>
+            prev.map((n) => (nodeMoves[n.name] ? { ...n, position: nodeMoves[n.name] } : n))
+          );
+          setPods((prev) =>
+            prev.map((p) => (podMoves[p.id] ? { ...p, position: podMoves[p.id] } : p))
+          );
+        }
+        break;
+
       case 'metrics_update':
         if (data.pods) {
-          setRawPods((prev) =>
-            prev.map((pod) => {
-              // Find matching metrics for this pod
-              const metrics = data.pods.find((m: any) => m.podId === pod.id);
-              if (!metrics) return pod;
-
-              // Update pod and container metrics
-              return {
-                ...pod,
-                cpu: metrics.totalCpu,
-                memory: metrics.totalMemory,
-                containers: pod.containers.map((container) => {
-                  const containerMetrics = metrics.containers.find(
-                    (cm: any) => cm.name === container.name
-                  );
-                  return containerMetrics
-                    ? { ...container, cpu: containerMetrics.cpu, memory: containerMetrics.memory }
-                    : container;
-                }),
-              };
-            })
-          );
+          setPods((prev) => applyMetrics(prev, data));
         }
         break;
     }
@@ -238,14 +279,19 @@ export default function App() {
   }, []);
 
   // WebSocket connection
-  const { isConnected } = useWebSocket({
-    url: 'ws://localhost:8000/ws',
+  const { isConnected, send } = useWebSocket({
+    url: WS_URL,
     onMessage: handleWebSocketMessage,
     onConnect: handleConnect,
     onDisconnect: handleDisconnect,
     onError: handleError,
   });
 
+  // The WebSocket being up only means the backend is; it may have lost the cluster
+  const statusIndicator = isConnected
+    ? backendStateLabels[backendStatus?.state ?? 'connected']
+    : { label: 'Offline', className: 'status-disconnected' };
+
   // Initial data load
   useEffect(() => {
     const loadData = async () => {
@@ -259,7 +305,7 @@ export default function App() {
         ]);
 
         setNodes(nodesData);
-        setRawPods(podsData);
+        setPods(podsData);
       } catch (err) {
         setError(err instanceof Error ? err.message : 'Failed to load data');
         console.error('Error loading cluster data:', err);
@@ -271,10 +317,21 @@ export default function App() {
     loadData();
   }, []);
 
-  // Extract unique namespaces and filter pods
+  // Only receive the selected namespace from the server; the resulting snapshot replaces all pods
+  useEffect(() => {
+    if (isConnected) {
+      send({
+        type: 'subscribe',
+        namespaces: selectedNamespace === 'all' ? [] : [selectedNamespace],
+      });
+    }
+  }, [isConnected, selectedNamespace, send]);
+
+  // Extract unique namespaces, remembering ones filtered out by the subscription
+  const knownNamespacesRef = useRef<Set<string>>(new Set());
   const namespaces = useMemo(() => {
-    const uniqueNamespaces = new Set(pods.map(p => p.namespace));
-    return Array.from(uniqueNamespaces).sort();
+    pods.forEach(p => knownNamespacesRef.current.add(p.namespace));
+    return Array.from(knownNamespacesRef.current).sort();
   }, [pods]);
 
   const filteredPods = useMemo(() => {
@@ -329,9 +386,9 @@ export default function App() {
           <span>
             <FontAwesomeIcon icon={faCube} /> {filteredPods.length}/{pods.length} pods
           </span>
-          <span className={isConnected ? 'status-connected' : 'status-disconnected'}>
+          <span className={statusIndicator.className} title={isConnected ? backendStatus?.message : undefined}>
             <FontAwesomeIcon icon={isConnected ? faCircleDot : faCircle} />
-            {isConnected ? ' Live' : ' Offline'}
+            {' '}{statusIndicator.label}
           </span>
         </div>
       </header>
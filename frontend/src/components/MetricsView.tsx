@@ -40,6 +40,20 @@ export default function MetricsView({ metrics, resource, resourceType }: Metrics
     return `${mb.toFixed(0)} MB`;
   };
 
+  const formatBytes = (bytes: number) => {
+    if (bytes >= 1024 * 1024 * 1024) {
+      return `${(bytes / (1024 * 1024 * 1024)).toFixed(2)} GB`;
+    }
+    if (bytes >= 1024 * 1024) {
+      return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+    }
+    return `${(bytes / 1024).toFixed(1)} KB`;
+  };
+
+  const diskPercent = metrics.filesystem?.capacityBytes
+    ? (metrics.filesystem.usedBytes / metrics.filesystem.capacityBytes) * 100
+    : 0;
+
   const getBarColor = (percent: number) => {
     if (percent < 50) return '#10b981'; // green
     if (percent < 80) return '#f59e0b'; // yellow/orange
@@ -105,8 +119,65 @@ export default function MetricsView({ metrics, resource, resourceType }: Metrics
             )}
           </div>
         </div>
+
+        {/* Network Rates, missing until two fetches were made */}
+        {metrics.network && (
+          <div className="metric-card">
+            <div className="metric-icon">🌐</div>
+            <div className="metric-info">
+              <div className="metric-label">Network</div>
+              <div className="metric-value">↓ {formatBytes(metrics.network.rxBytesPerSecond)}/s</div>
+              <div className="metric-subtext">↑ {formatBytes(metrics.network.txBytesPerSecond)}/s</div>
+            </div>
+          </div>
+        )}
+
+        {/* Disk Usage */}
+        {metrics.filesystem && (
+          <div className="metric-card">
+            <div className="metric-icon">🗄️</div>
+            <div className="metric-info">
+              <div className="metric-label">{isPod ? 'Ephemeral Storage' : 'Disk Usage'}</div>
+              <div className="metric-value">{formatBytes(metrics.filesystem.usedBytes)}</div>
+              {metrics.filesystem.capacityBytes ? (
+                <>
+                  <div className="metric-bar">
+                    <div
+                      className="metric-bar-fill"
+                      style={{
+                        width: `${Math.min(diskPercent, 100)}%`,
+                        backgroundColor: getBarColor(diskPercent),
+                      }}
+                    />
+                  </div>
+                  <div className="metric-subtext">
+                    {diskPercent.toFixed(1)}% of {formatBytes(metrics.filesystem.capacityBytes)}
+                  </div>
+                </>
+              ) : null}
+            </div>
+          </div>
+        )}
       </div>
 
+      {/* Volume Usage for Pods */}
+      {metrics.volumes && metrics.volumes.length > 0 && (
+        <div className="containers-metrics">
+          <h4>Volumes</h4>
+          <div className="containers-list-small">
+            {metrics.volumes.map((volume) => (
+              <div key={volume.name} className="container-item-small">
+                <span className="container-name-small">{volume.name}</span>
+                <span className="metric-subtext">
+                  {formatBytes(volume.usedBytes)}
+                  {volume.capacityBytes ? ` of ${formatBytes(volume.capacityBytes)}` : ''}
+                </span>
+              </div>
+            ))}
+          </div>
+        </div>
+      )}
+
       {/* Additional Info for Pods */}
       {pod && pod.containers && pod.containers.length > 0 && (
         <div className="containers-metrics">
@@ -126,7 +197,7 @@ export default function MetricsView({ metrics, resource, resourceType }: Metrics
 
       <div className="metrics-note">
         <p>
-          📊 Metrics are fetched from the Kubernetes metrics-server in real-time.
+          📊 Metrics are fetched from the cluster's metrics source in real-time.
           {isPod && ' Pod metrics show aggregate usage across all containers.'}
         </p>
       </div>
@@ -18,14 +18,28 @@ export default function PodSphere({ pod, onClick }: PodSphereProps) {
 
   // Color based on pod status
   const getColor = () => {
+    if (pod.status.startsWith('Init:')) {
+      return '#0088ff';
+    }
+
     switch (pod.status) {
       case 'Running':
         return '#00ff00';
       case 'Pending':
+      case 'ContainerCreating':
+      case 'PodInitializing':
         return '#0088ff';
       case 'Failed':
+      case 'Error':
+      case 'CrashLoopBackOff':
+      case 'ImagePullBackOff':
+      case 'ErrImagePull':
+      case 'OOMKilled':
         return '#ff0000';
+      case 'Terminating':
+        return '#ff8800';
       case 'Succeeded':
+      case 'Completed':
         return '#888888';
       default:
         return '#ffff00';
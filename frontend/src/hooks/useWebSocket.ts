@@ -1,7 +1,10 @@
 import { useEffect, useRef, useCallback, useState } from 'react';
 
 interface WebSocketEvent {
+  version?: number;
   type: string;
+  seq?: number;
+  epoch?: string;
   data: any;
 }
 
@@ -28,6 +31,10 @@ export function useWebSocket({
   const isConnectingRef = useRef(false);
   const shouldReconnectRef = useRef(true);
 
+  // Last sequence number and server epoch seen, sent back to resume after a reconnect
+  const lastSeqRef = useRef(0);
+  const epochRef = useRef<string | null>(null);
+
   // Store callbacks in refs to avoid reconnecting when they change
   const onMessageRef = useRef(onMessage);
   const onConnectRef = useRef(onConnect);
@@ -68,8 +75,13 @@ export function useWebSocket({
     }
 
     isConnectingRef.current = true;
-    console.log(`[WebSocket] Connecting to ${url}`);
-    const ws = new WebSocket(url);
+    let connectUrl = url;
+    if (epochRef.current) {
+      const separator = url.includes('?') ? '&' : '?';
+      connectUrl = `${url}${separator}epoch=${encodeURIComponent(epochRef.current)}&lastSeq=${lastSeqRef.current}`;
+    }
+    console.log(`[WebSocket] Connecting to ${connectUrl}`);
+    const ws = new WebSocket(connectUrl);
 
     // Send periodic heartbeat to keep connection alive
     let heartbeatInterval: NodeJS.Timeout;
@@ -95,8 +107,14 @@ export function useWebSocket({
         const messages = event.data.trim().split('\n');
         for (const message of messages) {
           if (message.trim()) {
-            const data = JSON.parse(message);
+            const data: WebSocketEvent = JSON.parse(message);
             console.log('[WebSocket] Received message:', data.type);
+            if (data.epoch) {
+              epochRef.current = data.epoch;
+            }
+            if (data.seq) {
+              lastSeqRef.current = data.seq;
+            }
             onMessageRef.current?.(data);
           }
         }
@@ -1,6 +1,12 @@
-import { Node, Pod } from '../types';
+import { FilesystemUsage, NetworkRates, Node, Pod, VolumeUsage } from '../types';
 
-const API_BASE = '/api';
+// The backend may serve the UI under a base path, announced with a <base> element
+const BASE_PATH = new URL('.', document.baseURI).pathname.replace(/\/$/, '');
+
+const API_BASE = `${BASE_PATH}/api/v1`;
+
+// WebSocket endpoint on the server that served the page
+export const WS_URL = `${window.location.protocol === 'https:' ? 'wss:' : 'ws:'}//${window.location.host}${BASE_PATH}/ws`;
 
 export async function fetchNodes(): Promise<Node[]> {
   const response = await fetch(`${API_BASE}/nodes`);
@@ -59,6 +65,9 @@ export interface Metrics {
   namespace?: string;
   cpuUsage: number;    // in millicores
   memoryUsage: number; // in MB
+  network?: NetworkRates;
+  filesystem?: FilesystemUsage;
+  volumes?: VolumeUsage[]; // pods only
   timestamp: string;
 }
 
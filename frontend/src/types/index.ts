@@ -20,11 +20,42 @@ export interface Node {
   position: Position;
 }
 
+export interface ContainerState {
+  state: string;
+  reason?: string;
+  message?: string;
+  exitCode?: number;
+  startedAt: string;
+  finishedAt: string;
+}
+
+export interface OwnerReference {
+  kind: string;
+  name: string;
+  uid: string;
+  controller: boolean;
+}
+
+export interface Resources {
+  cpu?: number;        // millicores
+  memory?: number;     // MB
+}
+
 export interface Container {
   name: string;
-  status: string;
+  image: string;
+  status: string;      // "Running", "Waiting", "Terminated" or "Unknown"
+  reason?: string;
+  message?: string;
+  exitCode?: number;
+  ready: boolean;
   restarts: number;
-  type: string;        // "main", "sidecar", or "init"
+  lastState?: ContainerState;
+  type: string;        // "main", "sidecar", "init", or "ephemeral"
+  typeRule?: string;   // why the container got its type, e.g. "rule:istio-proxy"
+  nativeSidecar?: boolean;
+  requests?: Resources;
+  limits?: Resources;
   cpu: number;         // millicores
   memory: number;      // MB
 }
@@ -33,8 +64,26 @@ export interface Pod {
   id: string;
   name: string;
   namespace: string;
-  status: string;
+  status: string;      // kubectl-style status, e.g. "CrashLoopBackOff"
+  phase: string;
+  reason?: string;
+  message?: string;
+  ready: boolean;
+  readyContainers: number;
+  totalContainers: number;
+  restarts: number;
+  terminating: boolean;
   nodeName: string;
+  labels: Record<string, string>;
+  annotations?: Record<string, string>;
+  owner?: OwnerReference;
+  ownerReferences?: OwnerReference[];
+  podIP?: string;
+  podIPs?: string[];
+  hostIP?: string;
+  qosClass?: string;   // "Guaranteed", "Burstable" or "BestEffort"
+  priority?: number;
+  priorityClassName?: string;
   containers: Container[];
   createdAt: string;
   position: Position;
@@ -42,6 +91,22 @@ export interface Pod {
   memory: number;      // total memory usage in MB
 }
 
+// Network transfer rates computed between two metrics fetches
+export interface NetworkRates {
+  rxBytesPerSecond: number;
+  txBytesPerSecond: number;
+}
+
+// Space used on a pod's ephemeral storage or a node's root filesystem
+export interface FilesystemUsage {
+  usedBytes: number;
+  capacityBytes?: number; // missing when unknown
+}
+
+export interface VolumeUsage extends FilesystemUsage {
+  name: string;
+}
+
 // Metrics update event
 export interface MetricsUpdate {
   type: 'metrics_update';
@@ -49,14 +114,110 @@ export interface MetricsUpdate {
     podId: string;
     name: string;
     namespace: string;
+    workload?: string;
     totalCpu: number;
     totalMemory: number;
+    restarts?: number; // only from sources that report it, e.g. Prometheus
     containers: {
       name: string;
       cpu: number;
       memory: number;
     }[];
+    network?: NetworkRates;
+    filesystem?: FilesystemUsage;
+    volumes?: VolumeUsage[];
     timestamp: string;
   }[];
+  nodes?: {
+    name: string;
+    cpuUsage: number;    // in millicores
+    memoryUsage: number; // in MB
+    network?: NetworkRates;
+    filesystem?: FilesystemUsage;
+    timestamp: string;
+  }[];
+  timestamp: string;
+}
+
+// Galaxy mode: pods collapsed into per-namespace or per-workload clusters
+export interface PodCluster {
+  key: string;
+  namespace: string;
+  workload?: string;   // e.g. "Deployment/web"
+  count: number;
+  statuses: Record<string, number>;
+  nodes: Record<string, number>;
+  restarts: number;
+  cpu: number;         // summed millicores
+  memory: number;      // summed MB
+  position: Position;
+}
+
+export interface ClustersUpdate {
+  groupBy: 'namespace' | 'workload';
+  clusters: PodCluster[];
   timestamp: string;
 }
+
+export interface GroupPods {
+  groupBy: 'namespace' | 'workload';
+  group: string;
+  pods: Pod[];
+}
+
+// The backend's connection to the cluster, sent as backend_status when the state changes
+export type BackendState = 'connected' | 'metrics_unavailable' | 'degraded' | 'reconnecting';
+
+export interface WatchStatus {
+  resource: string;
+  synced: boolean;
+  started: string;
+  lastEvent?: string;
+  lastError?: string;
+  lastErrorAt?: string;
+  failingSince?: string;
+}
+
+export interface BackendStatus {
+  state: BackendState;
+  message?: string;
+  since: string;
+  checkedAt: string;
+  apiReachable: boolean;
+  apiError?: string;
+  watches: WatchStatus[];
+  metrics: {
+    lastSuccess?: string;
+    lastError?: string;
+    lastErrorAt?: string;
+  };
+}
+
+// Sent once on every WebSocket (re)connect, before any deltas
+export interface Snapshot {
+  resourceVersions: {
+    pods: string;
+    nodes: string;
+  };
+  nodes: Node[];
+  pods: Pod[];
+  metrics?: MetricsUpdate;
+  status?: BackendStatus;
+}
+
+export interface LayoutChange {
+  nodes?: Record<string, Position>;
+  pods?: Record<string, Position>;
+}
+
+export interface PodChange {
+  pod: Pod;
+  changed: string[]; // field names, e.g. ["status", "ready"]
+}
+
+export interface PodsChanged {
+  added?: Pod[];
+  modified?: PodChange[];
+  deleted?: Pod[];
+  layout?: LayoutChange;
+}